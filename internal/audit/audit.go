@@ -0,0 +1,66 @@
+// Package audit emits security relevant events
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Event types
+const (
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	EventAccountLocked     = "account_locked"
+	EventAccountUnlocked   = "account_unlocked"
+	EventPasswordChanged   = "password_changed"
+	EventPasswordReset     = "password_reset"
+	EventEmailVerified     = "email_verified"
+	EventTOTPEnabled       = "totp_enabled"
+	EventTOTPDisabled      = "totp_disabled"
+	EventRecoveryCodeUsed  = "recovery_code_used"
+	EventPasskeyRegistered = "passkey_registered"
+	EventRoleAssigned      = "role_assigned"
+	EventRoleRevoked       = "role_revoked"
+)
+
+// Event struct represents a single security relevant event
+type Event struct {
+	Type      string
+	ProfileID uuid.UUID
+	Time      time.Time
+	Details   map[string]interface{}
+}
+
+// Sink interface receives audit events
+type Sink interface {
+	Emit(ctx context.Context, event *Event)
+}
+
+// LogSink struct writes audit events to a logrus logger
+type LogSink struct {
+	logger logrus.FieldLogger
+}
+
+// NewLogSink creates a new LogSink
+func NewLogSink(logger logrus.FieldLogger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+// Emit implements Sink interface
+func (s *LogSink) Emit(_ context.Context, event *Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	fields := logrus.Fields{
+		"audit":      true,
+		"event":      event.Type,
+		"profile_id": event.ProfileID,
+		"time":       event.Time,
+	}
+	for k, v := range event.Details {
+		fields[k] = v
+	}
+	s.logger.WithFields(fields).Warn("audit event")
+}
@@ -0,0 +1,114 @@
+// Package authz decides whether roles of a caller grant a permission required by an RPC
+package authz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+)
+
+// Permissions are named <resource>:<action>:<scope>, a self scope allows acting on the caller's own profile,
+// an any scope allows acting on every profile
+const (
+	ProfileReadSelf       = "profile:read:self"
+	ProfileReadAny        = "profile:read:any"
+	ProfileUpdateSelf     = "profile:update:self"
+	ProfileUpdateAny      = "profile:update:any"
+	ProfileDeleteSelf     = "profile:delete:self"
+	ProfileDeleteAny      = "profile:delete:any"
+	ProfileUnlockAny      = "profile:unlock:any"
+	CredentialsManageSelf = "credentials:manage:self"
+	CredentialsManageAny  = "credentials:manage:any"
+	SessionManageSelf     = "session:manage:self"
+	SessionManageAny      = "session:manage:any"
+	RoleReadSelf          = "role:read:self"
+	RoleReadAny           = "role:read:any"
+	RoleAssignAny         = "role:assign:any"
+)
+
+// defaultCacheTTL is a lifetime of cached role permissions if none is configured
+const defaultCacheTTL = time.Minute
+
+// Rule struct declares who may call an RPC
+type Rule struct {
+	// Public RPCs are callable without an access token
+	Public bool
+	// Self is a permission to call the RPC on the caller's own profile, empty if there is none
+	Self string
+	// Any is a permission to call the RPC on every profile
+	Any string
+}
+
+// RoleStore interface provides permissions of every role by its name
+type RoleStore interface {
+	RolePermissions(ctx context.Context) (map[string][]string, error)
+}
+
+// Authorizer struct checks roles against rules, permissions of roles are cached for a while,
+// so changes of role permissions take effect within the cache lifetime
+type Authorizer struct {
+	store    RoleStore
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	granted  map[string]map[string]bool
+	loadedAt time.Time
+}
+
+// NewAuthorizer creates a new Authorizer, a non-positive cacheTTL defaults to a minute
+func NewAuthorizer(store RoleStore, cacheTTL time.Duration) *Authorizer {
+	if cacheTTL <= 0 {
+		cacheTTL = defaultCacheTTL
+	}
+	return &Authorizer{store: store, cacheTTL: cacheTTL}
+}
+
+// Authorize function returns model.ErrPermissionDenied unless one of roles grants the Any permission of the rule
+// or, if the call targets the caller's own profile, its Self permission
+func (a *Authorizer) Authorize(ctx context.Context, roles []string, rule Rule, self bool) error {
+	if rule.Public {
+		return nil
+	}
+	granted, err := a.permissions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if rule.Any != "" && granted[role][rule.Any] {
+			return nil
+		}
+		if self && rule.Self != "" && granted[role][rule.Self] {
+			return nil
+		}
+	}
+	return fmt.Errorf("roles %v: %w", roles, model.ErrPermissionDenied)
+}
+
+// permissions function returns cached permissions of roles, reloading them once the cache expires
+func (a *Authorizer) permissions(ctx context.Context) (map[string]map[string]bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.granted != nil && time.Since(a.loadedAt) < a.cacheTTL {
+		return a.granted, nil
+	}
+	byRole, err := a.store.RolePermissions(ctx)
+	if err != nil {
+		if a.granted != nil {
+			// a stale cache is better than denying every call while the database is unavailable
+			return a.granted, nil
+		}
+		return nil, fmt.Errorf("RolePermissions: %w", err)
+	}
+	granted := make(map[string]map[string]bool, len(byRole))
+	for role, permissions := range byRole {
+		granted[role] = make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			granted[role][permission] = true
+		}
+	}
+	a.granted, a.loadedAt = granted, time.Now()
+	return granted, nil
+}
@@ -0,0 +1,81 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore struct serves fixed role permissions and counts loads
+type testStore struct {
+	permissions map[string][]string
+	err         error
+	loads       int
+}
+
+func (s *testStore) RolePermissions(context.Context) (map[string][]string, error) {
+	s.loads++
+	return s.permissions, s.err
+}
+
+func newTestStore() *testStore {
+	return &testStore{permissions: map[string][]string{
+		model.RoleUser:  {ProfileDeleteSelf},
+		model.RoleAdmin: {ProfileDeleteAny, ProfileUnlockAny},
+	}}
+}
+
+func TestAuthorize(t *testing.T) {
+	authorizer := NewAuthorizer(newTestStore(), time.Minute)
+	deleteRule := Rule{Self: ProfileDeleteSelf, Any: ProfileDeleteAny}
+	unlockRule := Rule{Any: ProfileUnlockAny}
+
+	require.NoError(t, authorizer.Authorize(context.Background(), []string{model.RoleUser}, deleteRule, true))
+	require.ErrorIs(t, authorizer.Authorize(context.Background(), []string{model.RoleUser}, deleteRule, false), model.ErrPermissionDenied)
+	require.NoError(t, authorizer.Authorize(context.Background(), []string{model.RoleUser, model.RoleAdmin}, deleteRule, false))
+
+	// rules without a self permission need the any permission even for the own profile
+	require.ErrorIs(t, authorizer.Authorize(context.Background(), []string{model.RoleUser}, unlockRule, true), model.ErrPermissionDenied)
+	require.NoError(t, authorizer.Authorize(context.Background(), []string{model.RoleAdmin}, unlockRule, true))
+
+	require.ErrorIs(t, authorizer.Authorize(context.Background(), nil, deleteRule, true), model.ErrPermissionDenied)
+	require.NoError(t, authorizer.Authorize(context.Background(), nil, Rule{Public: true}, false))
+}
+
+func TestAuthorizeCachesPermissions(t *testing.T) {
+	store := newTestStore()
+	authorizer := NewAuthorizer(store, time.Minute)
+	rule := Rule{Self: ProfileDeleteSelf}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, authorizer.Authorize(context.Background(), []string{model.RoleUser}, rule, true))
+	}
+	require.Equal(t, 1, store.loads)
+
+	// an expired cache is kept if reloading fails
+	authorizer.loadedAt = time.Now().Add(-time.Hour)
+	store.err = errors.New("database is down")
+	require.NoError(t, authorizer.Authorize(context.Background(), []string{model.RoleUser}, rule, true))
+	require.Equal(t, 2, store.loads)
+
+	failing := NewAuthorizer(&testStore{err: errors.New("database is down")}, time.Minute)
+	err := failing.Authorize(context.Background(), []string{model.RoleUser}, rule, true)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, model.ErrPermissionDenied)
+}
+
+func TestPrincipalContext(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+	require.False(t, ok)
+	_, ok = PrincipalFromContext(ContextWithPrincipal(context.Background(), nil))
+	require.False(t, ok)
+
+	principal := &Principal{ProfileID: uuid.New(), SessionID: uuid.New(), Roles: []string{model.RoleUser}}
+	got, ok := PrincipalFromContext(ContextWithPrincipal(context.Background(), principal))
+	require.True(t, ok)
+	require.Equal(t, principal, got)
+}
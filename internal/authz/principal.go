@@ -0,0 +1,48 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Principal struct identifies an authenticated caller
+type Principal struct {
+	ProfileID uuid.UUID
+	// SessionID is a session of the caller's access token
+	SessionID uuid.UUID
+	Roles     []string
+}
+
+// principalKey is a context key of the Principal
+type principalKey struct{}
+
+// ContextWithPrincipal function returns a copy of ctx carrying the principal
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext function returns the principal of an authenticated call, ok is false for anonymous calls
+func PrincipalFromContext(ctx context.Context) (principal *Principal, ok bool) {
+	principal, ok = ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Service struct identifies an internal service calling with a client certificate
+type Service struct {
+	Name string
+}
+
+// serviceKey is a context key of the Service
+type serviceKey struct{}
+
+// ContextWithService function returns a copy of ctx carrying the calling service
+func ContextWithService(ctx context.Context, service *Service) context.Context {
+	return context.WithValue(ctx, serviceKey{}, service)
+}
+
+// ServiceFromContext function returns the service making the call, ok is false if the caller is not a known service
+func ServiceFromContext(ctx context.Context) (service *Service, ok bool) {
+	service, ok = ctx.Value(serviceKey{}).(*Service)
+	return service, ok && service != nil
+}
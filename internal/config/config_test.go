@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// validEnv function returns the least environment a Config loads from
+func validEnv() map[string]string {
+	return map[string]string{
+		"DB_URL":          "postgres://localhost:5432/profile_db",
+		"TOKEN_SECRET":    "0123456789abcdef0123456789abcdef",
+		"NOTIFY_NOTIFIER": "file",
+	}
+}
+
+func TestServiceIdentities(t *testing.T) {
+	environment := validEnv()
+	environment["SERVER_TLS_CERT_FILE"] = "server.pem"
+	environment["SERVER_TLS_KEY_FILE"] = "server.key"
+	environment["SERVER_TLS_CLIENT_CA_FILE"] = "ca.pem"
+	environment["SERVER_TLS_SERVICE_IDENTITIES"] = "spiffe://corp/billing=billing; orders.internal=orders;"
+	environment["SERVER_TLS_SERVICE_RPCS"] = "billing=GetProfileByID,ValidateToken;orders=GetProfileByID"
+	cfg, err := load(nil, environment)
+	require.NoError(t, err)
+	require.Equal(t, ServiceIdentities{"spiffe://corp/billing": "billing", "orders.internal": "orders"}, cfg.Server.TLS.ServiceIdentities)
+	require.Equal(t, ServiceRPCs{"billing": {"GetProfileByID", "ValidateToken"}, "orders": {"GetProfileByID"}}, cfg.Server.TLS.ServiceRPCs)
+
+	var identities ServiceIdentities
+	require.Error(t, identities.UnmarshalText([]byte("billing")))
+	require.Error(t, identities.UnmarshalText([]byte("billing=")))
+	var rpcs ServiceRPCs
+	require.Error(t, rpcs.UnmarshalText([]byte("=GetProfileByID")))
+}
+
+func TestLoadLayersFileUnderEnv(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(name, []byte(`
+server:
+  listen_addr: 0.0.0.0:9090
+  keepalive:
+    time: 1h
+  health:
+    interval: 30s
+  reflection: true
+db:
+  url: postgres://file:5432/profile_db
+  max_conns: 20
+webauthn:
+  origins: [https://a.example.com, https://b.example.com]
+log:
+  format: json
+`), 0o600)
+	require.NoError(t, err)
+	fromFile, err := readFile(name)
+	require.NoError(t, err)
+	environment := validEnv()
+	environment["DB_MAX_CONNS"] = "30"
+
+	cfg, err := load(fromFile, environment)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0:9090", cfg.Server.ListenAddr)
+	require.Equal(t, time.Hour, cfg.Server.Keepalive.Time)
+	require.Equal(t, 20*time.Second, cfg.Server.Keepalive.Timeout)
+	require.Equal(t, 30*time.Second, cfg.Server.Health.Interval)
+	require.Equal(t, 2*time.Second, cfg.Server.Health.Timeout)
+	require.True(t, cfg.Server.Reflection)
+	// environment variables override the file
+	require.Equal(t, "postgres://localhost:5432/profile_db", cfg.Database.URL)
+	require.Equal(t, int32(30), cfg.Database.MaxConns)
+	require.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.WebAuthn.Origins)
+	require.Equal(t, "json", cfg.Log.Format)
+	require.Equal(t, "info", cfg.Log.Level)
+}
+
+func TestLoadReportsEveryInvalidField(t *testing.T) {
+	environment := map[string]string{
+		"SERVER_LISTEN_ADDR":             "8082",
+		"SERVER_TLS_REQUIRE_CLIENT_CERT": "true",
+		"SERVER_HEALTH_TIMEOUT":          "1m",
+		"DB_MIN_CONNS":                   "20",
+		"LOG_FORMAT":                     "xml",
+		"METRICS_LISTEN_ADDR":            "9090",
+		"TRACING_EXPORTER":               "otlp",
+		"TRACING_OTLP_ENDPOINT":          "collector",
+		"TOKEN_SECRET":                   "short",
+	}
+	_, err := load(map[string]string{"SERVER_LISTEN_ADR": "0.0.0.0:8082"}, environment)
+	var errs ValidationErrors
+	require.True(t, errors.As(err, &errs))
+	var fields []string
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	require.Equal(t, []string{
+		"SERVER_LISTEN_ADR",
+		"SERVER_LISTEN_ADDR",
+		"SERVER_HEALTH_TIMEOUT",
+		"SERVER_TLS_REQUIRE_CLIENT_CERT",
+		"DB_URL",
+		"DB_MIN_CONNS",
+		"LOG_FORMAT",
+		"METRICS_LISTEN_ADDR",
+		"TRACING_OTLP_ENDPOINT",
+		"TOKEN_SECRET",
+		"NOTIFY_NOTIFIER",
+	}, fields)
+	require.Contains(t, err.Error(), "DB_URL: must be set")
+}
+
+func TestPasswordMaxLengthOfBcrypt(t *testing.T) {
+	environment := validEnv()
+	environment["PASSWORD_MAX_LENGTH"] = "73"
+	_, err := load(nil, environment)
+	var errs ValidationErrors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, ValidationErrors{{Field: "PASSWORD_MAX_LENGTH", Problem: "must not exceed 72 with bcrypt"}}, errs)
+
+	// argon2id has no such limit
+	environment["PASSWORD_ALGORITHM"] = "argon2id"
+	cfg, err := load(nil, environment)
+	require.NoError(t, err)
+	require.Equal(t, 73, cfg.Password.MaxLength)
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileEnv is an environment variable naming the configuration file
+const configFileEnv = "CONFIG_FILE"
+
+// environ function returns environment variables of the process
+func environ() map[string]string {
+	environment := map[string]string{}
+	for _, pair := range os.Environ() {
+		if key, value, found := strings.Cut(pair, "="); found {
+			environment[key] = value
+		}
+	}
+	return environment
+}
+
+// readFile function reads a YAML configuration file into settings named as environment variables,
+// nested keys are joined with underscores, so server: {listen_addr: ...} sets SERVER_LISTEN_ADDR.
+// Values are written as in environment variables, sequences are joined with commas
+func readFile(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile: %w", err)
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	settings := map[string]string{}
+	if len(doc.Content) == 0 {
+		return settings, nil
+	}
+	err = flatten("", doc.Content[0], settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return settings, nil
+}
+
+// flatten function stores scalars of the node into settings under prefixed upper case keys
+func flatten(prefix string, node *yaml.Node, settings map[string]string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := prefix + strings.ToUpper(node.Content[i].Value)
+			value := node.Content[i+1]
+			if value.Kind == yaml.MappingNode {
+				key += "_"
+			}
+			err := flatten(key, value, settings)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: %s must be a list of values", item.Line, prefix)
+			}
+			values = append(values, item.Value)
+		}
+		settings[prefix] = strings.Join(values, ",")
+	case yaml.ScalarNode:
+		if prefix == "" {
+			return fmt.Errorf("line %d: a mapping of settings expected", node.Line)
+		}
+		if node.Tag != "!!null" {
+			settings[prefix] = node.Value
+		}
+	case yaml.AliasNode:
+		return flatten(prefix, node.Alias, settings)
+	default:
+		return fmt.Errorf("line %d: unsupported value of %s", node.Line, prefix)
+	}
+	return nil
+}
+
+// unknownKeys function reports settings of the file which do not configure anything
+func unknownKeys(settings map[string]string, known map[string]bool) ValidationErrors {
+	var errs ValidationErrors
+	for key := range settings {
+		if !known[key] {
+			errs = append(errs, FieldError{Field: key, Problem: "unknown setting in " + configFileEnv})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding/base64"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/eugenshima/profile/internal/password"
+	"github.com/eugenshima/profile/internal/token"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldError struct describes a single invalid setting, Field is its environment variable
+type FieldError struct {
+	Field   string
+	Problem string
+}
+
+// ValidationErrors type lists every invalid setting of a Config
+type ValidationErrors []FieldError
+
+// Error implements error interface
+func (e ValidationErrors) Error() string {
+	problems := make([]string, 0, len(e))
+	for _, fe := range e {
+		problems = append(problems, fe.Field+": "+fe.Problem)
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+// validate function checks settings which parse but cannot work
+func (c *Config) validate() ValidationErrors {
+	var errs ValidationErrors
+	check := func(ok bool, field, problem string) {
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Problem: problem})
+		}
+	}
+	nonNegative := func(d time.Duration, field string) {
+		check(d >= 0, field, "must not be negative")
+	}
+
+	_, _, err := net.SplitHostPort(c.Server.ListenAddr)
+	check(err == nil, "SERVER_LISTEN_ADDR", "must be host:port")
+	check(c.Server.MaxRecvMsgSize > 0, "SERVER_MAX_RECV_MSG_SIZE", "must be positive")
+	check(c.Server.MaxSendMsgSize > 0, "SERVER_MAX_SEND_MSG_SIZE", "must be positive")
+	check(c.Server.MaxConnections >= 0, "SERVER_MAX_CONNECTIONS", "must not be negative")
+	check(c.Server.ConnectionTimeout > 0, "SERVER_CONNECTION_TIMEOUT", "must be positive")
+	check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT", "must be positive")
+	check(c.Server.Health.Interval > 0, "SERVER_HEALTH_INTERVAL", "must be positive")
+	check(c.Server.Health.Timeout > 0, "SERVER_HEALTH_TIMEOUT", "must be positive")
+	check(c.Server.Health.Timeout <= c.Server.Health.Interval, "SERVER_HEALTH_TIMEOUT", "must not exceed SERVER_HEALTH_INTERVAL")
+	nonNegative(c.Server.Keepalive.Time, "SERVER_KEEPALIVE_TIME")
+	nonNegative(c.Server.Keepalive.Timeout, "SERVER_KEEPALIVE_TIMEOUT")
+	nonNegative(c.Server.Keepalive.MaxConnectionIdle, "SERVER_KEEPALIVE_MAX_CONNECTION_IDLE")
+	nonNegative(c.Server.Keepalive.MaxConnectionAge, "SERVER_KEEPALIVE_MAX_CONNECTION_AGE")
+	nonNegative(c.Server.Keepalive.MaxConnectionAgeGrace, "SERVER_KEEPALIVE_MAX_CONNECTION_AGE_GRACE")
+	nonNegative(c.Server.Keepalive.MinPingInterval, "SERVER_KEEPALIVE_MIN_PING_INTERVAL")
+
+	tls := c.Server.TLS
+	check((tls.CertFile == "") == (tls.KeyFile == ""), "SERVER_TLS_KEY_FILE", "must be set together with SERVER_TLS_CERT_FILE")
+	check(tls.ClientCAFile == "" || tls.CertFile != "", "SERVER_TLS_CLIENT_CA_FILE", "requires SERVER_TLS_CERT_FILE")
+	check(!tls.RequireClientCert || tls.ClientCAFile != "", "SERVER_TLS_REQUIRE_CLIENT_CERT", "requires SERVER_TLS_CLIENT_CA_FILE")
+	check(len(tls.ServiceIdentities) == 0 || tls.ClientCAFile != "", "SERVER_TLS_SERVICE_IDENTITIES", "requires SERVER_TLS_CLIENT_CA_FILE")
+	nonNegative(tls.ReloadInterval, "SERVER_TLS_RELOAD_INTERVAL")
+
+	check(c.Database.URL != "", "DB_URL", "must be set")
+	check(c.Database.MaxConns > 0, "DB_MAX_CONNS", "must be positive")
+	check(c.Database.MinConns >= 0 && c.Database.MinConns <= c.Database.MaxConns, "DB_MIN_CONNS", "must be between 0 and DB_MAX_CONNS")
+	nonNegative(c.Database.ConnectTimeout, "DB_CONNECT_TIMEOUT")
+	nonNegative(c.Database.MaxConnLifetime, "DB_MAX_CONN_LIFETIME")
+	nonNegative(c.Database.MaxConnIdleTime, "DB_MAX_CONN_IDLE_TIME")
+	nonNegative(c.Database.StatementTimeout, "DB_STATEMENT_TIMEOUT")
+	check(c.Database.HealthCheckPeriod > 0, "DB_HEALTH_CHECK_PERIOD", "must be positive")
+
+	_, err = logrus.ParseLevel(c.Log.Level)
+	check(err == nil, "LOG_LEVEL", "must be one of trace, debug, info, warn, error, fatal or panic")
+	check(c.Log.Format == "text" || c.Log.Format == "json", "LOG_FORMAT", "must be either text or json")
+	if c.Metrics.ListenAddr != "" {
+		_, _, err = net.SplitHostPort(c.Metrics.ListenAddr)
+		check(err == nil, "METRICS_LISTEN_ADDR", "must be host:port")
+		check(c.Metrics.ListenAddr != c.Server.ListenAddr, "METRICS_LISTEN_ADDR", "must differ from SERVER_LISTEN_ADDR")
+	}
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout",
+		"TRACING_EXPORTER", "must be one of none, otlp or stdout")
+	check(c.Tracing.ServiceName != "", "TRACING_SERVICE_NAME", "must be set")
+	if c.Tracing.Exporter == "otlp" {
+		_, _, err = net.SplitHostPort(c.Tracing.OTLPEndpoint)
+		check(err == nil, "TRACING_OTLP_ENDPOINT", "must be host:port")
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+
+	check(c.Password.MinLength > 0, "PASSWORD_MIN_LENGTH", "must be positive")
+	check(c.Password.MaxLength >= c.Password.MinLength, "PASSWORD_MAX_LENGTH", "must not be less than PASSWORD_MIN_LENGTH")
+	check(c.Password.Algorithm == password.AlgorithmBcrypt || c.Password.Algorithm == password.AlgorithmArgon2id,
+		"PASSWORD_ALGORITHM", "must be either bcrypt or argon2id")
+	check(c.Password.Algorithm != password.AlgorithmBcrypt || c.Password.MaxLength <= password.BcryptMaxLength,
+		"PASSWORD_MAX_LENGTH", "must not exceed 72 with bcrypt")
+
+	switch c.Token.Algorithm {
+	case token.AlgorithmHS256:
+		check(len(c.Token.Secret) >= 32, "TOKEN_SECRET", "must be at least 32 bytes long for HS256")
+	case token.AlgorithmEdDSA, token.AlgorithmRS256:
+		check(c.Token.PrivateKeyFile != "", "TOKEN_PRIVATE_KEY_FILE", "must be set for "+c.Token.Algorithm)
+	default:
+		check(false, "TOKEN_ALGORITHM", "must be one of HS256, EdDSA or RS256")
+	}
+	check(c.Token.AccessTTL > 0, "TOKEN_ACCESS_TTL", "must be positive")
+	check(c.Token.RefreshTTL > 0, "TOKEN_REFRESH_TTL", "must be positive")
+
+	check(c.Lockout.Store == "memory" || c.Lockout.Store == "postgres", "LOCKOUT_STORE", "must be either memory or postgres")
+	check(c.Notify.Notifier == "log" || c.Notify.Notifier == "file" || c.Notify.Notifier == "smtp",
+		"NOTIFY_NOTIFIER", "must be one of log, file or smtp")
+
+	if c.MFA.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.MFA.EncryptionKey)
+		check(err == nil && len(key) == 32, "MFA_ENCRYPTION_KEY", "must be a base64 encoded 32 byte key")
+	}
+	check(c.MFA.RecoveryCodes > 0, "MFA_RECOVERY_CODES", "must be positive")
+	check(len(c.WebAuthn.Origins) > 0, "WEBAUTHN_ORIGINS", "must list at least one origin")
+	return errs
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// AuthenticationInterceptor function validates the bearer access token of every non-public RPC
+// and puts the caller's principal into the context of the handler
+func (ph *ProfileHandler) AuthenticationInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := ph.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthenticationInterceptor function is AuthenticationInterceptor of streaming RPCs
+func (ph *ProfileHandler) StreamAuthenticationInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := ph.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate function returns ctx carrying the principal of the caller's access token and a logger of the request
+// describing it,
+// public RPCs and services identified by ServiceAuthenticator are let through without one
+func (ph *ProfileHandler) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if authorizationRules[method].Public {
+		return ctx, nil
+	}
+	accessToken := bearerToken(ctx)
+	if accessToken == "" {
+		if _, ok := authz.ServiceFromContext(ctx); ok {
+			return ctx, nil
+		}
+		return nil, errorToStatus(model.ErrInvalidToken)
+	}
+	claims, err := ph.srv.ValidateToken(ctx, accessToken)
+	if err != nil {
+		return nil, errorToStatus(err)
+	}
+	ctx = logging.WithFields(ctx, logrus.Fields{"ProfileID": claims.ProfileID, "SessionID": claims.SessionID})
+	return authz.ContextWithPrincipal(ctx, &authz.Principal{
+		ProfileID: claims.ProfileID,
+		SessionID: claims.SessionID,
+		Roles:     claims.Roles,
+	}), nil
+}
+
+// authenticatedStream struct replaces a context of the stream with one carrying the principal
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream interface
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// testServerStream struct is a grpc.ServerStream with a fixed context
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthenticationInterceptor(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	interceptor := handler.AuthenticationInterceptor()
+	claims := &model.AccessClaims{ProfileID: uuid.New(), SessionID: uuid.New(), Roles: []string{model.RoleUser}}
+	mockProfileService.On("ValidateToken", mock.Anything, "access").Return(claims, nil).Once()
+	mockProfileService.On("ValidateToken", mock.Anything, "expired").Return(nil, fmt.Errorf("ValidateAccessToken: %w", model.ErrInvalidToken)).Once()
+
+	var principal *authz.Principal
+	next := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		principal, _ = authz.PrincipalFromContext(ctx)
+		return nil, nil
+	}
+	call := func(ctx context.Context, method string) error {
+		principal = nil
+		_, err := interceptor(ctx, &proto.GetProfileByIDRequest{}, &grpc.UnaryServerInfo{FullMethod: method}, next)
+		return err
+	}
+
+	require.NoError(t, call(withBearer("access"), "/Profiles/GetProfileByID"))
+	require.Equal(t, &authz.Principal{ProfileID: claims.ProfileID, SessionID: claims.SessionID, Roles: claims.Roles}, principal)
+
+	// public RPCs are called anonymously, a token passed to them is not even validated
+	require.NoError(t, call(context.Background(), "/Profiles/Login"))
+	require.NoError(t, call(withBearer("ignored"), "/Profiles/CreateNewProfile"))
+	require.Nil(t, principal)
+
+	requireStatus(t, call(context.Background(), "/Profiles/GetProfileByID"), codes.Unauthenticated, "INVALID_TOKEN")
+	requireStatus(t, call(withBearer("expired"), "/Profiles/DeleteProfileByID"), codes.Unauthenticated, "INVALID_TOKEN")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestStreamAuthenticationInterceptor(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	interceptor := handler.StreamAuthenticationInterceptor()
+	claims := &model.AccessClaims{ProfileID: uuid.New(), SessionID: uuid.New()}
+	mockProfileService.On("ValidateToken", mock.Anything, "access").Return(claims, nil).Once()
+
+	var principal *authz.Principal
+	next := func(_ interface{}, ss grpc.ServerStream) error {
+		principal, _ = authz.PrincipalFromContext(ss.Context())
+		return nil
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/Profiles/Watch", IsServerStream: true}
+
+	err := interceptor(nil, &testServerStream{ctx: withBearer("access")}, info, next)
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+	require.Equal(t, claims.ProfileID, principal.ProfileID)
+
+	err = interceptor(nil, &testServerStream{ctx: context.Background()}, info, next)
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_TOKEN")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+// authorizationRules declares who may call every RPC of the Profiles service, an RPC missing here is denied
+var authorizationRules = map[string]authz.Rule{
+	"/Profiles/Login":                     {Public: true},
+	"/Profiles/CreateNewProfile":          {Public: true},
+	"/Profiles/RefreshTokens":             {Public: true},
+	"/Profiles/ValidateToken":             {Public: true},
+	"/Profiles/RequestPasswordReset":      {Public: true},
+	"/Profiles/ConfirmPasswordReset":      {Public: true},
+	"/Profiles/VerifyEmail":               {Public: true},
+	"/Profiles/CompleteMFA":               {Public: true},
+	"/Profiles/BeginPasskeyLogin":         {Public: true},
+	"/Profiles/FinishPasskeyLogin":        {Public: true},
+	"/grpc.health.v1.Health/Check":        {Public: true},
+	"/grpc.health.v1.Health/Watch":        {Public: true},
+	"/Profiles/GetProfileByID":            {Self: authz.ProfileReadSelf, Any: authz.ProfileReadAny},
+	"/Profiles/UpdateProfile":             {Self: authz.ProfileUpdateSelf, Any: authz.ProfileUpdateAny},
+	"/Profiles/DeleteProfileByID":         {Self: authz.ProfileDeleteSelf, Any: authz.ProfileDeleteAny},
+	"/Profiles/UnlockProfile":             {Any: authz.ProfileUnlockAny},
+	"/Profiles/ChangePassword":            {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/SendVerification":          {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/EnrollTOTP":                {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/ConfirmTOTP":               {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/DisableTOTP":               {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/BeginPasskeyRegistration":  {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/FinishPasskeyRegistration": {Self: authz.CredentialsManageSelf, Any: authz.CredentialsManageAny},
+	"/Profiles/ListSessions":              {Self: authz.SessionManageSelf, Any: authz.SessionManageAny},
+	"/Profiles/RevokeSession":             {Self: authz.SessionManageSelf, Any: authz.SessionManageAny},
+	"/Profiles/RevokeAllSessions":         {Self: authz.SessionManageSelf, Any: authz.SessionManageAny},
+	"/Profiles/ListRoles":                 {Self: authz.RoleReadSelf, Any: authz.RoleReadAny},
+	"/Profiles/AssignRole":                {Any: authz.RoleAssignAny},
+	"/Profiles/RevokeRole":                {Any: authz.RoleAssignAny},
+
+	// server reflection is only registered when SERVER_REFLECTION is enabled
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      {Public: true},
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": {Public: true},
+}
+
+// AuthorizationInterceptor function checks that roles of the caller grant the permission required by the called RPC
+// before the handler runs, a caller without the any permission may only act on its own profile.
+// It relies on the principal put into the context by AuthenticationInterceptor, a service calling without
+// an access token is authorized by its allow-list in ServiceAuthenticator
+func AuthorizationInterceptor(authorizer *authz.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		rule, ok := authorizationRules[info.FullMethod]
+		if !ok {
+			logging.FromContext(ctx).Error("no authorization rule")
+			return nil, errorToStatus(model.ErrPermissionDenied)
+		}
+		if rule.Public {
+			return handler(ctx, req)
+		}
+		principal, ok := authz.PrincipalFromContext(ctx)
+		if !ok {
+			if _, ok := authz.ServiceFromContext(ctx); ok {
+				// the service was allowed to call the RPC by ServiceAuthenticator
+				return handler(ctx, req)
+			}
+			return nil, errorToStatus(model.ErrInvalidToken)
+		}
+		err := authorizer.Authorize(ctx, principal.Roles, rule, targetsCaller(req, principal.ProfileID))
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Authorize: %v", err)
+			return nil, errorToStatus(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthorizationInterceptor function is AuthorizationInterceptor of streaming RPCs, a target of a stream
+// is not known when it opens, so only the any permission of the rule is accepted
+func StreamAuthorizationInterceptor(authorizer *authz.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		rule, ok := authorizationRules[info.FullMethod]
+		if !ok {
+			logging.FromContext(ss.Context()).Error("no authorization rule")
+			return errorToStatus(model.ErrPermissionDenied)
+		}
+		if rule.Public {
+			return handler(srv, ss)
+		}
+		principal, ok := authz.PrincipalFromContext(ss.Context())
+		if !ok {
+			if _, ok := authz.ServiceFromContext(ss.Context()); ok {
+				return handler(srv, ss)
+			}
+			return errorToStatus(model.ErrInvalidToken)
+		}
+		err := authorizer.Authorize(ss.Context(), principal.Roles, rule, false)
+		if err != nil {
+			logging.FromContext(ss.Context()).Errorf("Authorize: %v", err)
+			return errorToStatus(err)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// targetsCaller function reports whether the request names the caller's own profile in its ProfileID or ID field
+func targetsCaller(req interface{}, callerID uuid.UUID) bool {
+	var target string
+	switch r := req.(type) {
+	case interface{ GetProfileID() string }:
+		target = r.GetProfileID()
+	case interface{ GetID() string }:
+		target = r.GetID()
+	default:
+		return false
+	}
+	id, err := uuid.Parse(target)
+	return err == nil && id == callerID
+}
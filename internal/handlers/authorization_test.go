@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// testRoles struct serves permissions of the default roles to the authorizer
+type testRoles struct{}
+
+func (testRoles) RolePermissions(context.Context) (map[string][]string, error) {
+	return map[string][]string{
+		model.RoleUser:  {authz.ProfileDeleteSelf, authz.SessionManageSelf},
+		model.RoleAdmin: {authz.ProfileDeleteAny, authz.SessionManageAny},
+	}, nil
+}
+
+func TestAuthorizationInterceptor(t *testing.T) {
+	interceptor := AuthorizationInterceptor(authz.NewAuthorizer(testRoles{}, time.Minute))
+	callerID := uuid.New()
+	user := withPrincipal(callerID, uuid.New(), model.RoleUser)
+	admin := withPrincipal(uuid.New(), uuid.New(), model.RoleAdmin)
+	called := 0
+	next := func(context.Context, interface{}) (interface{}, error) {
+		called++
+		return nil, nil
+	}
+	call := func(ctx context.Context, method string, req interface{}) error {
+		_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, next)
+		return err
+	}
+
+	// public RPCs need no principal
+	require.NoError(t, call(context.Background(), "/Profiles/Login", &proto.LoginRequest{}))
+
+	own := &proto.DeleteProfileByIDRequest{ID: callerID.String()}
+	other := &proto.DeleteProfileByIDRequest{ID: uuid.New().String()}
+	requireStatus(t, call(context.Background(), "/Profiles/DeleteProfileByID", own), codes.Unauthenticated, "INVALID_TOKEN")
+	require.NoError(t, call(user, "/Profiles/DeleteProfileByID", own))
+	requireStatus(t, call(user, "/Profiles/DeleteProfileByID", other), codes.PermissionDenied, "PERMISSION_DENIED")
+	require.NoError(t, call(admin, "/Profiles/DeleteProfileByID", other))
+
+	// a session without an owner can be revoked only by callers managing any session
+	requireStatus(t, call(user, "/Profiles/RevokeSession", &proto.RevokeSessionRequest{SessionID: uuid.New().String()}),
+		codes.PermissionDenied, "PERMISSION_DENIED")
+	require.NoError(t, call(user, "/Profiles/RevokeSession", &proto.RevokeSessionRequest{SessionID: uuid.New().String(), ProfileID: callerID.String()}))
+	require.NoError(t, call(admin, "/Profiles/RevokeSession", &proto.RevokeSessionRequest{SessionID: uuid.New().String()}))
+
+	// roles without a matching permission and RPCs without a rule are denied
+	requireStatus(t, call(admin, "/Profiles/UnlockProfile", &proto.UnlockProfileRequest{ID: callerID.String()}), codes.PermissionDenied, "PERMISSION_DENIED")
+	requireStatus(t, call(admin, "/Profiles/Unknown", &proto.LoginRequest{}), codes.PermissionDenied, "PERMISSION_DENIED")
+	require.Equal(t, 5, called)
+}
+
+func TestAuthorizationRulesCoverEveryRPC(t *testing.T) {
+	for _, method := range proto.Profiles_ServiceDesc.Methods {
+		_, ok := authorizationRules["/Profiles/"+method.MethodName]
+		require.True(t, ok, method.MethodName)
+	}
+}
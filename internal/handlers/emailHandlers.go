@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/logging"
+	proto "github.com/eugenshima/profile/proto"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// SendVerification function sends a verification code to the unverified email of the profile
+func (ph *ProfileHandler) SendVerification(ctx context.Context, req *proto.SendVerificationRequest) (*proto.SendVerificationResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	err = ph.srv.SendVerification(ctx, profileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("SendVerification: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.SendVerificationResponse{}, nil
+}
+
+// VerifyEmail function marks an email as verified by the code sent to it
+func (ph *ProfileHandler) VerifyEmail(ctx context.Context, req *proto.VerifyEmailRequest) (*proto.VerifyEmailResponse, error) {
+	if req.Code == "" {
+		return nil, invalidField("Code", "must not be empty")
+	}
+	profile, err := ph.srv.VerifyEmail(ctx, req.Code)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("VerifyEmail: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.VerifyEmailResponse{Profile: profileToProto(profile)}, nil
+}
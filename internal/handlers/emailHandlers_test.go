@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandlerSendVerificationPrecondition(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("SendVerification", mock.Anything, ID).
+		Return(fmt.Errorf("SendVerification: %w", &model.PreconditionError{Subject: "Email", Description: "profile has no email"})).Once()
+
+	_, err := handler.SendVerification(context.Background(), &proto.SendVerificationRequest{ProfileID: ID.String()})
+	requireStatus(t, err, codes.FailedPrecondition, "FAILED_PRECONDITION")
+	st, _ := status.FromError(err)
+	var failure *errdetails.PreconditionFailure
+	for _, detail := range st.Details() {
+		if f, ok := detail.(*errdetails.PreconditionFailure); ok {
+			failure = f
+		}
+	}
+	require.NotNil(t, failure)
+	require.Equal(t, "Email", failure.Violations[0].Subject)
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
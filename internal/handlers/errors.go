@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/eugenshima/profile/internal/model"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is a domain of ErrorInfo details attached to returned statuses
+const errorDomain = "profile"
+
+// errorToStatus function translates a domain error into a gRPC status error with structured details
+func errorToStatus(err error) error {
+	var validationErr *model.ValidationError
+	var lockedErr *model.LockedError
+	var preconditionErr *model.PreconditionError
+	var resourceErr *model.ResourceError
+	switch {
+	case errors.As(err, &validationErr):
+		badRequest := &errdetails.BadRequest{}
+		for _, v := range validationErr.Violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		return withDetails(codes.InvalidArgument, validationErr.Error(), "INVALID_ARGUMENT", badRequest)
+	case errors.Is(err, model.ErrInvalidArgument):
+		return withDetails(codes.InvalidArgument, "invalid argument", "INVALID_ARGUMENT")
+	case errors.As(err, &resourceErr) && errors.Is(resourceErr, model.ErrNotFound):
+		return withDetails(codes.NotFound, resourceErr.Error(), "NOT_FOUND", &errdetails.ResourceInfo{ResourceType: resourceErr.Resource})
+	case errors.As(err, &resourceErr) && errors.Is(resourceErr, model.ErrAlreadyExists):
+		return withDetails(codes.AlreadyExists, resourceErr.Error(), "ALREADY_EXISTS", &errdetails.ResourceInfo{ResourceType: resourceErr.Resource})
+	case errors.Is(err, model.ErrNotFound):
+		return withDetails(codes.NotFound, "not found", "NOT_FOUND")
+	case errors.Is(err, model.ErrAlreadyExists):
+		return withDetails(codes.AlreadyExists, "already exists", "ALREADY_EXISTS")
+	case errors.Is(err, model.ErrInvalidCredentials):
+		return withDetails(codes.Unauthenticated, "invalid login or password", "INVALID_CREDENTIALS")
+	case errors.Is(err, model.ErrInvalidToken):
+		return withDetails(codes.Unauthenticated, "invalid or expired token", "INVALID_TOKEN")
+	case errors.Is(err, model.ErrPermissionDenied):
+		return withDetails(codes.PermissionDenied, "permission denied", "PERMISSION_DENIED")
+	case errors.As(err, &preconditionErr):
+		return withDetails(codes.FailedPrecondition, preconditionErr.Error(), "FAILED_PRECONDITION", &errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "STATE",
+				Subject:     preconditionErr.Subject,
+				Description: preconditionErr.Description,
+			}},
+		})
+	case errors.Is(err, model.ErrVersionMismatch):
+		return withDetails(codes.Aborted, "profile was modified concurrently, reload it and retry", "ETAG_MISMATCH")
+	case errors.As(err, &lockedErr):
+		return withDetails(codes.ResourceExhausted, "too many failed login attempts", "LOGIN_LOCKED",
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(lockedErr.RetryAfter)})
+	default:
+		return withDetails(codes.Internal, "internal error", "INTERNAL")
+	}
+}
+
+// invalidField function returns an InvalidArgument status for a single malformed request field
+func invalidField(field, description string) error {
+	return errorToStatus(model.NewValidationError(field, description))
+}
+
+// withDetails function builds a status error carrying ErrorInfo and any extra details
+func withDetails(code codes.Code, msg, reason string, details ...protoiface.MessageV1) error {
+	st := status.New(code, msg)
+	details = append([]protoiface.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}}, details...)
+	withInfo, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withInfo.Err()
+}
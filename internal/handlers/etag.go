@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// formatEtag function returns an etag of the profile version
+func formatEtag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseEtag function returns a profile version of the etag, an empty etag gives zero which skips the version check
+func parseEtag(etag string) (int64, error) {
+	if etag == "" {
+		return 0, nil
+	}
+	unquoted, err := strconv.Unquote(strings.TrimPrefix(etag, "W/"))
+	if err != nil {
+		return 0, fmt.Errorf("Unquote: %w", err)
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("malformed etag %q", etag)
+	}
+	return version, nil
+}
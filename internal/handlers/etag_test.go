@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseEtag(t *testing.T) {
+	version, err := parseEtag(formatEtag(42))
+	require.NoError(t, err)
+	require.Equal(t, int64(42), version)
+
+	version, err = parseEtag(`W/"7"`)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), version)
+
+	version, err = parseEtag("")
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	for _, malformed := range []string{"42", `"abc"`, `"0"`} {
+		_, err = parseEtag(malformed)
+		require.Error(t, err, malformed)
+	}
+}
+
+func TestHandlerDeleteProfileEtagMismatch(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("DeleteProfileByID", mock.Anything, ID, int64(3)).Return(fmt.Errorf("exec: %w", model.ErrVersionMismatch)).Once()
+
+	_, err := handler.DeleteProfileByID(context.Background(), &proto.DeleteProfileByIDRequest{ID: ID.String(), Etag: formatEtag(3)})
+	requireStatus(t, err, codes.Aborted, "ETAG_MISMATCH")
+
+	_, err = handler.DeleteProfileByID(context.Background(), &proto.DeleteProfileByIDRequest{ID: ID.String(), Etag: "3"})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
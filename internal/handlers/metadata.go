@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// authorizationHeader is a metadata key of the bearer access token
+const authorizationHeader = "authorization"
+
+// clientInfo function returns user agent and IP address of the caller
+func clientInfo(ctx context.Context) (userAgent, clientIP string) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		clientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+	}
+	return userAgent, clientIP
+}
+
+// bearerToken function returns an access token from the authorization metadata, or an empty string
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get(authorizationHeader) {
+		scheme, credentials, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, "bearer") {
+			return strings.TrimSpace(credentials)
+		}
+	}
+	return ""
+}
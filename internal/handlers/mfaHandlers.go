@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// EnrollTOTP function starts enrollment of a TOTP authenticator of the profile
+func (ph *ProfileHandler) EnrollTOTP(ctx context.Context, req *proto.EnrollTOTPRequest) (*proto.EnrollTOTPResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	enrollment, err := ph.srv.EnrollTOTP(ctx, profileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("EnrollTOTP: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.EnrollTOTPResponse{Secret: enrollment.Secret, URI: enrollment.URI}, nil
+}
+
+// ConfirmTOTP function enables two-factor authentication by a code of the enrolled authenticator
+func (ph *ProfileHandler) ConfirmTOTP(ctx context.Context, req *proto.ConfirmTOTPRequest) (*proto.ConfirmTOTPResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	if req.Code == "" {
+		return nil, invalidField("Code", "must not be empty")
+	}
+	codes, err := ph.srv.ConfirmTOTP(ctx, profileID, req.Code)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("ConfirmTOTP: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.ConfirmTOTPResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP function removes the authenticator and recovery codes of the profile
+func (ph *ProfileHandler) DisableTOTP(ctx context.Context, req *proto.DisableTOTPRequest) (*proto.DisableTOTPResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	_, clientIP := clientInfo(ctx)
+	err = ph.srv.DisableTOTP(ctx, profileID, req.Code, clientIP)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("DisableTOTP: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.DisableTOTPResponse{}, nil
+}
+
+// CompleteMFA function exchanges a challenge returned by Login and a second factor code for a new pair of tokens
+func (ph *ProfileHandler) CompleteMFA(ctx context.Context, req *proto.CompleteMFARequest) (*proto.CompleteMFAResponse, error) {
+	if req.MFAChallenge == "" {
+		return nil, invalidField("MFAChallenge", "must not be empty")
+	}
+	if req.Code == "" {
+		return nil, invalidField("Code", "must not be empty")
+	}
+	userAgent, clientIP := clientInfo(ctx)
+	tokens, err := ph.srv.CompleteMFA(ctx, req.MFAChallenge, req.Code, &model.Auth{UserAgent: userAgent, ClientIP: clientIP})
+	if err != nil {
+		logging.FromContext(ctx).Errorf("CompleteMFA: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.CompleteMFAResponse{ID: tokens.ProfileID.String(), Tokens: tokensToProto(tokens)}, nil
+}
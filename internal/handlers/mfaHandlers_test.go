@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHandlerLoginReturnsMFAChallenge(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("Login", mock.Anything, mock.MatchedBy(func(auth *model.Auth) bool {
+		return auth.Login == "mfa_login"
+	})).Return(&model.Tokens{ProfileID: ID, MFAChallenge: "challenge", MFAChallengeExpiresAt: time.Now().Add(time.Minute)}, nil).Once()
+
+	resp, err := handler.Login(context.Background(), &proto.LoginRequest{Auth: &proto.Auth{Login: "mfa_login", Password: []byte("password")}})
+	require.NoError(t, err)
+	require.Equal(t, "challenge", resp.MFAChallenge)
+	require.Nil(t, resp.Tokens)
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerCompleteMFA(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("CompleteMFA", mock.Anything, "challenge", "123456", mock.Anything).
+		Return(&model.Tokens{ProfileID: ID, AccessToken: "access"}, nil).Once()
+
+	resp, err := handler.CompleteMFA(context.Background(), &proto.CompleteMFARequest{MFAChallenge: "challenge", Code: "123456"})
+	require.NoError(t, err)
+	require.Equal(t, ID.String(), resp.ID)
+	require.Equal(t, "access", resp.Tokens.AccessToken)
+
+	_, err = handler.CompleteMFA(context.Background(), &proto.CompleteMFARequest{MFAChallenge: "challenge"})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	mockProfileService.On("CompleteMFA", mock.Anything, "challenge", "654321", mock.Anything).
+		Return(nil, fmt.Errorf("Verify: %w", model.ErrInvalidCredentials)).Once()
+	_, err = handler.CompleteMFA(context.Background(), &proto.CompleteMFARequest{MFAChallenge: "challenge", Code: "654321"})
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_CREDENTIALS")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerEnrollTOTPAlreadyEnabled(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("EnrollTOTP", mock.Anything, ID).
+		Return(nil, fmt.Errorf("SaveTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "two-factor authentication is already enabled"})).Once()
+
+	_, err := handler.EnrollTOTP(context.Background(), &proto.EnrollTOTPRequest{ProfileID: ID.String()})
+	requireStatus(t, err, codes.FailedPrecondition, "FAILED_PRECONDITION")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
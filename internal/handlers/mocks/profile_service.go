@@ -17,6 +17,147 @@ type ProfileService struct {
 	mock.Mock
 }
 
+// AssignRole provides a mock function with given fields: ctx, profileID, role
+func (_m *ProfileService) AssignRole(ctx context.Context, profileID uuid.UUID, role string) error {
+	ret := _m.Called(ctx, profileID, role)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string) error); ok {
+		r0 = rf(ctx, profileID, role)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BeginPasskeyLogin provides a mock function with given fields: ctx
+func (_m *ProfileService) BeginPasskeyLogin(ctx context.Context) ([]byte, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context) []byte); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BeginPasskeyRegistration provides a mock function with given fields: ctx, id
+func (_m *ProfileService) BeginPasskeyRegistration(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) []byte); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ChangePassword provides a mock function with given fields: ctx, change
+func (_m *ProfileService) ChangePassword(ctx context.Context, change *model.PasswordChange) (int64, error) {
+	ret := _m.Called(ctx, change)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, *model.PasswordChange) int64); ok {
+		r0 = rf(ctx, change)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.PasswordChange) error); ok {
+		r1 = rf(ctx, change)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompleteMFA provides a mock function with given fields: ctx, challenge, code, auth
+func (_m *ProfileService) CompleteMFA(ctx context.Context, challenge string, code string, auth *model.Auth) (*model.Tokens, error) {
+	ret := _m.Called(ctx, challenge, code, auth)
+
+	var r0 *model.Tokens
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *model.Auth) *model.Tokens); ok {
+		r0 = rf(ctx, challenge, code, auth)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Tokens)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *model.Auth) error); ok {
+		r1 = rf(ctx, challenge, code, auth)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConfirmPasswordReset provides a mock function with given fields: ctx, resetToken, newPassword
+func (_m *ProfileService) ConfirmPasswordReset(ctx context.Context, resetToken string, newPassword []byte) error {
+	ret := _m.Called(ctx, resetToken, newPassword)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) error); ok {
+		r0 = rf(ctx, resetToken, newPassword)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ConfirmTOTP provides a mock function with given fields: ctx, id, code
+func (_m *ProfileService) ConfirmTOTP(ctx context.Context, id uuid.UUID, code string) ([]string, error) {
+	ret := _m.Called(ctx, id, code)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string) []string); ok {
+		r0 = rf(ctx, id, code)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, string) error); ok {
+		r1 = rf(ctx, id, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateNewProfile provides a mock function with given fields: ctx, profile
 func (_m *ProfileService) CreateNewProfile(ctx context.Context, profile *model.Profile) error {
 	ret := _m.Called(ctx, profile)
@@ -31,6 +172,103 @@ func (_m *ProfileService) CreateNewProfile(ctx context.Context, profile *model.P
 	return r0
 }
 
+// DeleteProfileByID provides a mock function with given fields: ctx, id, version
+func (_m *ProfileService) DeleteProfileByID(ctx context.Context, id uuid.UUID, version int64) error {
+	ret := _m.Called(ctx, id, version)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int64) error); ok {
+		r0 = rf(ctx, id, version)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DisableTOTP provides a mock function with given fields: ctx, id, code, clientIP
+func (_m *ProfileService) DisableTOTP(ctx context.Context, id uuid.UUID, code string, clientIP string) error {
+	ret := _m.Called(ctx, id, code, clientIP)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string, string) error); ok {
+		r0 = rf(ctx, id, code, clientIP)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnrollTOTP provides a mock function with given fields: ctx, id
+func (_m *ProfileService) EnrollTOTP(ctx context.Context, id uuid.UUID) (*model.TOTPEnrollment, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.TOTPEnrollment
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *model.TOTPEnrollment); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TOTPEnrollment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FinishPasskeyLogin provides a mock function with given fields: ctx, assertion
+func (_m *ProfileService) FinishPasskeyLogin(ctx context.Context, assertion *model.PasskeyAssertion) (*model.Tokens, error) {
+	ret := _m.Called(ctx, assertion)
+
+	var r0 *model.Tokens
+	if rf, ok := ret.Get(0).(func(context.Context, *model.PasskeyAssertion) *model.Tokens); ok {
+		r0 = rf(ctx, assertion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Tokens)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.PasskeyAssertion) error); ok {
+		r1 = rf(ctx, assertion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FinishPasskeyRegistration provides a mock function with given fields: ctx, id, clientDataJSON, attestationObject
+func (_m *ProfileService) FinishPasskeyRegistration(ctx context.Context, id uuid.UUID, clientDataJSON []byte, attestationObject []byte) (*model.Passkey, error) {
+	ret := _m.Called(ctx, id, clientDataJSON, attestationObject)
+
+	var r0 *model.Passkey
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, []byte, []byte) *model.Passkey); ok {
+		r0 = rf(ctx, id, clientDataJSON, attestationObject)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Passkey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, []byte, []byte) error); ok {
+		r1 = rf(ctx, id, clientDataJSON, attestationObject)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetProfileByID provides a mock function with given fields: ctx, id
 func (_m *ProfileService) GetProfileByID(ctx context.Context, id uuid.UUID) (*model.Profile, error) {
 	ret := _m.Called(ctx, id)
@@ -54,16 +292,62 @@ func (_m *ProfileService) GetProfileByID(ctx context.Context, id uuid.UUID) (*mo
 	return r0, r1
 }
 
+// ListRoles provides a mock function with given fields: ctx, profileID
+func (_m *ProfileService) ListRoles(ctx context.Context, profileID uuid.UUID) ([]*model.Role, error) {
+	ret := _m.Called(ctx, profileID)
+
+	var r0 []*model.Role
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) []*model.Role); ok {
+		r0 = rf(ctx, profileID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Role)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, profileID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: ctx, profileID
+func (_m *ProfileService) ListSessions(ctx context.Context, profileID uuid.UUID) ([]*model.Session, error) {
+	ret := _m.Called(ctx, profileID)
+
+	var r0 []*model.Session
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) []*model.Session); ok {
+		r0 = rf(ctx, profileID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, profileID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Login provides a mock function with given fields: ctx, loginPass
-func (_m *ProfileService) Login(ctx context.Context, loginPass *model.Auth) (uuid.UUID, error) {
+func (_m *ProfileService) Login(ctx context.Context, loginPass *model.Auth) (*model.Tokens, error) {
 	ret := _m.Called(ctx, loginPass)
 
-	var r0 uuid.UUID
-	if rf, ok := ret.Get(0).(func(context.Context, *model.Auth) uuid.UUID); ok {
+	var r0 *model.Tokens
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Auth) *model.Tokens); ok {
 		r0 = rf(ctx, loginPass)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(uuid.UUID)
+			r0 = ret.Get(0).(*model.Tokens)
 		}
 	}
 
@@ -77,13 +361,76 @@ func (_m *ProfileService) Login(ctx context.Context, loginPass *model.Auth) (uui
 	return r0, r1
 }
 
-// UpdateProfile provides a mock function with given fields: ctx, profile
-func (_m *ProfileService) UpdateProfile(ctx context.Context, profile *model.Profile) error {
-	ret := _m.Called(ctx, profile)
+// RefreshTokens provides a mock function with given fields: ctx, refreshToken
+func (_m *ProfileService) RefreshTokens(ctx context.Context, refreshToken string) (*model.Tokens, error) {
+	ret := _m.Called(ctx, refreshToken)
+
+	var r0 *model.Tokens
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Tokens); ok {
+		r0 = rf(ctx, refreshToken)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Tokens)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, refreshToken)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestPasswordReset provides a mock function with given fields: ctx, login
+func (_m *ProfileService) RequestPasswordReset(ctx context.Context, login string) {
+	_m.Called(ctx, login)
+}
+
+// RevokeAllSessions provides a mock function with given fields: ctx, profileID, exceptID
+func (_m *ProfileService) RevokeAllSessions(ctx context.Context, profileID uuid.UUID, exceptID uuid.UUID) (int64, error) {
+	ret := _m.Called(ctx, profileID, exceptID)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, uuid.UUID) int64); ok {
+		r0 = rf(ctx, profileID, exceptID)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, uuid.UUID) error); ok {
+		r1 = rf(ctx, profileID, exceptID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeRole provides a mock function with given fields: ctx, profileID, role
+func (_m *ProfileService) RevokeRole(ctx context.Context, profileID uuid.UUID, role string) error {
+	ret := _m.Called(ctx, profileID, role)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.Profile) error); ok {
-		r0 = rf(ctx, profile)
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, string) error); ok {
+		r0 = rf(ctx, profileID, role)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeSession provides a mock function with given fields: ctx, profileID, id
+func (_m *ProfileService) RevokeSession(ctx context.Context, profileID uuid.UUID, id uuid.UUID) error {
+	ret := _m.Called(ctx, profileID, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, uuid.UUID) error); ok {
+		r0 = rf(ctx, profileID, id)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -91,6 +438,103 @@ func (_m *ProfileService) UpdateProfile(ctx context.Context, profile *model.Prof
 	return r0
 }
 
+// SendVerification provides a mock function with given fields: ctx, id
+func (_m *ProfileService) SendVerification(ctx context.Context, id uuid.UUID) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UnlockProfile provides a mock function with given fields: ctx, id
+func (_m *ProfileService) UnlockProfile(ctx context.Context, id uuid.UUID) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateProfile provides a mock function with given fields: ctx, update
+func (_m *ProfileService) UpdateProfile(ctx context.Context, update *model.ProfileUpdate) (*model.Profile, error) {
+	ret := _m.Called(ctx, update)
+
+	var r0 *model.Profile
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ProfileUpdate) *model.Profile); ok {
+		r0 = rf(ctx, update)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Profile)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.ProfileUpdate) error); ok {
+		r1 = rf(ctx, update)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ValidateToken provides a mock function with given fields: ctx, accessToken
+func (_m *ProfileService) ValidateToken(ctx context.Context, accessToken string) (*model.AccessClaims, error) {
+	ret := _m.Called(ctx, accessToken)
+
+	var r0 *model.AccessClaims
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.AccessClaims); ok {
+		r0 = rf(ctx, accessToken)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AccessClaims)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, accessToken)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyEmail provides a mock function with given fields: ctx, code
+func (_m *ProfileService) VerifyEmail(ctx context.Context, code string) (*model.Profile, error) {
+	ret := _m.Called(ctx, code)
+
+	var r0 *model.Profile
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Profile); ok {
+		r0 = rf(ctx, code)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Profile)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewProfileService interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// BeginPasskeyRegistration function returns options for creating a new passkey of the profile
+func (ph *ProfileHandler) BeginPasskeyRegistration(ctx context.Context, req *proto.BeginPasskeyRegistrationRequest) (*proto.BeginPasskeyRegistrationResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	options, err := ph.srv.BeginPasskeyRegistration(ctx, profileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("BeginPasskeyRegistration: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.BeginPasskeyRegistrationResponse{Options: options}, nil
+}
+
+// FinishPasskeyRegistration function verifies and stores a new passkey of the profile
+func (ph *ProfileHandler) FinishPasskeyRegistration(ctx context.Context, req *proto.FinishPasskeyRegistrationRequest) (*proto.FinishPasskeyRegistrationResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	if len(req.ClientDataJSON) == 0 || len(req.AttestationObject) == 0 {
+		return nil, invalidField("AttestationObject", "must be set together with ClientDataJSON")
+	}
+	passkey, err := ph.srv.FinishPasskeyRegistration(ctx, profileID, req.ClientDataJSON, req.AttestationObject)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("FinishPasskeyRegistration: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.FinishPasskeyRegistrationResponse{CredentialID: passkey.CredentialID}, nil
+}
+
+// BeginPasskeyLogin function returns options for signing in with a passkey
+func (ph *ProfileHandler) BeginPasskeyLogin(ctx context.Context, _ *proto.BeginPasskeyLoginRequest) (*proto.BeginPasskeyLoginResponse, error) {
+	options, err := ph.srv.BeginPasskeyLogin(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("BeginPasskeyLogin: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.BeginPasskeyLoginResponse{Options: options}, nil
+}
+
+// FinishPasskeyLogin function verifies a passkey assertion and issues a new pair of tokens
+func (ph *ProfileHandler) FinishPasskeyLogin(ctx context.Context, req *proto.FinishPasskeyLoginRequest) (*proto.FinishPasskeyLoginResponse, error) {
+	if len(req.CredentialID) == 0 {
+		return nil, invalidField("CredentialID", "must not be empty")
+	}
+	userAgent, clientIP := clientInfo(ctx)
+	tokens, err := ph.srv.FinishPasskeyLogin(ctx, &model.PasskeyAssertion{
+		CredentialID:      req.CredentialID,
+		ClientDataJSON:    req.ClientDataJSON,
+		AuthenticatorData: req.AuthenticatorData,
+		Signature:         req.Signature,
+		UserHandle:        req.UserHandle,
+		Device:            req.Device,
+		UserAgent:         userAgent,
+		ClientIP:          clientIP,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Errorf("FinishPasskeyLogin: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.FinishPasskeyLoginResponse{ID: tokens.ProfileID.String(), Tokens: tokensToProto(tokens)}, nil
+}
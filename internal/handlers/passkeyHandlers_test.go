@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHandlerFinishPasskeyLogin(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("FinishPasskeyLogin", mock.Anything, mock.MatchedBy(func(assertion *model.PasskeyAssertion) bool {
+		return string(assertion.CredentialID) == "credential" && assertion.Device == "laptop"
+	})).Return(&model.Tokens{ProfileID: ID, AccessToken: "access"}, nil).Once()
+
+	resp, err := handler.FinishPasskeyLogin(context.Background(), &proto.FinishPasskeyLoginRequest{
+		CredentialID: []byte("credential"), ClientDataJSON: []byte("{}"), Device: "laptop",
+	})
+	require.NoError(t, err)
+	require.Equal(t, ID.String(), resp.ID)
+	require.Equal(t, "access", resp.Tokens.AccessToken)
+
+	mockProfileService.On("FinishPasskeyLogin", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("VerifyAssertion: %w", model.ErrInvalidCredentials)).Once()
+	_, err = handler.FinishPasskeyLogin(context.Background(), &proto.FinishPasskeyLoginRequest{CredentialID: []byte("credential")})
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_CREDENTIALS")
+
+	_, err = handler.FinishPasskeyLogin(context.Background(), &proto.FinishPasskeyLoginRequest{})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerBeginPasskeyRegistration(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	mockProfileService.On("BeginPasskeyRegistration", mock.Anything, ID).Return([]byte(`{"challenge":"abc"}`), nil).Once()
+
+	resp, err := handler.BeginPasskeyRegistration(context.Background(), &proto.BeginPasskeyRegistrationRequest{ProfileID: ID.String()})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"challenge":"abc"}`, string(resp.Options))
+
+	_, err = handler.BeginPasskeyRegistration(context.Background(), &proto.BeginPasskeyRegistrationRequest{ProfileID: "invalid"})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangePassword function replaces the password of the profile after verifying the current one
+func (ph *ProfileHandler) ChangePassword(ctx context.Context, req *proto.ChangePasswordRequest) (*proto.ChangePasswordResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	_, clientIP := clientInfo(ctx)
+	change := &model.PasswordChange{
+		ProfileID:       profileID,
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+		ClientIP:        clientIP,
+	}
+	if req.KeepCurrentSession {
+		change.KeepSessionID = currentSessionID(ctx)
+		if change.KeepSessionID == uuid.Nil {
+			return nil, errorToStatus(model.ErrInvalidToken)
+		}
+	}
+	revoked, err := ph.srv.ChangePassword(ctx, change)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("ChangePassword: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.ChangePasswordResponse{RevokedSessions: revoked}, nil
+}
+
+// RequestPasswordReset function sends a password reset token to the owner of the login, if there is one
+func (ph *ProfileHandler) RequestPasswordReset(ctx context.Context, req *proto.RequestPasswordResetRequest) (*proto.RequestPasswordResetResponse, error) {
+	if req.Login == "" {
+		return nil, invalidField("Login", "must not be empty")
+	}
+	ph.srv.RequestPasswordReset(ctx, req.Login)
+	return &proto.RequestPasswordResetResponse{}, nil
+}
+
+// ConfirmPasswordReset function sets a new password using a reset token
+func (ph *ProfileHandler) ConfirmPasswordReset(ctx context.Context, req *proto.ConfirmPasswordResetRequest) (*proto.ConfirmPasswordResetResponse, error) {
+	if req.Token == "" {
+		return nil, invalidField("Token", "must not be empty")
+	}
+	err := ph.srv.ConfirmPasswordReset(ctx, req.Token, req.NewPassword)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("ConfirmPasswordReset: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.ConfirmPasswordResetResponse{}, nil
+}
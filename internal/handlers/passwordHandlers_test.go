@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHandlerChangePasswordKeepsCurrentSession(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	profileID := uuid.New()
+	sessionID := uuid.New()
+	mockProfileService.On("ChangePassword", mock.Anything, mock.MatchedBy(func(change *model.PasswordChange) bool {
+		return change.ProfileID == profileID && change.KeepSessionID == sessionID && string(change.NewPassword) == "new-password"
+	})).Return(int64(1), nil).Once()
+
+	resp, err := handler.ChangePassword(withPrincipal(profileID, sessionID), &proto.ChangePasswordRequest{
+		ProfileID:          profileID.String(),
+		CurrentPassword:    []byte("current-password"),
+		NewPassword:        []byte("new-password"),
+		KeepCurrentSession: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), resp.RevokedSessions)
+
+	_, err = handler.ChangePassword(context.Background(), &proto.ChangePasswordRequest{ProfileID: profileID.String(), KeepCurrentSession: true})
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_TOKEN")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerConfirmPasswordResetInvalidToken(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("ConfirmPasswordReset", mock.Anything, "used-token", []byte("new-password")).
+		Return(fmt.Errorf("ResetPassword: %w", model.ErrInvalidToken)).Once()
+
+	_, err := handler.ConfirmPasswordReset(context.Background(), &proto.ConfirmPasswordResetRequest{Token: "used-token", NewPassword: []byte("new-password")})
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_TOKEN")
+
+	_, err = handler.ConfirmPasswordReset(context.Background(), &proto.ConfirmPasswordResetRequest{NewPassword: []byte("new-password")})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/eugenshima/profile/internal/logging"
 	"github.com/eugenshima/profile/internal/model"
 	proto "github.com/eugenshima/profile/proto"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 //go:generate /home/yauhenishymanski/work/bin/mockery --name=ProfileService --case=underscore --output=./mocks
@@ -28,91 +30,176 @@ func NewProfileHandler(srv ProfileService) *ProfileHandler {
 type ProfileService interface {
 	GetProfileByID(ctx context.Context, id uuid.UUID) (*model.Profile, error)
 	CreateNewProfile(ctx context.Context, profile *model.Profile) error
-	UpdateProfile(ctx context.Context, profile *model.UpdateTokens) error
-	Login(ctx context.Context, loginPass *model.Auth) (uuid.UUID, error)
-	DeleteProfileByID(ctx context.Context, id uuid.UUID) error
+	UpdateProfile(ctx context.Context, update *model.ProfileUpdate) (*model.Profile, error)
+	Login(ctx context.Context, loginPass *model.Auth) (*model.Tokens, error)
+	DeleteProfileByID(ctx context.Context, id uuid.UUID, version int64) error
+	RefreshTokens(ctx context.Context, refreshToken string) (*model.Tokens, error)
+	ValidateToken(ctx context.Context, accessToken string) (*model.AccessClaims, error)
+	ListSessions(ctx context.Context, profileID uuid.UUID) ([]*model.Session, error)
+	RevokeSession(ctx context.Context, profileID, id uuid.UUID) error
+	RevokeAllSessions(ctx context.Context, profileID, exceptID uuid.UUID) (int64, error)
+	UnlockProfile(ctx context.Context, id uuid.UUID) error
+	ChangePassword(ctx context.Context, change *model.PasswordChange) (int64, error)
+	RequestPasswordReset(ctx context.Context, login string)
+	ConfirmPasswordReset(ctx context.Context, resetToken string, newPassword []byte) error
+	SendVerification(ctx context.Context, id uuid.UUID) error
+	VerifyEmail(ctx context.Context, code string) (*model.Profile, error)
+	EnrollTOTP(ctx context.Context, id uuid.UUID) (*model.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, id uuid.UUID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, id uuid.UUID, code, clientIP string) error
+	CompleteMFA(ctx context.Context, challenge, code string, auth *model.Auth) (*model.Tokens, error)
+	BeginPasskeyRegistration(ctx context.Context, id uuid.UUID) ([]byte, error)
+	FinishPasskeyRegistration(ctx context.Context, id uuid.UUID, clientDataJSON, attestationObject []byte) (*model.Passkey, error)
+	BeginPasskeyLogin(ctx context.Context) ([]byte, error)
+	FinishPasskeyLogin(ctx context.Context, assertion *model.PasskeyAssertion) (*model.Tokens, error)
+	ListRoles(ctx context.Context, profileID uuid.UUID) ([]*model.Role, error)
+	AssignRole(ctx context.Context, profileID uuid.UUID, role string) error
+	RevokeRole(ctx context.Context, profileID uuid.UUID, role string) error
 }
 
 func (ph *ProfileHandler) Login(ctx context.Context, req *proto.LoginRequest) (*proto.LoginResponse, error) {
+	if req.Auth == nil {
+		return nil, invalidField("Auth", "must be set")
+	}
+	userAgent, clientIP := clientInfo(ctx)
 	infoToLogin := &model.Auth{
-		Login:    req.Auth.Login,
-		Password: req.Auth.Password,
+		Login:     req.Auth.Login,
+		Password:  req.Auth.Password,
+		Device:    req.Auth.Device,
+		UserAgent: userAgent,
+		ClientIP:  clientIP,
 	}
-	ID, err := ph.srv.Login(ctx, infoToLogin)
+	tokens, err := ph.srv.Login(ctx, infoToLogin)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"Password": infoToLogin.Password}).Errorf("Login: %v", err)
-		return nil, fmt.Errorf("Login: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"Login": infoToLogin.Login}).Errorf("Login: %v", err)
+		return nil, errorToStatus(err)
+	}
+	if tokens.MFAChallenge != "" {
+		return &proto.LoginResponse{
+			ID:                    tokens.ProfileID.String(),
+			MFAChallenge:          tokens.MFAChallenge,
+			MFAChallengeExpiresAt: timestamppb.New(tokens.MFAChallengeExpiresAt),
+		}, nil
 	}
-	return &proto.LoginResponse{ID: ID.String()}, nil
+	return &proto.LoginResponse{ID: tokens.ProfileID.String(), Tokens: tokensToProto(tokens)}, nil
 }
 
 // GetProfileByID function gets profile vy provided ID
 func (ph *ProfileHandler) GetProfileByID(ctx context.Context, req *proto.GetProfileByIDRequest) (*proto.GetProfileByIDResponse, error) {
 	ID, err := uuid.Parse(req.ID)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
-		return nil, fmt.Errorf("parse: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ID", "must be a valid UUID")
 	}
 	profile, err := ph.srv.GetProfileByID(ctx, ID)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"ctx": ctx, "ID": ID}).Errorf("GetProfileByID: %v", err)
-		return nil, fmt.Errorf("GetProfileByID: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": ID}).Errorf("GetProfileByID: %v", err)
+		return nil, errorToStatus(err)
 	}
-	protoProfile := &proto.Profile{
-		ID:           profile.ID.String(),
-		Login:        profile.Login,
-		Password:     profile.Password,
-		RefreshToken: profile.RefreshToken,
-		Username:     profile.Username,
+	return &proto.GetProfileByIDResponse{Profile: profileToProto(profile)}, nil
+}
+
+// profileToProto function builds a public view of the profile, credentials are left out on purpose
+func profileToProto(profile *model.Profile) *proto.Profile {
+	return &proto.Profile{
+		ID:            profile.ID.String(),
+		Login:         profile.Login,
+		Username:      profile.Username,
+		CreatedAt:     timestamppb.New(profile.CreatedAt),
+		UpdatedAt:     timestamppb.New(profile.UpdatedAt),
+		Etag:          formatEtag(profile.Version),
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerifiedAt != nil,
 	}
-	return &proto.GetProfileByIDResponse{Profile: protoProfile}, nil
 }
 
 // CreateNewProfile function creates a new profile
 func (ph *ProfileHandler) CreateNewProfile(ctx context.Context, req *proto.CreateNewProfileRequest) (*proto.CreateNewProfileResponse, error) {
+	if req.Profile == nil {
+		return nil, invalidField("Profile", "must be set")
+	}
 	newProfile := &model.Profile{
 		ID:       uuid.New(),
 		Login:    req.Profile.Login,
 		Password: req.Profile.Password,
 		Username: req.Profile.Username,
+		Email:    req.Profile.Email,
 	}
 	err := ph.srv.CreateNewProfile(ctx, newProfile)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"ctx": ctx, "newProfile": newProfile}).Errorf("CreateNewProfile: %v", err)
-		return nil, fmt.Errorf("CreateNewProfile: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"Login": newProfile.Login}).Errorf("CreateNewProfile: %v", err)
+		return nil, errorToStatus(err)
 	}
 	return &proto.CreateNewProfileResponse{}, nil
 }
 
-// UpdateProfile function updates a profile information
+// UpdateProfile function updates fields of the profile listed in the update mask and returns the updated profile
 func (ph *ProfileHandler) UpdateProfile(ctx context.Context, req *proto.UpdateProfileRequest) (*proto.UpdateProfileResponse, error) {
 	ID, err := uuid.Parse(req.ID)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
-		return nil, fmt.Errorf("parse: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ID", "must be a valid UUID")
+	}
+	if len(req.UpdateMask.GetPaths()) == 0 {
+		return nil, invalidField("UpdateMask", "must list at least one field")
+	}
+	if req.Profile == nil {
+		return nil, invalidField("Profile", "must be set")
+	}
+	version, err := parseEtag(req.Etag)
+	if err != nil {
+		return nil, invalidField("Etag", "must be an etag returned with the profile")
 	}
-	ProfileToUpdate := &model.UpdateTokens{
-		ID:           ID,
-		RefreshToken: req.RefreshToken,
+	update := &model.ProfileUpdate{ID: ID, Version: version}
+	for _, path := range req.UpdateMask.Paths {
+		switch path {
+		case "Login":
+			update.Login = &req.Profile.Login
+		case "Username":
+			update.Username = &req.Profile.Username
+		case "Email":
+			update.Email = &req.Profile.Email
+		default:
+			return nil, invalidField("UpdateMask", fmt.Sprintf("field %q cannot be updated", path))
+		}
 	}
-	err = ph.srv.UpdateProfile(ctx, ProfileToUpdate)
+	profile, err := ph.srv.UpdateProfile(ctx, update)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"newProfile": ProfileToUpdate}).Errorf("UpdateProfile: %v", err)
-		return nil, fmt.Errorf("UpdateProfile: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": ID, "UpdateMask": req.UpdateMask.Paths}).Errorf("UpdateProfile: %v", err)
+		return nil, errorToStatus(err)
 	}
-	return &proto.UpdateProfileResponse{}, nil
+	return &proto.UpdateProfileResponse{Profile: profileToProto(profile)}, nil
 }
 
 func (ph *ProfileHandler) DeleteProfileByID(ctx context.Context, req *proto.DeleteProfileByIDRequest) (*proto.DeleteProfileByIDResponse, error) {
 	ID, err := uuid.Parse(req.ID)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
-		return nil, fmt.Errorf("parse: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ID", "must be a valid UUID")
 	}
-	err = ph.srv.DeleteProfileByID(ctx, ID)
+	version, err := parseEtag(req.Etag)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"ID": ID}).Errorf("DeleteProfileByID: %v", err)
-		return nil, fmt.Errorf("DeleteProfileByID: %w", err)
+		return nil, invalidField("Etag", "must be an etag returned with the profile")
+	}
+	err = ph.srv.DeleteProfileByID(ctx, ID, version)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": ID}).Errorf("DeleteProfileByID: %v", err)
+		return nil, errorToStatus(err)
 	}
 	return &proto.DeleteProfileByIDResponse{}, nil
 }
+
+// UnlockProfile function removes a lock left by failed logins of the profile
+func (ph *ProfileHandler) UnlockProfile(ctx context.Context, req *proto.UnlockProfileRequest) (*proto.UnlockProfileResponse, error) {
+	ID, err := uuid.Parse(req.ID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": req.ID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ID", "must be a valid UUID")
+	}
+	err = ph.srv.UnlockProfile(ctx, ID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": ID}).Errorf("UnlockProfile: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.UnlockProfileResponse{}, nil
+}
@@ -1,15 +1,30 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eugenshima/profile/internal/handlers/mocks"
+	"github.com/eugenshima/profile/internal/logging"
 	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/password"
+	proto "github.com/eugenshima/profile/proto"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 var (
@@ -28,7 +43,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestHandlerLogin(t *testing.T) {
-	mockProfileService.On("Login", mock.Anything, mock.AnythingOfType("*model.Auth")).Return(uuid.UUID{}, nil).Once()
+	mockProfileService.On("Login", mock.Anything, mock.AnythingOfType("*model.Auth")).Return(&model.Tokens{}, nil).Once()
 
 	id, err := mockProfileService.Login(context.Background(), mockAuth)
 	require.NoError(t, err)
@@ -50,6 +65,220 @@ func TestGetProfileByID(t *testing.T) {
 	require.True(t, assertion)
 }
 
+func TestHandlerGetProfileByIDHidesSecrets(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	secretProfile := &model.Profile{
+		ID:        uuid.New(),
+		Login:     "test_login",
+		Password:  []byte("$2a$10$secret-password-hash"),
+		Username:  "test_username",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	mockProfileService.On("GetProfileByID", mock.Anything, secretProfile.ID).Return(secretProfile, nil).Once()
+
+	resp, err := handler.GetProfileByID(context.Background(), &proto.GetProfileByIDRequest{ID: secretProfile.ID.String()})
+	require.NoError(t, err)
+	require.Equal(t, secretProfile.ID.String(), resp.Profile.ID)
+	require.Equal(t, secretProfile.Login, resp.Profile.Login)
+	require.Equal(t, secretProfile.Username, resp.Profile.Username)
+
+	wire, err := protobuf.Marshal(resp)
+	require.NoError(t, err)
+	require.NotContains(t, string(wire), string(secretProfile.Password))
+	jsonView, err := protojson.Marshal(resp)
+	require.NoError(t, err)
+	require.NotContains(t, string(jsonView), string(secretProfile.Password))
+
+	fields := resp.Profile.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		name := strings.ToLower(string(fields.Get(i).Name()))
+		require.NotContains(t, name, "password")
+		require.NotContains(t, name, "token")
+	}
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
 func TestCreateNewProfile(t *testing.T) {
 	//TODO: :)
 }
+
+// requireStatus asserts that err is a gRPC status with given code and ErrorInfo reason
+func requireStatus(t *testing.T, err error, code codes.Code, reason string) *status.Status {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, code, st.Code())
+	require.NotEmpty(t, st.Details())
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, reason, info.Reason)
+	return st
+}
+
+func TestHandlerLoginInvalidCredentials(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("Login", mock.Anything, mock.AnythingOfType("*model.Auth")).Return(nil, fmt.Errorf("Verify: %w", model.ErrInvalidCredentials)).Once()
+
+	resp, err := handler.Login(context.Background(), &proto.LoginRequest{Auth: &proto.Auth{Login: "test_login", Password: []byte("wrong")}})
+	require.Nil(t, resp)
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_CREDENTIALS")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerGetProfileByInvalidID(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+
+	resp, err := handler.GetProfileByID(context.Background(), &proto.GetProfileByIDRequest{ID: "not-a-uuid"})
+	require.Nil(t, resp)
+	st := requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+	badRequest, ok := st.Details()[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Equal(t, "ID", badRequest.FieldViolations[0].Field)
+}
+
+func TestHandlerGetProfileByIDNotFound(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("GetProfileByID", mock.Anything, mock.AnythingOfType("uuid.UUID")).Return(nil, fmt.Errorf("QueryRow: %w", model.ErrNotFound)).Once()
+
+	resp, err := handler.GetProfileByID(context.Background(), &proto.GetProfileByIDRequest{ID: uuid.New().String()})
+	require.Nil(t, resp)
+	requireStatus(t, err, codes.NotFound, "NOT_FOUND")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerCreateNewProfileAlreadyExists(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("CreateNewProfile", mock.Anything, mock.AnythingOfType("*model.Profile")).Return(fmt.Errorf("exec: %w", model.ErrAlreadyExists)).Once()
+
+	resp, err := handler.CreateNewProfile(context.Background(), &proto.CreateNewProfileRequest{Profile: &proto.CreateProfile{Login: "test_login", Password: []byte("test_password")}})
+	require.Nil(t, resp)
+	requireStatus(t, err, codes.AlreadyExists, "ALREADY_EXISTS")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerCreateNewProfilePolicyViolation(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	policy := &password.Policy{MinLength: 12, RequireDigit: true}
+	mockProfileService.On("CreateNewProfile", mock.Anything, mock.AnythingOfType("*model.Profile")).Return(fmt.Errorf("Validate: %w", policy.Validate("short"))).Once()
+
+	resp, err := handler.CreateNewProfile(context.Background(), &proto.CreateNewProfileRequest{Profile: &proto.CreateProfile{Login: "test_login", Password: []byte("short")}})
+	require.Nil(t, resp)
+	st := requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+	badRequest, ok := st.Details()[1].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 2)
+	for _, violation := range badRequest.FieldViolations {
+		require.Equal(t, "Password", violation.Field)
+		require.NotContains(t, violation.Description, "short")
+	}
+	require.Equal(t, "must be at least 12 characters long", badRequest.FieldViolations[0].Description)
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerDeleteProfileInternalError(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("DeleteProfileByID", mock.Anything, mock.AnythingOfType("uuid.UUID"), int64(0)).Return(errors.New("connection refused")).Once()
+
+	resp, err := handler.DeleteProfileByID(context.Background(), &proto.DeleteProfileByIDRequest{ID: uuid.New().String()})
+	require.Nil(t, resp)
+	st := requireStatus(t, err, codes.Internal, "INTERNAL")
+	require.NotContains(t, st.Message(), "connection refused")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerLoginLocked(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	lockedErr := fmt.Errorf("Fail: %w", &model.LockedError{RetryAfter: 2 * time.Minute})
+	mockProfileService.On("Login", mock.Anything, mock.AnythingOfType("*model.Auth")).Return(nil, lockedErr).Once()
+
+	_, err := handler.Login(context.Background(), &proto.LoginRequest{Auth: &proto.Auth{Login: "test_login", Password: []byte("test_password")}})
+	requireStatus(t, err, codes.ResourceExhausted, "LOGIN_LOCKED")
+	st, _ := status.FromError(err)
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	require.NotNil(t, retryInfo)
+	require.Equal(t, 2*time.Minute, retryInfo.RetryDelay.AsDuration())
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerUpdateProfileFieldMask(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	ID := uuid.New()
+	updated := &model.Profile{ID: ID, Login: "test_login", Username: "new_username", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	mockProfileService.On("UpdateProfile", mock.Anything, mock.MatchedBy(func(update *model.ProfileUpdate) bool {
+		return update.ID == ID && update.Login == nil && *update.Username == "new_username"
+	})).Return(updated, nil).Once()
+
+	resp, err := handler.UpdateProfile(context.Background(), &proto.UpdateProfileRequest{
+		ID:         ID.String(),
+		Profile:    &proto.Profile{Login: "ignored_login", Username: "new_username"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Username"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "new_username", resp.Profile.Username)
+	require.Equal(t, "test_login", resp.Profile.Login)
+
+	_, err = handler.UpdateProfile(context.Background(), &proto.UpdateProfileRequest{
+		ID:         ID.String(),
+		Profile:    &proto.Profile{},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"CreatedAt"}},
+	})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	_, err = handler.UpdateProfile(context.Background(), &proto.UpdateProfileRequest{ID: ID.String(), Profile: &proto.Profile{}})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerLogsNoSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(logging.RedactionHook{})
+	ctx := logging.NewContext(context.Background(), logrus.NewEntry(logger))
+	handler := NewProfileHandler(mockProfileService)
+
+	mockProfileService.On("Login", mock.Anything, mock.AnythingOfType("*model.Auth")).Return(nil, errors.New("connection refused")).Once()
+	_, err := handler.Login(ctx, &proto.LoginRequest{Auth: &proto.Auth{Login: "test_login", Password: []byte("s3cret-login-password")}})
+	require.Error(t, err)
+
+	mockProfileService.On("CreateNewProfile", mock.Anything, mock.AnythingOfType("*model.Profile")).Return(errors.New("connection refused")).Once()
+	_, err = handler.CreateNewProfile(ctx, &proto.CreateNewProfileRequest{Profile: &proto.CreateProfile{Login: "test_login", Password: []byte("s3cret-new-password")}})
+	require.Error(t, err)
+
+	mockProfileService.On("RefreshTokens", mock.Anything, "s3cret-refresh-token").Return(nil, errors.New("connection refused")).Once()
+	_, err = handler.RefreshTokens(ctx, &proto.RefreshTokensRequest{RefreshToken: "s3cret-refresh-token"})
+	require.Error(t, err)
+
+	mockProfileService.On("ConfirmPasswordReset", mock.Anything, "s3cret-reset-token", []byte("s3cret-reset-password")).Return(errors.New("connection refused")).Once()
+	_, err = handler.ConfirmPasswordReset(ctx, &proto.ConfirmPasswordResetRequest{Token: "s3cret-reset-token", NewPassword: []byte("s3cret-reset-password")})
+	require.Error(t, err)
+
+	require.Contains(t, buf.String(), `"Login":"test_login"`)
+	require.NotContains(t, buf.String(), "s3cret")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
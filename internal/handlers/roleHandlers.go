@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/logging"
+	proto "github.com/eugenshima/profile/proto"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ListRoles function returns roles of the profile with their permissions
+func (ph *ProfileHandler) ListRoles(ctx context.Context, req *proto.ListRolesRequest) (*proto.ListRolesResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	roles, err := ph.srv.ListRoles(ctx, profileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("ListRoles: %v", err)
+		return nil, errorToStatus(err)
+	}
+	resp := &proto.ListRolesResponse{Roles: make([]*proto.Role, 0, len(roles))}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, &proto.Role{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+		})
+	}
+	return resp, nil
+}
+
+// AssignRole function assigns a role to the profile
+func (ph *ProfileHandler) AssignRole(ctx context.Context, req *proto.AssignRoleRequest) (*proto.AssignRoleResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	if req.Role == "" {
+		return nil, invalidField("Role", "must not be empty")
+	}
+	err = ph.srv.AssignRole(ctx, profileID, req.Role)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID, "Role": req.Role}).Errorf("AssignRole: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.AssignRoleResponse{}, nil
+}
+
+// RevokeRole function removes a role from the profile
+func (ph *ProfileHandler) RevokeRole(ctx context.Context, req *proto.RevokeRoleRequest) (*proto.RevokeRoleResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	if req.Role == "" {
+		return nil, invalidField("Role", "must not be empty")
+	}
+	err = ph.srv.RevokeRole(ctx, profileID, req.Role)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID, "Role": req.Role}).Errorf("RevokeRole: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.RevokeRoleResponse{}, nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHandlerListRoles(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	profileID := uuid.New()
+	mockProfileService.On("ListRoles", mock.Anything, profileID).Return([]*model.Role{
+		{Name: model.RoleUser, Description: "regular profile", Permissions: []string{"profile:read:self"}},
+	}, nil).Once()
+
+	resp, err := handler.ListRoles(context.Background(), &proto.ListRolesRequest{ProfileID: profileID.String()})
+	require.NoError(t, err)
+	require.Len(t, resp.Roles, 1)
+	require.Equal(t, model.RoleUser, resp.Roles[0].Name)
+	require.Equal(t, []string{"profile:read:self"}, resp.Roles[0].Permissions)
+
+	_, err = handler.ListRoles(context.Background(), &proto.ListRolesRequest{ProfileID: "not-a-uuid"})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerAssignAndRevokeRole(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	profileID := uuid.New()
+	mockProfileService.On("AssignRole", mock.Anything, profileID, model.RoleAdmin).Return(nil).Once()
+	mockProfileService.On("AssignRole", mock.Anything, profileID, "missing").Return(fmt.Errorf("AssignRole: %w", model.NewNotFoundError("Role"))).Once()
+	mockProfileService.On("RevokeRole", mock.Anything, profileID, model.RoleAdmin).Return(nil).Once()
+
+	_, err := handler.AssignRole(context.Background(), &proto.AssignRoleRequest{ProfileID: profileID.String(), Role: model.RoleAdmin})
+	require.NoError(t, err)
+	_, err = handler.AssignRole(context.Background(), &proto.AssignRoleRequest{ProfileID: profileID.String(), Role: "missing"})
+	st := requireStatus(t, err, codes.NotFound, "NOT_FOUND")
+	require.Equal(t, "Role not found", st.Message())
+	resourceInfo, ok := st.Details()[1].(*errdetails.ResourceInfo)
+	require.True(t, ok)
+	require.Equal(t, "Role", resourceInfo.ResourceType)
+	_, err = handler.AssignRole(context.Background(), &proto.AssignRoleRequest{ProfileID: profileID.String()})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+	_, err = handler.RevokeRole(context.Background(), &proto.RevokeRoleRequest{ProfileID: profileID.String(), Role: model.RoleAdmin})
+	require.NoError(t, err)
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
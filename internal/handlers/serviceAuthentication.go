@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"path"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/mtls"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// ServiceAuthenticator struct identifies internal services by their client certificates
+// and restricts every service to the RPCs it is allowed to call
+type ServiceAuthenticator struct {
+	identities map[string]string
+	allowed    map[string]map[string]bool
+}
+
+// NewServiceAuthenticator creates a new ServiceAuthenticator, identities map a URI SAN, DNS SAN or common name
+// of a client certificate to a service name and rpcs lists short names of RPCs every service may call
+func NewServiceAuthenticator(identities map[string]string, rpcs map[string][]string) *ServiceAuthenticator {
+	allowed := make(map[string]map[string]bool, len(rpcs))
+	for service, names := range rpcs {
+		allowed[service] = make(map[string]bool, len(names))
+		for _, name := range names {
+			allowed[service][name] = true
+		}
+	}
+	return &ServiceAuthenticator{identities: identities, allowed: allowed}
+}
+
+// UnaryInterceptor function puts the calling service into the context, it must run before AuthenticationInterceptor
+func (a *ServiceAuthenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor function is UnaryInterceptor of streaming RPCs
+func (a *ServiceAuthenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate function returns ctx carrying the service identified by the client certificate,
+// callers without a certificate of a known service are left to the bearer token authentication
+func (a *ServiceAuthenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	cert, ok := mtls.PeerCertificate(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	for _, identity := range mtls.Identities(cert) {
+		name, ok := a.identities[identity]
+		if !ok {
+			continue
+		}
+		ctx = logging.WithFields(ctx, logrus.Fields{"Service": name})
+		if !a.allowed[name][path.Base(method)] {
+			logging.FromContext(ctx).Error("RPC is not allowed for the service")
+			return nil, errorToStatus(model.ErrPermissionDenied)
+		}
+		return authz.ContextWithService(ctx, &authz.Service{Name: name}), nil
+	}
+	return ctx, nil
+}
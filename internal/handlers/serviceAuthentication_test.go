@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/authz"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// withClientCert function returns a context of a call made with a verified client certificate
+func withClientCert(ctx context.Context, commonName string, dnsNames ...string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}, DNSNames: dnsNames}
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestServiceAuthenticator(t *testing.T) {
+	services := NewServiceAuthenticator(
+		map[string]string{"billing.internal": "billing", "orders": "orders"},
+		map[string][]string{"billing": {"GetProfileByID"}},
+	)
+	handler := NewProfileHandler(mockProfileService)
+	chain := []grpc.UnaryServerInterceptor{
+		services.UnaryInterceptor(),
+		handler.AuthenticationInterceptor(),
+		AuthorizationInterceptor(authz.NewAuthorizer(testRoles{}, time.Minute)),
+	}
+	var service *authz.Service
+	call := func(ctx context.Context, method string) error {
+		service = nil
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		next := func(ctx context.Context, _ interface{}) (interface{}, error) {
+			service, _ = authz.ServiceFromContext(ctx)
+			return nil, nil
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			interceptor, inner := chain[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		_, err := next(ctx, &proto.GetProfileByIDRequest{ID: uuid.New().String()})
+		return err
+	}
+
+	// the DNS SAN is preferred over the common name
+	require.NoError(t, call(withClientCert(context.Background(), "unknown", "billing.internal"), "/Profiles/GetProfileByID"))
+	require.Equal(t, &authz.Service{Name: "billing"}, service)
+
+	// allow-lists apply to public RPCs as well
+	requireStatus(t, call(withClientCert(context.Background(), "billing.internal"), "/Profiles/DeleteProfileByID"), codes.PermissionDenied, "PERMISSION_DENIED")
+	requireStatus(t, call(withClientCert(context.Background(), "orders"), "/Profiles/Login"), codes.PermissionDenied, "PERMISSION_DENIED")
+
+	// an unknown certificate identity is an ordinary caller, which needs an access token
+	require.NoError(t, call(withClientCert(context.Background(), "unknown"), "/Profiles/Login"))
+	require.Nil(t, service)
+	requireStatus(t, call(withClientCert(context.Background(), "unknown"), "/Profiles/GetProfileByID"), codes.Unauthenticated, "INVALID_TOKEN")
+	requireStatus(t, call(context.Background(), "/Profiles/GetProfileByID"), codes.Unauthenticated, "INVALID_TOKEN")
+}
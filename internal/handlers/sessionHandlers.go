@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListSessions function returns active sessions of the profile
+func (ph *ProfileHandler) ListSessions(ctx context.Context, req *proto.ListSessionsRequest) (*proto.ListSessionsResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	sessions, err := ph.srv.ListSessions(ctx, profileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("ListSessions: %v", err)
+		return nil, errorToStatus(err)
+	}
+	currentID := currentSessionID(ctx)
+	resp := &proto.ListSessionsResponse{Sessions: make([]*proto.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &proto.Session{
+			ID:         session.ID.String(),
+			ProfileID:  session.ProfileID.String(),
+			Device:     session.Device,
+			UserAgent:  session.UserAgent,
+			ClientIP:   session.ClientIP,
+			CreatedAt:  timestamppb.New(session.CreatedAt),
+			LastUsedAt: timestamppb.New(session.LastUsedAt),
+			Current:    session.ID == currentID,
+		})
+	}
+	return resp, nil
+}
+
+// RevokeSession function revokes a single session, of any profile if ProfileID is omitted
+func (ph *ProfileHandler) RevokeSession(ctx context.Context, req *proto.RevokeSessionRequest) (*proto.RevokeSessionResponse, error) {
+	sessionID, err := uuid.Parse(req.SessionID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"SessionID": req.SessionID}).Errorf("Parse: %v", err)
+		return nil, invalidField("SessionID", "must be a valid UUID")
+	}
+	profileID := uuid.Nil
+	if req.ProfileID != "" {
+		profileID, err = uuid.Parse(req.ProfileID)
+		if err != nil {
+			logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+			return nil, invalidField("ProfileID", "must be a valid UUID")
+		}
+	}
+	err = ph.srv.RevokeSession(ctx, profileID, sessionID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"SessionID": sessionID}).Errorf("RevokeSession: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.RevokeSessionResponse{}, nil
+}
+
+// RevokeAllSessions function revokes every session of the profile, optionally keeping the caller's one
+func (ph *ProfileHandler) RevokeAllSessions(ctx context.Context, req *proto.RevokeAllSessionsRequest) (*proto.RevokeAllSessionsResponse, error) {
+	profileID, err := uuid.Parse(req.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": req.ProfileID}).Errorf("Parse: %v", err)
+		return nil, invalidField("ProfileID", "must be a valid UUID")
+	}
+	exceptID := uuid.Nil
+	if req.ExceptCurrent {
+		exceptID = currentSessionID(ctx)
+		if exceptID == uuid.Nil {
+			return nil, errorToStatus(model.ErrInvalidToken)
+		}
+	}
+	revoked, err := ph.srv.RevokeAllSessions(ctx, profileID, exceptID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ProfileID": profileID}).Errorf("RevokeAllSessions: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.RevokeAllSessionsResponse{Revoked: revoked}, nil
+}
+
+// currentSessionID function returns a session of the caller's access token, or uuid.Nil if there is none
+func currentSessionID(ctx context.Context) uuid.UUID {
+	principal, ok := authz.PrincipalFromContext(ctx)
+	if !ok {
+		return uuid.Nil
+	}
+	return principal.SessionID
+}
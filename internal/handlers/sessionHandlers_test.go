@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/authz"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func withBearer(accessToken string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorizationHeader, "Bearer "+accessToken))
+}
+
+func withPrincipal(profileID, sessionID uuid.UUID, roles ...string) context.Context {
+	return authz.ContextWithPrincipal(context.Background(), &authz.Principal{ProfileID: profileID, SessionID: sessionID, Roles: roles})
+}
+
+func TestHandlerListSessionsMarksCurrent(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	profileID := uuid.New()
+	current := &model.Session{ID: uuid.New(), ProfileID: profileID, Device: "laptop", CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	other := &model.Session{ID: uuid.New(), ProfileID: profileID, Device: "phone", CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	mockProfileService.On("ListSessions", mock.Anything, profileID).Return([]*model.Session{current, other}, nil).Once()
+	resp, err := handler.ListSessions(withPrincipal(profileID, current.ID), &proto.ListSessionsRequest{ProfileID: profileID.String()})
+	require.NoError(t, err)
+	require.Len(t, resp.Sessions, 2)
+	require.Equal(t, current.ID.String(), resp.Sessions[0].ID)
+	require.True(t, resp.Sessions[0].Current)
+	require.Equal(t, "phone", resp.Sessions[1].Device)
+	require.False(t, resp.Sessions[1].Current)
+
+	_, err = handler.ListSessions(context.Background(), &proto.ListSessionsRequest{ProfileID: "not-a-uuid"})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerRevokeSession(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	sessionID, profileID := uuid.New(), uuid.New()
+	mockProfileService.On("RevokeSession", mock.Anything, profileID, sessionID).Return(nil).Once()
+	mockProfileService.On("RevokeSession", mock.Anything, uuid.Nil, sessionID).Return(nil).Once()
+	mockProfileService.On("RevokeSession", mock.Anything, profileID, mock.AnythingOfType("uuid.UUID")).Return(fmt.Errorf("RevokeSession: %w", model.ErrNotFound)).Once()
+
+	_, err := handler.RevokeSession(context.Background(), &proto.RevokeSessionRequest{SessionID: sessionID.String(), ProfileID: profileID.String()})
+	require.NoError(t, err)
+	_, err = handler.RevokeSession(context.Background(), &proto.RevokeSessionRequest{SessionID: sessionID.String()})
+	require.NoError(t, err)
+	_, err = handler.RevokeSession(context.Background(), &proto.RevokeSessionRequest{SessionID: uuid.New().String(), ProfileID: profileID.String()})
+	requireStatus(t, err, codes.NotFound, "NOT_FOUND")
+	_, err = handler.RevokeSession(context.Background(), &proto.RevokeSessionRequest{SessionID: sessionID.String(), ProfileID: "not-a-uuid"})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerRevokeAllSessionsExceptCurrent(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	profileID := uuid.New()
+	sessionID := uuid.New()
+	mockProfileService.On("RevokeAllSessions", mock.Anything, profileID, sessionID).Return(int64(3), nil).Once()
+
+	resp, err := handler.RevokeAllSessions(withPrincipal(profileID, sessionID), &proto.RevokeAllSessionsRequest{ProfileID: profileID.String(), ExceptCurrent: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), resp.Revoked)
+
+	_, err = handler.RevokeAllSessions(context.Background(), &proto.RevokeAllSessionsRequest{ProfileID: profileID.String(), ExceptCurrent: true})
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_TOKEN")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestClientInfo(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", "grpc-go/1.58"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 51234}})
+
+	userAgent, clientIP := clientInfo(ctx)
+	require.Equal(t, "grpc-go/1.58", userAgent)
+	require.Equal(t, "10.0.0.7", clientIP)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RefreshTokens function exchanges a refresh token for a new pair of tokens
+func (ph *ProfileHandler) RefreshTokens(ctx context.Context, req *proto.RefreshTokensRequest) (*proto.RefreshTokensResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, invalidField("RefreshToken", "must not be empty")
+	}
+	tokens, err := ph.srv.RefreshTokens(ctx, req.RefreshToken)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("RefreshTokens: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.RefreshTokensResponse{ID: tokens.ProfileID.String(), Tokens: tokensToProto(tokens)}, nil
+}
+
+// ValidateToken function verifies an access token and returns its owner
+func (ph *ProfileHandler) ValidateToken(ctx context.Context, req *proto.ValidateTokenRequest) (*proto.ValidateTokenResponse, error) {
+	if req.AccessToken == "" {
+		return nil, invalidField("AccessToken", "must not be empty")
+	}
+	claims, err := ph.srv.ValidateToken(ctx, req.AccessToken)
+	if err != nil {
+		logging.FromContext(ctx).Debugf("ValidateToken: %v", err)
+		return nil, errorToStatus(err)
+	}
+	return &proto.ValidateTokenResponse{ID: claims.ProfileID.String(), ExpiresAt: timestamppb.New(claims.ExpiresAt)}, nil
+}
+
+// tokensToProto function converts issued tokens into a proto message
+func tokensToProto(tokens *model.Tokens) *proto.Tokens {
+	return &proto.Tokens{
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  timestamppb.New(tokens.AccessTokenExpiresAt),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
+		SessionID:             tokens.SessionID.String(),
+	}
+}
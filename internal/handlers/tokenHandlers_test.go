@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+var mockTokens = &model.Tokens{
+	ProfileID:             uuid.New(),
+	AccessToken:           "access",
+	AccessTokenExpiresAt:  time.Now().Add(time.Minute),
+	RefreshToken:          "refresh",
+	RefreshTokenExpiresAt: time.Now().Add(time.Hour),
+}
+
+func TestHandlerLoginReturnsTokens(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("Login", mock.Anything, mock.AnythingOfType("*model.Auth")).Return(mockTokens, nil).Once()
+
+	resp, err := handler.Login(context.Background(), &proto.LoginRequest{Auth: &proto.Auth{Login: "test_login", Password: []byte("test_password")}})
+	require.NoError(t, err)
+	require.Equal(t, mockTokens.ProfileID.String(), resp.ID)
+	require.Equal(t, mockTokens.AccessToken, resp.Tokens.AccessToken)
+	require.Equal(t, mockTokens.RefreshToken, resp.Tokens.RefreshToken)
+	require.Equal(t, mockTokens.RefreshTokenExpiresAt.Unix(), resp.Tokens.RefreshTokenExpiresAt.AsTime().Unix())
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerRefreshTokens(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("RefreshTokens", mock.Anything, "refresh").Return(mockTokens, nil).Once()
+
+	resp, err := handler.RefreshTokens(context.Background(), &proto.RefreshTokensRequest{RefreshToken: "refresh"})
+	require.NoError(t, err)
+	require.Equal(t, mockTokens.AccessToken, resp.Tokens.AccessToken)
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerRefreshTokensInvalid(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	mockProfileService.On("RefreshTokens", mock.Anything, "stolen").Return(nil, fmt.Errorf("RotateRefreshToken: %w", model.ErrInvalidToken)).Once()
+
+	resp, err := handler.RefreshTokens(context.Background(), &proto.RefreshTokensRequest{RefreshToken: "stolen"})
+	require.Nil(t, resp)
+	requireStatus(t, err, codes.Unauthenticated, "INVALID_TOKEN")
+
+	_, err = handler.RefreshTokens(context.Background(), &proto.RefreshTokensRequest{})
+	requireStatus(t, err, codes.InvalidArgument, "INVALID_ARGUMENT")
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestHandlerValidateToken(t *testing.T) {
+	handler := NewProfileHandler(mockProfileService)
+	claims := &model.AccessClaims{ProfileID: uuid.New(), ExpiresAt: time.Now().Add(time.Minute)}
+	mockProfileService.On("ValidateToken", mock.Anything, "access").Return(claims, nil).Once()
+
+	resp, err := handler.ValidateToken(context.Background(), &proto.ValidateTokenRequest{AccessToken: "access"})
+	require.NoError(t, err)
+	require.Equal(t, claims.ProfileID.String(), resp.ID)
+
+	assertion := mockProfileService.AssertExpectations(t)
+	require.True(t, assertion)
+}
@@ -0,0 +1,106 @@
+// Package healthcheck probes dependencies of the service and reports the result to the gRPC health service
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Probe function checks a dependency, a non-nil error means the dependency is unavailable
+type Probe func(ctx context.Context) error
+
+// Checker struct runs probes periodically and sets serving status of services depending on them.
+// The overall status of the server, the empty service name, is SERVING only while every probe passes
+type Checker struct {
+	health   *health.Server
+	interval time.Duration
+	timeout  time.Duration
+	checks   []check
+
+	mu     sync.Mutex
+	failed map[string]error
+}
+
+// check struct is a named probe and services which cannot serve without it
+type check struct {
+	name     string
+	probe    Probe
+	services []string
+}
+
+// NewChecker creates a new Checker running probes every interval, a probe running longer than timeout fails
+func NewChecker(healthServer *health.Server, interval, timeout time.Duration) *Checker {
+	return &Checker{health: healthServer, interval: interval, timeout: timeout, failed: make(map[string]error)}
+}
+
+// Add function registers a probe of a dependency the services rely on
+func (c *Checker) Add(name string, probe Probe, services ...string) {
+	c.checks = append(c.checks, check{name: name, probe: probe, services: services})
+}
+
+// Run function checks dependencies right away and then every interval until ctx is done
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check function runs every probe once and updates serving status of the server and services
+func (c *Checker) Check(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := make(map[string]healthpb.HealthCheckResponse_ServingStatus)
+	overall := healthpb.HealthCheckResponse_SERVING
+	for _, ch := range c.checks {
+		serving := c.run(ctx, ch)
+		if !serving {
+			overall = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, service := range ch.services {
+			if !serving {
+				status[service] = healthpb.HealthCheckResponse_NOT_SERVING
+			} else if _, ok := status[service]; !ok {
+				status[service] = healthpb.HealthCheckResponse_SERVING
+			}
+		}
+	}
+	// once the health server is shut down these calls are ignored, so a probe cannot report a draining server healthy
+	c.health.SetServingStatus("", overall)
+	for service, st := range status {
+		c.health.SetServingStatus(service, st)
+	}
+}
+
+// run function runs a single probe and logs when its result changes
+func (c *Checker) run(ctx context.Context, ch check) bool {
+	probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := ch.probe(probeCtx)
+	prev, wasFailing := c.failed[ch.name]
+	switch {
+	case err != nil && !wasFailing:
+		logrus.WithFields(logrus.Fields{"check": ch.name}).Errorf("health check failed: %v", err)
+	case err != nil && prev.Error() != err.Error():
+		logrus.WithFields(logrus.Fields{"check": ch.name}).Warnf("health check still failing: %v", err)
+	case err == nil && wasFailing:
+		logrus.WithFields(logrus.Fields{"check": ch.name}).Info("health check recovered")
+	}
+	if err != nil {
+		c.failed[ch.name] = err
+		return false
+	}
+	delete(c.failed, ch.name)
+	return true
+}
@@ -0,0 +1,125 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// fakeProbe struct fails while err is set, it also fails when called without a deadline
+type fakeProbe struct {
+	err error
+}
+
+func (f *fakeProbe) probe(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("probe called without a deadline")
+	}
+	return f.err
+}
+
+func status(t *testing.T, server *health.Server, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestCheckReportsServices(t *testing.T) {
+	server := health.NewServer()
+	db := &fakeProbe{}
+	cache := &fakeProbe{}
+	checker := NewChecker(server, time.Minute, time.Second)
+	checker.Add("database", db.probe, "Profiles")
+	checker.Add("cache", cache.probe, "Sessions")
+
+	checker.Check(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, server, ""))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, server, "Profiles"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, server, "Sessions"))
+
+	db.err = errors.New("connection refused")
+	checker.Check(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, server, ""))
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, server, "Profiles"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, server, "Sessions"))
+
+	db.err = nil
+	checker.Check(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, server, ""))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, server, "Profiles"))
+}
+
+func TestCheckServiceNeedsEveryProbe(t *testing.T) {
+	server := health.NewServer()
+	db := &fakeProbe{err: errors.New("timeout")}
+	cache := &fakeProbe{}
+	checker := NewChecker(server, time.Minute, time.Second)
+	checker.Add("database", db.probe, "Profiles")
+	checker.Add("cache", cache.probe, "Profiles")
+
+	checker.Check(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, server, "Profiles"))
+}
+
+func TestCheckKeepsShutdownStatus(t *testing.T) {
+	server := health.NewServer()
+	db := &fakeProbe{}
+	checker := NewChecker(server, time.Minute, time.Second)
+	checker.Add("database", db.probe, "Profiles")
+	checker.Check(context.Background())
+
+	server.Shutdown()
+	checker.Check(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, server, ""))
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, server, "Profiles"))
+}
+
+func TestRunChecksPeriodically(t *testing.T) {
+	server := health.NewServer()
+	checker := NewChecker(server, 10*time.Millisecond, time.Second)
+	calls := make(chan struct{}, 10)
+	checker.Add("database", func(ctx context.Context) error {
+		select {
+		case calls <- struct{}{}:
+		default:
+		}
+		return nil
+	}, "Profiles")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		checker.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatal("probe was not called periodically")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+}
+
+func TestProbeTimesOut(t *testing.T) {
+	server := health.NewServer()
+	checker := NewChecker(server, time.Minute, 10*time.Millisecond)
+	checker.Add("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, "Profiles")
+
+	checker.Check(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, server, "Profiles"))
+}
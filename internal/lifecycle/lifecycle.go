@@ -0,0 +1,137 @@
+// Package lifecycle runs the gRPC server until shutdown and drains it
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ErrShutdownTimeout is returned by Run when in-flight RPCs did not finish within the shutdown timeout
+// and were cancelled
+var ErrShutdownTimeout = errors.New("shutdown timeout exceeded")
+
+// Manager struct serves gRPC, reports health of services and releases resources on shutdown
+type Manager struct {
+	server          *grpc.Server
+	health          *health.Server
+	services        []string
+	shutdownTimeout time.Duration
+	closers         []closer
+	tasks           []task
+}
+
+// task struct is a named background job running while the server serves
+type task struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// closer struct is a named resource released on shutdown
+type closer struct {
+	name  string
+	close func()
+}
+
+// NewManager creates a new Manager, services are names of gRPC services reported SERVING once the server starts,
+// the overall health of the server is reported as well. A background job registered with Go may change them later
+func NewManager(server *grpc.Server, healthServer *health.Server, shutdownTimeout time.Duration, services ...string) *Manager {
+	return &Manager{server: server, health: healthServer, services: services, shutdownTimeout: shutdownTimeout}
+}
+
+// OnShutdown function registers a resource released after the server stops, resources are released
+// in reverse order of registration
+func (m *Manager) OnShutdown(name string, close func()) {
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Go function registers a background job started once the server reports SERVING, its context is cancelled
+// when shutdown begins and Run waits for it to return before releasing resources
+func (m *Manager) Go(name string, run func(ctx context.Context)) {
+	m.tasks = append(m.tasks, task{name: name, run: run})
+}
+
+// Run function serves lis until ctx is done, then stops accepting RPCs and waits for in-flight ones
+// up to the shutdown timeout before cancelling them. Registered resources are released in any case.
+// It returns nil after a graceful shutdown, ErrShutdownTimeout if RPCs were cancelled,
+// or an error the server failed with
+func (m *Manager) Run(ctx context.Context, lis net.Listener) error {
+	defer m.release()
+	m.setServing(healthpb.HealthCheckResponse_SERVING)
+	stopTasks := m.startTasks(ctx)
+	defer stopTasks()
+	served := make(chan error, 1)
+	go func() {
+		served <- m.server.Serve(lis)
+	}()
+
+	select {
+	case err := <-served:
+		m.health.Shutdown()
+		return fmt.Errorf("Serve: %w", err)
+	case <-ctx.Done():
+	}
+	logrus.Info("shutting down, draining in-flight RPCs")
+	// clients and load balancers watching health stop sending new calls before the server refuses them
+	m.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		m.server.GracefulStop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(m.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+		logrus.Info("server stopped gracefully")
+		return nil
+	case <-timer.C:
+		logrus.Warnf("in-flight RPCs did not finish within %s, cancelling them", m.shutdownTimeout)
+		m.server.Stop()
+		<-stopped
+		return ErrShutdownTimeout
+	}
+}
+
+// startTasks function starts background jobs and returns a function cancelling them and waiting until they return
+func (m *Manager) startTasks(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, t := range m.tasks {
+		wg.Add(1)
+		go func(t task) {
+			defer wg.Done()
+			t.run(ctx)
+			logrus.Debugf("%s stopped", t.name)
+		}(t)
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// setServing function reports the status of the server and every service
+func (m *Manager) setServing(status healthpb.HealthCheckResponse_ServingStatus) {
+	m.health.SetServingStatus("", status)
+	for _, service := range m.services {
+		m.health.SetServingStatus(service, status)
+	}
+}
+
+// release function releases registered resources in reverse order
+func (m *Manager) release() {
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		logrus.Infof("closing %s", m.closers[i].name)
+		m.closers[i].close()
+	}
+}
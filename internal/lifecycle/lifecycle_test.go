@@ -0,0 +1,160 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/eugenshima/profile/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// slowProfiles struct answers GetProfileByID once released, it signals every call it receives
+type slowProfiles struct {
+	proto.UnimplementedProfilesServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowProfiles) GetProfileByID(ctx context.Context, _ *proto.GetProfileByIDRequest) (*proto.GetProfileByIDResponse, error) {
+	s.entered <- struct{}{}
+	select {
+	case <-s.release:
+		return &proto.GetProfileByIDResponse{}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// testServer struct is a Manager serving slowProfiles over an in-memory listener
+type testServer struct {
+	manager  *Manager
+	health   *health.Server
+	profiles *slowProfiles
+	lis      *bufconn.Listener
+	closed   []string
+}
+
+func newTestServer(shutdownTimeout time.Duration) *testServer {
+	ts := &testServer{
+		health:   health.NewServer(),
+		profiles: &slowProfiles{entered: make(chan struct{}, 1), release: make(chan struct{})},
+		lis:      bufconn.Listen(1 << 20),
+	}
+	server := grpc.NewServer()
+	proto.RegisterProfilesServer(server, ts.profiles)
+	healthpb.RegisterHealthServer(server, ts.health)
+	ts.manager = NewManager(server, ts.health, shutdownTimeout, "Profiles")
+	ts.manager.OnShutdown("pool", func() { ts.closed = append(ts.closed, "pool") })
+	ts.manager.OnShutdown("exporter", func() { ts.closed = append(ts.closed, "exporter") })
+	return ts
+}
+
+func (ts *testServer) dial(t *testing.T) *grpc.ClientConn {
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ts.lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func (ts *testServer) status(t *testing.T, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := ts.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestRunDrainsInFlightRPCs(t *testing.T) {
+	ts := newTestServer(5 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ts.manager.Run(ctx, ts.lis) }()
+
+	conn := ts.dial(t)
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "Profiles"})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	called := make(chan error, 1)
+	go func() {
+		_, err := proto.NewProfilesClient(conn).GetProfileByID(context.Background(), &proto.GetProfileByIDRequest{})
+		called <- err
+	}()
+	<-ts.profiles.entered
+
+	cancel()
+	require.Eventually(t, func() bool {
+		return ts.status(t, "") == healthpb.HealthCheckResponse_NOT_SERVING &&
+			ts.status(t, "Profiles") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Run returned before the in-flight RPC finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Empty(t, ts.closed)
+
+	close(ts.profiles.release)
+	require.NoError(t, <-called)
+	require.NoError(t, <-done)
+	require.Equal(t, []string{"exporter", "pool"}, ts.closed)
+}
+
+func TestRunCancelsRPCsAfterShutdownTimeout(t *testing.T) {
+	ts := newTestServer(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ts.manager.Run(ctx, ts.lis) }()
+
+	conn := ts.dial(t)
+	called := make(chan error, 1)
+	go func() {
+		_, err := proto.NewProfilesClient(conn).GetProfileByID(context.Background(), &proto.GetProfileByIDRequest{})
+		called <- err
+	}()
+	<-ts.profiles.entered
+
+	cancel()
+	require.ErrorIs(t, <-done, ErrShutdownTimeout)
+	require.Equal(t, codes.Unavailable, status.Code(<-called))
+	require.Equal(t, []string{"exporter", "pool"}, ts.closed)
+}
+
+func TestRunReturnsServeErrors(t *testing.T) {
+	ts := newTestServer(time.Second)
+	require.NoError(t, ts.lis.Close())
+
+	err := ts.manager.Run(context.Background(), ts.lis)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrShutdownTimeout)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, ts.status(t, ""))
+	require.Equal(t, []string{"exporter", "pool"}, ts.closed)
+}
+
+func TestRunStopsTasksBeforeRelease(t *testing.T) {
+	ts := newTestServer(time.Second)
+	started := make(chan healthpb.HealthCheckResponse_ServingStatus, 1)
+	ts.manager.Go("checker", func(ctx context.Context) {
+		started <- ts.status(t, "Profiles")
+		<-ctx.Done()
+		ts.closed = append(ts.closed, "checker")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ts.manager.Run(ctx, ts.lis) }()
+
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, <-started)
+	cancel()
+	require.NoError(t, <-done)
+	require.Equal(t, []string{"checker", "exporter", "pool"}, ts.closed)
+}
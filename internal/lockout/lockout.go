@@ -0,0 +1,162 @@
+// Package lockout throttles failed logins per account and per source IP
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+)
+
+// Attempts struct represents failed login attempts recorded for a single key
+type Attempts struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store interface keeps failed login attempts
+type Store interface {
+	// Get returns attempts of the key, zero Attempts if there are none
+	Get(ctx context.Context, key string) (*Attempts, error)
+	// AddFailure atomically counts a failure of the key. The count restarts from one
+	// if the key was quiet, neither failing nor locked, for longer than window
+	AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*Attempts, error)
+	// Lock locks the key until the given time unless it is already locked for longer
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets every attempt of the key
+	Reset(ctx context.Context, key string) error
+}
+
+// Config struct represents lockout thresholds, a zero threshold disables the corresponding counter
+type Config struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	// Window is a quiet period after which failures are forgotten
+	Window time.Duration
+	// BaseDuration is a lock duration on reaching a threshold, doubled by every further failure up to MaxDuration
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// Guard struct checks and counts failed logins
+type Guard struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+}
+
+// NewGuard creates a new Guard
+func NewGuard(store Store, cfg Config) *Guard {
+	return &Guard{store: store, cfg: cfg, now: time.Now}
+}
+
+// ProfileAccount function returns the account of a profile. Failures are counted per profile, so its login
+// and verified email share a counter and renaming the login keeps it
+func ProfileAccount(id uuid.UUID) string {
+	return "profile:" + id.String()
+}
+
+// Account function returns the account a login attempt is counted against, the profile once the typed login resolves
+// to one or the typed login itself if it matches no profile
+func Account(id uuid.UUID, login string) string {
+	if id == uuid.Nil {
+		return "login:" + login
+	}
+	return ProfileAccount(id)
+}
+
+func accountKey(account string) string {
+	return "account:" + account
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check function returns a *model.LockedError if the account or the source IP is locked
+func (g *Guard) Check(ctx context.Context, account, ip string) error {
+	var retryAfter time.Duration
+	for _, key := range g.keys(account, ip) {
+		attempts, err := g.store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("Get: %w", err)
+		}
+		if wait := attempts.LockedUntil.Sub(g.now()); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &model.LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail function counts a failed login and locks the account or the source IP on reaching its threshold.
+// lockedFor is the longest lock set by this failure, zero if nothing was locked
+func (g *Guard) Fail(ctx context.Context, account, ip string) (lockedFor time.Duration, err error) {
+	now := g.now()
+	thresholds := []int{g.cfg.MaxAccountFailures, g.cfg.MaxIPFailures}
+	for i, key := range []string{accountKey(account), ipKey(ip)} {
+		if thresholds[i] <= 0 || (i == 1 && ip == "") {
+			continue
+		}
+		attempts, err := g.store.AddFailure(ctx, key, now, g.cfg.Window)
+		if err != nil {
+			return 0, fmt.Errorf("AddFailure: %w", err)
+		}
+		duration := g.lockDuration(attempts.Failures, thresholds[i])
+		if duration == 0 {
+			continue
+		}
+		err = g.store.Lock(ctx, key, now.Add(duration))
+		if err != nil {
+			return 0, fmt.Errorf("Lock: %w", err)
+		}
+		if duration > lockedFor {
+			lockedFor = duration
+		}
+	}
+	return lockedFor, nil
+}
+
+// Succeed function forgets failed attempts of the account after a successful login
+func (g *Guard) Succeed(ctx context.Context, account string) error {
+	return g.Unlock(ctx, account)
+}
+
+// Unlock function removes a lock and failed attempts of the account. Locks of source IPs are kept until they expire,
+// they protect every account tried from the address, so a login from a locked IP is still rejected
+func (g *Guard) Unlock(ctx context.Context, account string) error {
+	err := g.store.Reset(ctx, accountKey(account))
+	if err != nil {
+		return fmt.Errorf("Reset: %w", err)
+	}
+	return nil
+}
+
+// keys function returns every key a login attempt is counted against
+func (g *Guard) keys(account, ip string) []string {
+	keys := []string{accountKey(account)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+// lockDuration function returns an exponentially growing lock duration once failures reach the threshold
+func (g *Guard) lockDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	duration := g.cfg.BaseDuration
+	for i := threshold; i < failures; i++ {
+		duration *= 2
+		if g.cfg.MaxDuration > 0 && duration >= g.cfg.MaxDuration {
+			return g.cfg.MaxDuration
+		}
+	}
+	return duration
+}
@@ -0,0 +1,133 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      5,
+	Window:             15 * time.Minute,
+	BaseDuration:       time.Minute,
+	MaxDuration:        5 * time.Minute,
+}
+
+// newTestGuard function returns a Guard with a controllable clock
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewGuard(NewMemoryStore(), testConfig)
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestAccount(t *testing.T) {
+	id := uuid.New()
+	// the login and the verified email of a profile share a counter
+	require.Equal(t, ProfileAccount(id), Account(id, "login"))
+	require.Equal(t, ProfileAccount(id), Account(id, "owner@example.com"))
+	require.NotEqual(t, Account(uuid.Nil, "login"), Account(uuid.Nil, "another"))
+	require.NotEqual(t, Account(uuid.Nil, id.String()), ProfileAccount(id))
+}
+
+func TestGuardLocksAccount(t *testing.T) {
+	guard, _ := newTestGuard()
+	ctx := context.Background()
+	account := ProfileAccount(uuid.New())
+	for i := 0; i < 2; i++ {
+		lockedFor, err := guard.Fail(ctx, account, "10.0.0.1")
+		require.NoError(t, err)
+		require.Zero(t, lockedFor)
+	}
+	require.NoError(t, guard.Check(ctx, account, "10.0.0.2"))
+
+	lockedFor, err := guard.Fail(ctx, account, "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, lockedFor)
+
+	err = guard.Check(ctx, account, "10.0.0.2")
+	require.ErrorIs(t, err, model.ErrLocked)
+	var lockedErr *model.LockedError
+	require.True(t, errors.As(err, &lockedErr))
+	require.Equal(t, time.Minute, lockedErr.RetryAfter)
+}
+
+func TestGuardBackoff(t *testing.T) {
+	guard, now := newTestGuard()
+	ctx := context.Background()
+	expected := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for _, want := range expected {
+		lockedFor, err := guard.Fail(ctx, "login", "")
+		require.NoError(t, err)
+		require.Equal(t, want, lockedFor)
+		*now = now.Add(lockedFor)
+	}
+}
+
+func TestGuardUnlocksAutomatically(t *testing.T) {
+	guard, now := newTestGuard()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := guard.Fail(ctx, "login", "")
+		require.NoError(t, err)
+	}
+	require.ErrorIs(t, guard.Check(ctx, "login", ""), model.ErrLocked)
+
+	*now = now.Add(time.Minute)
+	require.NoError(t, guard.Check(ctx, "login", ""))
+
+	// failures are forgotten after a quiet window
+	*now = now.Add(testConfig.Window + time.Second)
+	lockedFor, err := guard.Fail(ctx, "login", "")
+	require.NoError(t, err)
+	require.Zero(t, lockedFor)
+}
+
+func TestGuardLocksIP(t *testing.T) {
+	guard, _ := newTestGuard()
+	ctx := context.Background()
+	var lockedFor time.Duration
+	for i := 0; i < 5; i++ {
+		var err error
+		lockedFor, err = guard.Fail(ctx, "login"+string(rune('a'+i)), "10.0.0.1")
+		require.NoError(t, err)
+	}
+	require.Equal(t, time.Minute, lockedFor)
+	require.ErrorIs(t, guard.Check(ctx, "another", "10.0.0.1"), model.ErrLocked)
+	require.NoError(t, guard.Check(ctx, "another", "10.0.0.2"))
+}
+
+func TestGuardUnlock(t *testing.T) {
+	guard, _ := newTestGuard()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := guard.Fail(ctx, "login", "")
+		require.NoError(t, err)
+	}
+	require.ErrorIs(t, guard.Check(ctx, "login", ""), model.ErrLocked)
+
+	require.NoError(t, guard.Unlock(ctx, "login"))
+	require.NoError(t, guard.Check(ctx, "login", ""))
+	lockedFor, err := guard.Fail(ctx, "login", "")
+	require.NoError(t, err)
+	require.Zero(t, lockedFor)
+}
+
+func TestGuardUnlockKeepsIPLocks(t *testing.T) {
+	guard, _ := newTestGuard()
+	ctx := context.Background()
+	for i := 0; i < testConfig.MaxIPFailures; i++ {
+		_, err := guard.Fail(ctx, Account(uuid.Nil, "login"+string(rune('a'+i))), "10.0.0.1")
+		require.NoError(t, err)
+	}
+	account := ProfileAccount(uuid.New())
+	require.NoError(t, guard.Unlock(ctx, account))
+	require.ErrorIs(t, guard.Check(ctx, account, "10.0.0.1"), model.ErrLocked)
+	require.NoError(t, guard.Check(ctx, account, "10.0.0.2"))
+}
@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepThreshold is a number of kept keys above which quiet keys are dropped
+const sweepThreshold = 10000
+
+// MemoryStore struct keeps failed attempts in memory, it is suitable for a single instance only
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]*Attempts
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]*Attempts)}
+}
+
+// Get implements Store interface
+func (s *MemoryStore) Get(_ context.Context, key string) (*Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return &Attempts{}, nil
+	}
+	copied := *attempts
+	return &copied, nil
+}
+
+// AddFailure implements Store interface
+func (s *MemoryStore) AddFailure(_ context.Context, key string, now time.Time, window time.Duration) (*Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.attempts) > sweepThreshold {
+		s.sweep(now, window)
+	}
+	attempts, ok := s.attempts[key]
+	if !ok || quiet(attempts, now, window) {
+		attempts = &Attempts{}
+		s.attempts[key] = attempts
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	copied := *attempts
+	return &copied, nil
+}
+
+// Lock implements Store interface, an existing longer lock is kept
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts, ok := s.attempts[key]
+	if !ok {
+		attempts = &Attempts{}
+		s.attempts[key] = attempts
+	}
+	if until.After(attempts.LockedUntil) {
+		attempts.LockedUntil = until
+	}
+	return nil
+}
+
+// Reset implements Store interface
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep function drops keys which have been quiet for longer than window
+func (s *MemoryStore) sweep(now time.Time, window time.Duration) {
+	for key, attempts := range s.attempts {
+		if quiet(attempts, now, window) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+// quiet function reports whether the attempts neither failed nor were locked for longer than window
+func quiet(attempts *Attempts, now time.Time, window time.Duration) bool {
+	last := attempts.LastFailureAt
+	if attempts.LockedUntil.After(last) {
+		last = attempts.LockedUntil
+	}
+	return now.Sub(last) > window
+}
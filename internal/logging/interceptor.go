@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader is a metadata key of the request ID, a valid ID sent by the client is kept and every response carries it
+const RequestIDHeader = "x-request-id"
+
+// validRequestID matches request IDs accepted from clients
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// UnaryInterceptor function puts a logger of the request into the context of the handler and logs the finished RPC.
+// The logger carries the request ID, method, peer address and trace ID, authentication adds the principal later
+func UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = newRequestContext(ctx, info.FullMethod)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logFinished(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor function is UnaryInterceptor of streaming RPCs
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := newRequestContext(ss.Context(), info.FullMethod)
+		start := time.Now()
+		err := handler(srv, &loggedStream{ServerStream: ss, ctx: ctx})
+		logFinished(ctx, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// newRequestContext function returns ctx carrying a logger of the request and sends the request ID back to the client
+func newRequestContext(ctx context.Context, method string) context.Context {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 && validRequestID.MatchString(values[0]) {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	// the header is sent with the response, it cannot fail before that
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, requestID))
+
+	fields := logrus.Fields{"RequestID": requestID, "Method": method}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["Peer"] = p.Addr.String()
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields["TraceID"] = spanContext.TraceID().String()
+	}
+	return WithFields(ctx, fields)
+}
+
+// logFinished function logs a finished RPC with its status code, health checks are logged at debug level only
+func logFinished(ctx context.Context, method string, start time.Time, err error) {
+	logger := FromContext(ctx).WithFields(logrus.Fields{"GRPCCode": status.Code(err).String(), "Duration": time.Since(start)})
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		logger.Debug("finished RPC")
+		return
+	}
+	logger.Info("finished RPC")
+}
+
+// loggedStream struct replaces a context of the stream with one carrying the logger
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream interface
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
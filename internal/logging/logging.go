@@ -0,0 +1,29 @@
+// Package logging keeps a request scoped logger in the context and redacts secrets from log output
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loggerKey is a context key of the request scoped logger
+type loggerKey struct{}
+
+// NewContext function returns ctx carrying the logger
+func NewContext(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext function returns the logger of the request, or the standard logger outside of a request
+func FromContext(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return logger
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// WithFields function returns ctx carrying the logger of the request with fields added
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
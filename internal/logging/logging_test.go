@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type credentials struct {
+	Login    string
+	Password []byte
+	Nested   *nested
+	secret   string
+}
+
+type nested struct {
+	RefreshToken string
+	Roles        []string
+}
+
+// newTestLogger function returns a logger writing JSON into the buffer with the redaction hook installed
+func newTestLogger(buf *bytes.Buffer) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(RedactionHook{})
+	return logger
+}
+
+func TestIsSensitive(t *testing.T) {
+	for _, name := range []string{"Password", "new_password", "AccessToken", "refresh-token", "ClientSecret", "authorization",
+		"Code", "TOTP", "RecoveryCodes", "PrivateKey", "Signature", "challenge"} {
+		require.True(t, IsSensitive(name), name)
+	}
+	for _, name := range []string{"Login", "ID", "ProfileID", "SessionID", "Method", "Email", "Codes", "GRPCCode"} {
+		require.False(t, IsSensitive(name), name)
+	}
+}
+
+func TestRedactionHookRedactsFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	logger.WithFields(logrus.Fields{
+		"Login":       "user",
+		"Password":    "hunter22",
+		"AccessToken": "eyJhbGciOi",
+		"Credentials": &credentials{
+			Login:    "user",
+			Password: []byte("hunter22"),
+			Nested:   &nested{RefreshToken: "opaque-refresh", Roles: []string{"admin"}},
+			secret:   "unexported",
+		},
+		"Headers": map[string]interface{}{"authorization": "Bearer eyJhbGciOi", "user-agent": "grpc-go"},
+		"ctx":     metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer eyJhbGciOi")),
+		"error":   errors.New("Login: invalid credentials"),
+	}).Error("Login failed")
+
+	out := buf.String()
+	for _, leaked := range []string{"hunter22", "aHVudGVyMjI", "eyJhbGciOi", "opaque-refresh", "unexported"} {
+		require.NotContains(t, out, leaked)
+	}
+	require.Contains(t, out, `"Login":"user"`)
+	require.Contains(t, out, `"Roles":["admin"]`)
+	require.Contains(t, out, `"user-agent":"grpc-go"`)
+	require.Contains(t, out, `"error":"Login: invalid credentials"`)
+	require.Contains(t, out, Redacted)
+}
+
+func TestRedactionHookLimitsDepth(t *testing.T) {
+	var value interface{} = "deep"
+	for i := 0; i < maxRedactDepth+2; i++ {
+		value = map[string]interface{}{"Next": value}
+	}
+	var buf bytes.Buffer
+	newTestLogger(&buf).WithField("Value", value).Info("deep value")
+	require.NotContains(t, buf.String(), "deep\"")
+	require.Contains(t, buf.String(), Redacted)
+}
+
+func TestFromContext(t *testing.T) {
+	require.Equal(t, logrus.StandardLogger(), FromContext(context.Background()).Logger)
+
+	ctx := WithFields(context.Background(), logrus.Fields{"RequestID": "abc"})
+	ctx = WithFields(ctx, logrus.Fields{"ProfileID": "42"})
+	require.Equal(t, logrus.Fields{"RequestID": "abc", "ProfileID": "42"}, FromContext(ctx).Data)
+}
+
+func TestUnaryInterceptorRequestID(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/Profiles/Login"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}})
+
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		expected string
+	}{
+		{name: "kept", md: metadata.Pairs(RequestIDHeader, "req-1.a_b"), expected: "req-1.a_b"},
+		{name: "invalid", md: metadata.Pairs(RequestIDHeader, "bad id\n")},
+		{name: "missing", md: metadata.MD{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields logrus.Fields
+			_, err := UnaryInterceptor()(metadata.NewIncomingContext(ctx, tt.md), nil, info,
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					fields = FromContext(ctx).Data
+					return nil, nil
+				})
+			require.NoError(t, err)
+			require.Equal(t, "/Profiles/Login", fields["Method"])
+			require.Equal(t, "10.0.0.1:4321", fields["Peer"])
+			if tt.expected != "" {
+				require.Equal(t, tt.expected, fields["RequestID"])
+			} else {
+				require.Regexp(t, `^[0-9a-f-]{36}$`, fields["RequestID"])
+			}
+		})
+	}
+}
+
+func TestUnaryInterceptorLogsStatusCode(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := NewContext(context.Background(), logrus.NewEntry(newTestLogger(&buf)))
+	info := &grpc.UnaryServerInfo{FullMethod: "/Profiles/GetProfileByID"}
+
+	_, err := UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "profile not found")
+	})
+	require.Error(t, err)
+	require.Contains(t, buf.String(), `"msg":"finished RPC"`)
+	require.Contains(t, buf.String(), `"GRPCCode":"NotFound"`)
+	require.NotContains(t, buf.String(), Redacted)
+}
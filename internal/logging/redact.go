@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces values of sensitive fields in log output
+const Redacted = "[REDACTED]"
+
+// maxRedactDepth limits how deep nested values are inspected, deeper values are redacted whole
+const maxRedactDepth = 8
+
+// sensitiveParts are parts of field names, compared case-insensitively without separators, whose values are never logged
+var sensitiveParts = []string{"password", "token", "secret", "authorization", "challenge", "recoverycode", "privatekey"}
+
+// sensitiveNames are field names whose values are never logged, a bare "code" is a one-time code of email or TOTP requests
+var sensitiveNames = map[string]bool{"code": true, "otp": true, "totp": true, "signature": true}
+
+// RedactionHook struct replaces values of sensitive fields of every entry before it is formatted.
+// Structs, pointers to them and maps are copied with their sensitive fields redacted, contexts are redacted whole
+// since they carry request metadata such as the bearer token
+type RedactionHook struct{}
+
+// Levels implements logrus.Hook interface
+func (RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook interface
+func (RedactionHook) Fire(entry *logrus.Entry) error {
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		data[key] = redactField(key, value, 0)
+	}
+	entry.Data = data
+	return nil
+}
+
+// IsSensitive function reports whether values of the named field must not be logged
+func IsSensitive(name string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(name))
+	if sensitiveNames[normalized] {
+		return true
+	}
+	for _, part := range sensitiveParts {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactField function returns a value of the named field safe to log
+func redactField(name string, value interface{}, depth int) interface{} {
+	if IsSensitive(name) {
+		return Redacted
+	}
+	return redactValue(value, depth)
+}
+
+// redactValue function returns value with sensitive fields of nested structs and maps redacted
+func redactValue(value interface{}, depth int) interface{} {
+	switch value.(type) {
+	case nil, error, time.Time, time.Duration:
+		return value
+	case context.Context:
+		return Redacted
+	}
+	if depth >= maxRedactDepth {
+		return Redacted
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return value
+		}
+		return redactValue(v.Elem().Interface(), depth+1)
+	case reflect.Struct:
+		fields := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				// unexported, such as internal state of protobuf messages
+				continue
+			}
+			fields[field.Name] = redactField(field.Name, v.Field(i).Interface(), depth+1)
+		}
+		return fields
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return value
+		}
+		entries := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entries[iter.Key().String()] = redactField(iter.Key().String(), iter.Value().Interface(), depth+1)
+		}
+		return entries
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elems[i] = redactValue(v.Index(i).Interface(), depth+1)
+		}
+		return elems
+	default:
+		return value
+	}
+}
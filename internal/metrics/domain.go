@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Domain struct counts business events of the service
+type Domain struct {
+	logins          *prometheus.CounterVec
+	profilesCreated prometheus.Counter
+}
+
+// NewDomain creates a new Domain and registers its metrics
+func NewDomain(reg prometheus.Registerer) *Domain {
+	d := &Domain{
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Number of login attempts by method and result.",
+		}, []string{"method", "result"}),
+		profilesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "profiles_created_total",
+			Help:      "Number of created profiles.",
+		}),
+	}
+	reg.MustRegister(d.logins, d.profilesCreated)
+	return d
+}
+
+// LoginAttempted function counts a login attempt of the method with its result
+func (d *Domain) LoginAttempted(method, result string) {
+	d.logins.WithLabelValues(method, result).Inc()
+}
+
+// ProfileCreated function counts a created profile
+func (d *Domain) ProfileCreated() {
+	d.profilesCreated.Inc()
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryInterceptorRecordsCodes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	rpc := NewRPC(registry)
+	interceptor := rpc.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/Profiles/Login"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		})
+		require.Error(t, err)
+	}
+
+	require.Equal(t, 1.0, testutil.ToFloat64(rpc.handled.WithLabelValues("Profiles", "Login", "OK")))
+	require.Equal(t, 2.0, testutil.ToFloat64(rpc.handled.WithLabelValues("Profiles", "Login", "Unauthenticated")))
+	require.Equal(t, 1, testutil.CollectAndCount(rpc.duration))
+}
+
+func TestStreamInterceptorRecordsCodes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	rpc := NewRPC(registry)
+	info := &grpc.StreamServerInfo{FullMethod: "/grpc.health.v1.Health/Watch", IsServerStream: true}
+
+	err := rpc.StreamInterceptor()(nil, nil, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return status.Error(codes.Canceled, "context canceled")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(rpc.handled.WithLabelValues("grpc.health.v1.Health", "Watch", "Canceled")))
+}
+
+func TestPoolCollector(t *testing.T) {
+	config, err := pgxpool.ParseConfig("postgres://localhost:5432/profile_db?pool_max_conns=7")
+	require.NoError(t, err)
+	config.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	registry := prometheus.NewRegistry()
+	RegisterPool(registry, pool)
+	count, err := testutil.GatherAndCount(registry)
+	require.NoError(t, err)
+	require.Equal(t, 9, count)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "profile_db_pool_max_conns" {
+			require.Equal(t, 7.0, family.GetMetric()[0].GetGauge().GetValue())
+			return
+		}
+	}
+	t.Fatal("profile_db_pool_max_conns is not collected")
+}
+
+func TestDomainAndQueries(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	domain := NewDomain(registry)
+	queries := NewQueries(registry)
+
+	domain.LoginAttempted("password", "success")
+	domain.LoginAttempted("password", "failure")
+	domain.LoginAttempted("password", "failure")
+	domain.ProfileCreated()
+	queries.ObserveQuery("GetProfileByID", 3*time.Millisecond)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(domain.logins.WithLabelValues("password", "failure")))
+	require.Equal(t, 1.0, testutil.ToFloat64(domain.profilesCreated))
+	require.Equal(t, 1, testutil.CollectAndCount(queries.duration, "profile_db_query_duration_seconds"))
+}
+
+func TestServerExposesMetrics(t *testing.T) {
+	registry := NewRegistry()
+	NewDomain(registry).ProfileCreated()
+	server := httptest.NewServer(NewServer(registry).Handler)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "profile_profiles_created_total 1")
+	require.Contains(t, string(body), "go_goroutines")
+}
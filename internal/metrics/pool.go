@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector struct reports statistics of a PostgreSQL connection pool whenever metrics are scraped
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+}
+
+// RegisterPool function registers a collector of statistics of the pool
+func RegisterPool(reg prometheus.Registerer, pool *pgxpool.Pool) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	reg.MustRegister(&poolCollector{
+		pool:              pool,
+		acquiredConns:     desc("acquired_conns", "Number of connections currently in use."),
+		idleConns:         desc("idle_conns", "Number of idle connections in the pool."),
+		constructingConns: desc("constructing_conns", "Number of connections being established."),
+		totalConns:        desc("total_conns", "Number of open connections in the pool."),
+		maxConns:          desc("max_conns", "Maximum number of connections in the pool."),
+		acquireCount:      desc("acquires_total", "Number of successful connection acquires."),
+		acquireDuration:   desc("acquire_wait_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquireCount: desc("empty_acquires_total",
+			"Number of acquires that waited for a connection because the pool had no idle one."),
+		canceledAcquireCount: desc("canceled_acquires_total", "Number of acquires cancelled by their context."),
+	})
+}
+
+// Describe implements prometheus.Collector interface
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquireCount
+}
+
+// Collect implements prometheus.Collector interface
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
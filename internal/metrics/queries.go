@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Queries struct measures how long queries of the repository take
+type Queries struct {
+	duration *prometheus.HistogramVec
+}
+
+// NewQueries creates a new Queries and registers its metrics
+func NewQueries(reg prometheus.Registerer) *Queries {
+	q := &Queries{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time taken by repository queries, including their transaction.",
+			// 0.5ms up to about 8s
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 15),
+		}, []string{"query"}),
+	}
+	reg.MustRegister(q.duration)
+	return q
+}
+
+// ObserveQuery function records a duration of the named query
+func (q *Queries) ObserveQuery(query string, duration time.Duration) {
+	q.duration.WithLabelValues(query).Observe(duration.Seconds())
+}
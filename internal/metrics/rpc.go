@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// RPC struct counts handled RPCs by status code and measures how long they take
+type RPC struct {
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewRPC creates a new RPC and registers its metrics
+func NewRPC(reg prometheus.Registerer) *RPC {
+	m := &RPC{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Number of RPCs completed on the server, regardless of success or failure.",
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time taken by the server to handle RPCs.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_service", "grpc_method"}),
+	}
+	reg.MustRegister(m.handled, m.duration)
+	return m
+}
+
+// UnaryInterceptor function records every unary RPC, it should come first in the chain to see calls rejected by later interceptors
+func (m *RPC) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor function records every streaming RPC once the stream ends
+func (m *RPC) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(info.FullMethod, start, err)
+		return err
+	}
+}
+
+// observe function records a completed RPC
+func (m *RPC) observe(fullMethod string, start time.Time, err error) {
+	service, method := splitMethod(fullMethod)
+	m.handled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	m.duration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+// splitMethod function splits a full method name "/service/method" into its parts
+func splitMethod(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	i := strings.LastIndex(fullMethod, "/")
+	if i < 0 {
+		return "unknown", fullMethod
+	}
+	return fullMethod[:i], fullMethod[i+1:]
+}
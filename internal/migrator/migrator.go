@@ -0,0 +1,370 @@
+// Package migrator applies versioned SQL migrations to PostgreSQL
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// lockID is a key of the advisory lock, which serializes migrations between replicas
+const lockID = 872315
+
+var (
+	// ErrDatabaseAhead is returned when the database has migrations the binary does not know about
+	ErrDatabaseAhead = errors.New("database schema is ahead of the binary")
+	// ErrChecksumMismatch is returned when an applied migration was modified afterwards
+	ErrChecksumMismatch = errors.New("applied migration checksum mismatch")
+	// ErrNoDownMigration is returned when the last applied migration has no undo script
+	ErrNoDownMigration = errors.New("no down migration")
+)
+
+var fileNameRegexp = regexp.MustCompile(`^([VU])(\d+)__(\w+)\.sql$`)
+
+// Migration struct represents a single versioned migration
+type Migration struct {
+	Version     int
+	Description string
+	Up          string
+	Down        string
+	Checksum    string
+}
+
+// Status struct represents a migration together with its state in the database
+type Status struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Migrator struct applies migrations to the database
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []*Migration
+}
+
+// NewMigrator creates a new Migrator with migrations loaded from fsys
+func NewMigrator(pool *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("Load: %w", err)
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// Load function reads migration scripts from the root of fsys, sorted by version
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("ReadDir: %w", err)
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.Atoi(matches[2])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("ReadFile: %w", err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Description: matches[3]}
+			byVersion[version] = m
+		}
+		if matches[1] == "V" {
+			if m.Checksum != "" {
+				return nil, fmt.Errorf("duplicate migration version %d", version)
+			}
+			sum := sha256.Sum256(content)
+			m.Up = string(content)
+			m.Description = matches[3]
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("down migration %d has no up migration", m.Version)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration version %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration known to the binary
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up function applies all pending migrations, each one in its own transaction
+func (m *Migrator) Up(ctx context.Context) (applied int, err error) {
+	err = m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		appliedSums, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := appliedSums[migration.Version]; ok {
+				continue
+			}
+			err = m.apply(ctx, conn, migration)
+			if err != nil {
+				return fmt.Errorf("apply V%d: %w", migration.Version, err)
+			}
+			logrus.WithFields(logrus.Fields{"version": migration.Version, "description": migration.Description}).Info("migration applied")
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down function reverts the last applied migration using its undo script
+func (m *Migrator) Down(ctx context.Context) (reverted int, err error) {
+	err = m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		appliedSums, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := appliedSums[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("V%d: %w", migration.Version, ErrNoDownMigration)
+			}
+			err = m.revert(ctx, conn, migration)
+			if err != nil {
+				return fmt.Errorf("revert V%d: %w", migration.Version, err)
+			}
+			logrus.WithFields(logrus.Fields{"version": migration.Version, "description": migration.Description}).Info("migration reverted")
+			reverted = migration.Version
+			return nil
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status function returns every known migration with its state in the database
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Acquire: %w", err)
+	}
+	defer conn.Release()
+	exists, err := tableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time)
+	if exists {
+		rows, err := conn.Query(ctx, "SELECT version, applied_at FROM public.schema_migrations")
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var at time.Time
+			err = rows.Scan(&version, &at)
+			if err != nil {
+				return nil, fmt.Errorf("Scan: %w", err)
+			}
+			appliedAt[version] = at
+		}
+		if rows.Err() != nil {
+			return nil, fmt.Errorf("rows: %w", rows.Err())
+		}
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses = append(statuses, Status{Version: migration.Version, Description: migration.Description, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// Check function returns the number of pending migrations, or an error if the database can't be served by this binary.
+// It only reads the database: a missing schema_migrations table means that nothing was applied yet
+func (m *Migrator) Check(ctx context.Context) (pending int, err error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Acquire: %w", err)
+	}
+	defer conn.Release()
+	exists, err := tableExists(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return len(m.migrations), nil
+	}
+	appliedSums, err := m.verify(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	return len(m.migrations) - len(appliedSums), nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("Acquire: %w", err)
+	}
+	defer conn.Release()
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	if err != nil {
+		return fmt.Errorf("pg_advisory_lock: %w", err)
+	}
+	defer func() {
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+		if err != nil {
+			logrus.Errorf("pg_advisory_unlock: %v", err)
+		}
+	}()
+	err = ensureTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// verify compares applied migrations with the known ones and returns their checksums by version
+func (m *Migrator) verify(ctx context.Context, conn *pgxpool.Conn) (map[int]string, error) {
+	rows, err := conn.Query(ctx, "SELECT version, checksum FROM public.schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Query: %w", err)
+	}
+	defer rows.Close()
+	appliedSums := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var checksum string
+		err = rows.Scan(&version, &checksum)
+		if err != nil {
+			return nil, fmt.Errorf("Scan: %w", err)
+		}
+		appliedSums[version] = checksum
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows: %w", rows.Err())
+	}
+	for version, checksum := range appliedSums {
+		if version > m.Latest() {
+			return nil, fmt.Errorf("database version %d, binary version %d: %w", version, m.Latest(), ErrDatabaseAhead)
+		}
+		if m.migrations[version-1].Checksum != checksum {
+			return nil, fmt.Errorf("V%d: %w", version, ErrChecksumMismatch)
+		}
+	}
+	return appliedSums, nil
+}
+
+// apply executes an up script and records it inside a single transaction
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, migration *Migration) error {
+	return inTx(ctx, conn, func(tx pgx.Tx) error {
+		if migration.Up != "" {
+			_, err := tx.Exec(ctx, migration.Up)
+			if err != nil {
+				return fmt.Errorf("exec: %w", err)
+			}
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO public.schema_migrations (version, description, checksum) VALUES ($1, $2, $3)",
+			migration.Version, migration.Description, migration.Checksum)
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		return nil
+	})
+}
+
+// revert executes an undo script and removes its record inside a single transaction
+func (m *Migrator) revert(ctx context.Context, conn *pgxpool.Conn, migration *Migration) error {
+	return inTx(ctx, conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, migration.Down)
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM public.schema_migrations WHERE version=$1", migration.Version)
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		return nil
+	})
+}
+
+// tableExists reports whether schema_migrations was created by a previous Up or Down
+func tableExists(ctx context.Context, conn *pgxpool.Conn) (bool, error) {
+	var exists bool
+	err := conn.QueryRow(ctx, "SELECT to_regclass('public.schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("QueryRow: %w", err)
+	}
+	return exists, nil
+}
+
+func ensureTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS public.schema_migrations (
+		version     integer PRIMARY KEY,
+		description text        NOT NULL,
+		checksum    text        NOT NULL,
+		applied_at  timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func inTx(ctx context.Context, conn *pgxpool.Conn, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			rbErr := tx.Rollback(ctx)
+			if rbErr != nil {
+				logrus.Errorf("Rollback: %v", rbErr)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	return fn(tx)
+}
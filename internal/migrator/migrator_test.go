@@ -0,0 +1,259 @@
+package migrator
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/eugenshima/profile/migration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"V2__ADD_USERNAME.sql": {Data: []byte("ALTER TABLE t ADD username text;")},
+		"V1__CREATE.sql":       {Data: []byte("CREATE TABLE t (id int);")},
+		"U1__CREATE.sql":       {Data: []byte("DROP TABLE t;")},
+		"README.md":            {Data: []byte("not a migration")},
+	}
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, 1, migrations[0].Version)
+	require.Equal(t, "CREATE", migrations[0].Description)
+	require.Equal(t, "DROP TABLE t;", migrations[0].Down)
+	require.Equal(t, 2, migrations[1].Version)
+	require.Empty(t, migrations[1].Down)
+	require.NotEqual(t, migrations[0].Checksum, migrations[1].Checksum)
+}
+
+func TestLoadMissingVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"V1__CREATE.sql": {Data: []byte("SELECT 1;")},
+		"V3__GAP.sql":    {Data: []byte("SELECT 3;")},
+	}
+	_, err := Load(fsys)
+	require.Error(t, err)
+}
+
+func TestLoadOrphanDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"V1__CREATE.sql": {Data: []byte("SELECT 1;")},
+		"U2__GONE.sql":   {Data: []byte("SELECT 2;")},
+	}
+	_, err := Load(fsys)
+	require.Error(t, err)
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load(migration.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for _, m := range migrations {
+		require.NotEmpty(t, m.Up)
+	}
+}
+
+// testFS returns two migrations on a table owned by migrator tests
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"V1__CREATE_ITEM.sql": {Data: []byte("CREATE TABLE public.migrator_item (id int PRIMARY KEY);")},
+		"U1__CREATE_ITEM.sql": {Data: []byte("DROP TABLE public.migrator_item;")},
+		"V2__ADD_NAME.sql":    {Data: []byte("ALTER TABLE public.migrator_item ADD name text;")},
+		"U2__ADD_NAME.sql":    {Data: []byte("ALTER TABLE public.migrator_item DROP COLUMN name;")},
+	}
+}
+
+// newTestMigrator returns a migrator over fsys on an empty database
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	_, err := testPool.Exec(context.Background(), "DROP TABLE IF EXISTS public.schema_migrations, public.migrator_item")
+	require.NoError(t, err)
+	m, err := NewMigrator(testPool, fsys)
+	require.NoError(t, err)
+	return m
+}
+
+func migrationsTableExists(t *testing.T) bool {
+	t.Helper()
+	var exists bool
+	err := testPool.QueryRow(context.Background(), "SELECT to_regclass('public.schema_migrations') IS NOT NULL").Scan(&exists)
+	require.NoError(t, err)
+	return exists
+}
+
+func TestUpDown(t *testing.T) {
+	m := newTestMigrator(t, testFS())
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, applied)
+	_, err = testPool.Exec(context.Background(), "INSERT INTO public.migrator_item (id, name) VALUES (1, 'item')")
+	require.NoError(t, err)
+	applied, err = m.Up(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, applied)
+	pending, err := m.Check(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, pending)
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	for _, status := range statuses {
+		require.True(t, status.Applied)
+		require.False(t, status.AppliedAt.IsZero())
+	}
+
+	reverted, err := m.Down(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, reverted)
+	_, err = testPool.Exec(context.Background(), "INSERT INTO public.migrator_item (id, name) VALUES (2, 'item')")
+	require.Error(t, err)
+	pending, err = m.Check(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, pending)
+
+	reverted, err = m.Down(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, reverted)
+	reverted, err = m.Down(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, reverted)
+	pending, err = m.Check(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, pending)
+}
+
+func TestDownWithoutUndoScript(t *testing.T) {
+	fsys := testFS()
+	delete(fsys, "U2__ADD_NAME.sql")
+	m := newTestMigrator(t, fsys)
+	_, err := m.Up(context.Background())
+	require.NoError(t, err)
+
+	_, err = m.Down(context.Background())
+	require.ErrorIs(t, err, ErrNoDownMigration)
+	pending, err := m.Check(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, pending)
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	fsys := testFS()
+	fsys["V2__ADD_NAME.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE public.migrator_item ADD name text; SELECT 1/0;")}
+	m := newTestMigrator(t, fsys)
+
+	applied, err := m.Up(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 1, applied)
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.True(t, statuses[0].Applied)
+	require.False(t, statuses[1].Applied)
+	_, err = testPool.Exec(context.Background(), "INSERT INTO public.migrator_item (id, name) VALUES (1, 'item')")
+	require.Error(t, err)
+}
+
+func TestCheckIsReadOnly(t *testing.T) {
+	m := newTestMigrator(t, testFS())
+
+	pending, err := m.Check(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, pending)
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	require.False(t, statuses[0].Applied)
+	require.False(t, migrationsTableExists(t))
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	m := newTestMigrator(t, testFS())
+	_, err := m.Up(context.Background())
+	require.NoError(t, err)
+
+	fsys := testFS()
+	fsys["V1__CREATE_ITEM.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE public.migrator_item (id bigint PRIMARY KEY);")}
+	modified, err := NewMigrator(testPool, fsys)
+	require.NoError(t, err)
+	_, err = modified.Check(context.Background())
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = modified.Up(context.Background())
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = modified.Down(context.Background())
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestDatabaseAhead(t *testing.T) {
+	m := newTestMigrator(t, testFS())
+	_, err := m.Up(context.Background())
+	require.NoError(t, err)
+
+	fsys := testFS()
+	delete(fsys, "V2__ADD_NAME.sql")
+	delete(fsys, "U2__ADD_NAME.sql")
+	older, err := NewMigrator(testPool, fsys)
+	require.NoError(t, err)
+	_, err = older.Check(context.Background())
+	require.ErrorIs(t, err, ErrDatabaseAhead)
+	_, err = older.Up(context.Background())
+	require.ErrorIs(t, err, ErrDatabaseAhead)
+	_, err = older.Down(context.Background())
+	require.ErrorIs(t, err, ErrDatabaseAhead)
+}
+
+func TestUpWaitsForLock(t *testing.T) {
+	m := newTestMigrator(t, testFS())
+	conn, err := testPool.Acquire(context.Background())
+	require.NoError(t, err)
+	defer conn.Release()
+	_, err = conn.Exec(context.Background(), "SELECT pg_advisory_lock($1)", lockID)
+	require.NoError(t, err)
+
+	// another replica holds the lock, so Up must not touch the database
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = m.Up(ctx)
+	require.Error(t, err)
+	require.False(t, migrationsTableExists(t))
+
+	done := make(chan int, 1)
+	go func() {
+		applied, err := m.Up(context.Background())
+		if err != nil {
+			applied = -1
+		}
+		done <- applied
+	}()
+	select {
+	case <-done:
+		require.Fail(t, "Up did not wait for the advisory lock")
+	case <-time.After(200 * time.Millisecond):
+	}
+	_, err = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	require.NoError(t, err)
+	require.Equal(t, 2, <-done)
+}
+
+func TestConcurrentUp(t *testing.T) {
+	m := newTestMigrator(t, testFS())
+
+	results := make(chan int, 3)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			applied, err := m.Up(context.Background())
+			if err != nil {
+				applied = -1
+			}
+			results <- applied
+		}()
+	}
+	total := 0
+	for i := 0; i < cap(results); i++ {
+		applied := <-results
+		require.GreaterOrEqual(t, applied, 0)
+		total += applied
+	}
+	require.Equal(t, 2, total)
+}
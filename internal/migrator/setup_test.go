@@ -0,0 +1,77 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/ory/dockertest"
+)
+
+// constants for pgx connection
+const (
+	pgUsername = "eugen"
+	pgPassword = "ur2qly1ini"
+	pgDB       = "profile_db"
+)
+
+var testPool *pgxpool.Pool
+
+// SetupTestPgx function starts an empty database for migrator tests
+func SetupTestPgx() (*pgxpool.Pool, func(), error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not construct pool: %w", err)
+	}
+	resource, err := pool.Run("postgres", "latest", []string{
+		fmt.Sprintf("POSTGRES_USER=%s", pgUsername),
+		fmt.Sprintf("POSTGRES_PASSWORD=%s", pgPassword),
+		fmt.Sprintf("POSTGRES_DB=%s", pgDB)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not start resource: %w", err)
+	}
+
+	dbURL := fmt.Sprintf("postgres://%s:%s@localhost:%s/%s", pgUsername, pgPassword, resource.GetPort("5432/tcp"), pgDB)
+	cfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse dbURL: %w", err)
+	}
+	var dbpool *pgxpool.Pool
+	err = pool.Retry(func() error {
+		dbpool, err = pgxpool.ConnectConfig(context.Background(), cfg)
+		if err != nil {
+			return err
+		}
+		err = dbpool.Ping(context.Background())
+		if err != nil {
+			dbpool.Close()
+		}
+		return err
+	})
+	if err != nil {
+		pool.Purge(resource)
+		return nil, nil, fmt.Errorf("failed to connect pgxpool: %w", err)
+	}
+	cleanup := func() {
+		dbpool.Close()
+		pool.Purge(resource)
+	}
+
+	return dbpool, cleanup, nil
+}
+
+// TestMain execute all tests
+func TestMain(m *testing.M) {
+	dbpool, cleanupPgx, err := SetupTestPgx()
+	if err != nil {
+		fmt.Println("Could not construct the pool: ", err)
+		os.Exit(1)
+	}
+	testPool = dbpool
+
+	exitVal := m.Run()
+	cleanupPgx()
+	os.Exit(exitVal)
+}
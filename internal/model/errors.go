@@ -0,0 +1,109 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Domain errors, returned by repository and service layers and translated into gRPC codes by handlers
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrLocked             = errors.New("locked")
+	ErrVersionMismatch    = errors.New("version mismatch")
+	ErrFailedPrecondition = errors.New("failed precondition")
+	ErrPermissionDenied   = errors.New("permission denied")
+)
+
+// FieldViolation struct describes a single invalid field of a request
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError struct represents an invalid argument error with every violated field listed
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+// NewValidationError creates a new ValidationError with a single violation
+func NewValidationError(field, description string) *ValidationError {
+	return &ValidationError{Violations: []FieldViolation{{Field: field, Description: description}}}
+}
+
+// Error implements error interface
+func (e *ValidationError) Error() string {
+	descriptions := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		descriptions = append(descriptions, v.Field+": "+v.Description)
+	}
+	return ErrInvalidArgument.Error() + ": " + strings.Join(descriptions, "; ")
+}
+
+// Is makes ValidationError match ErrInvalidArgument with errors.Is
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+// LockedError struct represents a temporarily locked account or source IP
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements error interface
+func (e *LockedError) Error() string {
+	return ErrLocked.Error() + ": retry after " + e.RetryAfter.Round(time.Second).String()
+}
+
+// Is makes LockedError match ErrLocked with errors.Is
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// PreconditionError struct represents an operation rejected because of the current state of the profile
+type PreconditionError struct {
+	// Subject is a part of the profile in a wrong state, e.g. Email
+	Subject     string
+	Description string
+}
+
+// Error implements error interface
+func (e *PreconditionError) Error() string {
+	return ErrFailedPrecondition.Error() + ": " + e.Subject + ": " + e.Description
+}
+
+// Is makes PreconditionError match ErrFailedPrecondition with errors.Is
+func (e *PreconditionError) Is(target error) bool {
+	return target == ErrFailedPrecondition
+}
+
+// ResourceError struct represents a missing or duplicate resource, it matches either ErrNotFound or ErrAlreadyExists
+type ResourceError struct {
+	// Resource is a kind of the resource, e.g. Role
+	Resource string
+	Err      error
+}
+
+// NewNotFoundError creates a new ResourceError of a missing resource
+func NewNotFoundError(resource string) *ResourceError {
+	return &ResourceError{Resource: resource, Err: ErrNotFound}
+}
+
+// NewAlreadyExistsError creates a new ResourceError of a duplicate resource
+func NewAlreadyExistsError(resource string) *ResourceError {
+	return &ResourceError{Resource: resource, Err: ErrAlreadyExists}
+}
+
+// Error implements error interface
+func (e *ResourceError) Error() string {
+	return e.Resource + " " + e.Err.Error()
+}
+
+// Is makes ResourceError match its ErrNotFound or ErrAlreadyExists with errors.Is
+func (e *ResourceError) Is(target error) bool {
+	return target == e.Err
+}
@@ -1,20 +1,65 @@
 // Package model of our entity
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
 
-// Profile struct represents a Profile model
+	"github.com/google/uuid"
+)
+
+// Profile struct represents a Profile model, including its credentials
 type Profile struct {
-	ID           uuid.UUID `json:"id"`
-	Login        string    `json:"login"`
-	Password     []byte    `json:"password"`
-	RefreshToken []byte    `json:"refresh_token"`
-	Username     string    `json:"username"`
+	ID       uuid.UUID `json:"id"`
+	Login    string    `json:"login"`
+	Password []byte    `json:"password"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	// EmailVerifiedAt is nil until the owner proves control of Email, changing Email resets it
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	// Version is incremented by every write of the profile
+	Version int64 `json:"version"`
+	// CredentialsVersion is incremented whenever the password is changed or reset
+	CredentialsVersion int64 `json:"credentials_version"`
+}
+
+// ProfileUpdate struct represents a partial update of a profile, nil fields are left unchanged
+type ProfileUpdate struct {
+	ID       uuid.UUID
+	Login    *string
+	Username *string
+	Email    *string
+	// Version is an expected version of the profile, zero skips the check
+	Version int64
+}
+
+// PasswordChange struct represents a request to replace the password of a profile
+type PasswordChange struct {
+	ProfileID       uuid.UUID
+	CurrentPassword []byte
+	NewPassword     []byte
+	// KeepSessionID is a session left signed in, uuid.Nil revokes every session
+	KeepSessionID uuid.UUID
+	ClientIP      string
+}
+
+// PasswordReset struct represents a stored single-use password reset token
+type PasswordReset struct {
+	ID        uuid.UUID
+	ProfileID uuid.UUID
+	// Hash is a hash of the reset token, the token itself is only sent to the profile owner
+	Hash      []byte
+	ExpiresAt time.Time
 }
 
+// Auth struct represents login credentials, UserAgent and ClientIP are taken from the request metadata and peer
 type Auth struct {
-	Login    string `json:"login"`
-	Password []byte `json:"password"`
+	Login     string `json:"login"`
+	Password  []byte `json:"password"`
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	ClientIP  string `json:"client_ip"`
 }
 
 type Login struct {
@@ -22,7 +67,140 @@ type Login struct {
 	Password string `json:"password"`
 }
 
+// UpdateTokens struct represents a refresh token to be stored, RefreshToken is a hash of the issued token.
+// ID is an ID of the profile, an empty FamilyID starts a new token family within a new session
+// described by Device, UserAgent and ClientIP
 type UpdateTokens struct {
 	ID           uuid.UUID `json:"id"`
+	FamilyID     uuid.UUID `json:"family_id"`
 	RefreshToken []byte    `json:"refresh_token"`
+	Device       string    `json:"device"`
+	UserAgent    string    `json:"user_agent"`
+	ClientIP     string    `json:"client_ip"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// RefreshToken struct represents a stored refresh token.
+// Tokens issued from a single login form a family, only the newest member of it is usable
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id"`
+	FamilyID  uuid.UUID  `json:"family_id"`
+	ProfileID uuid.UUID  `json:"profile_id"`
+	Hash      []byte     `json:"hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// Tokens struct represents a pair of tokens issued to a profile.
+// A profile with two-factor authentication gets only an MFAChallenge on login, which is exchanged for the pair by CompleteMFA
+type Tokens struct {
+	ProfileID             uuid.UUID `json:"profile_id"`
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	MFAChallenge          string    `json:"mfa_challenge"`
+	MFAChallengeExpiresAt time.Time `json:"mfa_challenge_expires_at"`
+}
+
+// TOTP struct represents a stored TOTP authenticator of a profile, Secret is sealed and never stored in plaintext
+type TOTP struct {
+	ProfileID uuid.UUID `json:"profile_id"`
+	Secret    []byte    `json:"secret"`
+	// ConfirmedAt is nil until the owner proves the authenticator works, only a confirmed authenticator is asked for on login
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	// LastUsedStep is a time step of the last accepted code, codes of it and earlier steps are rejected as replays
+	LastUsedStep int64     `json:"last_used_step"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TOTPEnrollment struct represents a new authenticator to be added to an authenticator app
+type TOTPEnrollment struct {
+	// Secret is a base32 encoded secret for manual entry
+	Secret string `json:"secret"`
+	// URI is an otpauth:// URI of the secret, usually shown as a QR code
+	URI string `json:"uri"`
+}
+
+// AccessClaims struct represents verified claims of an access token
+type AccessClaims struct {
+	ProfileID uuid.UUID `json:"profile_id"`
+	SessionID uuid.UUID `json:"session_id"`
+	// CredentialsVersion is a credentials version of the profile at the time the token was issued
+	CredentialsVersion int64 `json:"credentials_version"`
+	// Roles are roles of the profile at the time the token was issued
+	Roles     []string  `json:"roles"`
+	TokenID   string    `json:"token_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Session struct represents a login session of a profile, its ID is an ID of the refresh token family
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	ProfileID  uuid.UUID  `json:"profile_id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	ClientIP   string     `json:"client_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// SessionState struct represents a state of a session that its access tokens are checked against on every request
+type SessionState struct {
+	ProfileID uuid.UUID  `json:"profile_id"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	// CredentialsVersion is a current credentials version of the profile
+	CredentialsVersion int64 `json:"credentials_version"`
+}
+
+// Passkey struct represents a stored WebAuthn credential of a profile, PublicKey is a COSE_Key
+type Passkey struct {
+	CredentialID []byte     `json:"credential_id"`
+	ProfileID    uuid.UUID  `json:"profile_id"`
+	PublicKey    []byte     `json:"public_key"`
+	AAGUID       []byte     `json:"aaguid"`
+	SignCount    int64      `json:"sign_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnChallenge struct represents a stored single-use challenge of a WebAuthn ceremony.
+// ProfileID is uuid.Nil for login ceremonies, whose profile is found by the credential
+type WebAuthnChallenge struct {
+	Hash      []byte
+	Ceremony  string
+	ProfileID uuid.UUID
+	ExpiresAt time.Time
+}
+
+// PasskeyAssertion struct represents a response of an authenticator to a login challenge.
+// Device, UserAgent and ClientIP describe the session started by it
+type PasskeyAssertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	// UserHandle is an ID of the profile the credential was registered for
+	UserHandle []byte
+	Device     string
+	UserAgent  string
+	ClientIP   string
+}
+
+// Built-in roles, every new profile gets RoleUser
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Role struct represents a named set of permissions assigned to profiles
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
 }
@@ -0,0 +1,181 @@
+// Package mtls serves TLS certificates reloaded from files and identifies clients by their certificates
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Files struct names PEM files of the server certificate, its key and CAs of client certificates
+type Files struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is optional, client certificates are not requested without it
+	ClientCAFile string
+}
+
+// Reloader struct keeps the server certificate and client CAs loaded from Files, a changed file is picked up
+// by the next handshake at most interval after the change
+type Reloader struct {
+	files             Files
+	interval          time.Duration
+	requireClientCert bool
+
+	mu        sync.Mutex
+	config    *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+// NewReloader creates a new Reloader, loading the files for the first time.
+// Clients must present a certificate if requireClientCert is set, otherwise one is verified if presented
+func NewReloader(files Files, interval time.Duration, requireClientCert bool) (*Reloader, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("certificate and key files must be set")
+	}
+	if requireClientCert && files.ClientCAFile == "" {
+		return nil, errors.New("client certificates cannot be required without a client CA file")
+	}
+	r := &Reloader{files: files, interval: interval, requireClientCert: requireClientCert}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	config, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.config, r.modTimes, r.checkedAt = config, modTimes, time.Now()
+	return r, nil
+}
+
+// ServerConfig function returns a TLS configuration which serves the latest loaded files
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// current function returns the configuration of the latest files, reloading them if they changed.
+// Files which fail to load are logged and the previous configuration is kept
+func (r *Reloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checkedAt) < r.interval {
+		return r.config
+	}
+	r.checkedAt = time.Now()
+	modTimes, err := r.stat()
+	if err != nil {
+		logrus.Errorf("mtls: %v", err)
+		return r.config
+	}
+	if equalTimes(modTimes, r.modTimes) {
+		return r.config
+	}
+	config, err := r.load()
+	if err != nil {
+		logrus.Errorf("mtls: cannot reload certificates: %v", err)
+		return r.config
+	}
+	r.config, r.modTimes = config, modTimes
+	logrus.Info("mtls: certificates reloaded")
+	return r.config
+}
+
+// load function reads the files into a new TLS configuration
+func (r *Reloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("LoadX509KeyPair: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.NoClientCert,
+	}
+	if r.files.ClientCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(r.files.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile: %w", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", r.files.ClientCAFile)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if r.requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// stat function returns modification times of the files
+func (r *Reloader) stat() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("Stat: %w", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// PeerCertificate function returns a verified client certificate of the call, ok is false if the client has none
+func PeerCertificate(ctx context.Context) (cert *x509.Certificate, ok bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return info.State.VerifiedChains[0][0], true
+}
+
+// Identities function returns identities of the certificate in order of preference:
+// URI SANs, DNS SANs and the common name
+func Identities(cert *x509.Certificate) []string {
+	identities := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+1)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, cert.DNSNames...)
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	return identities
+}
@@ -0,0 +1,171 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// testCA struct issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue function returns a PEM encoded certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	require.NoError(t, os.WriteFile(name, data, 0o600))
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+}
+
+// handshake function connects a client to a server configured by serverConfig and returns the server side state
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	clientErr := make(chan error, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+		if err == nil {
+			// a client rejected by the server learns about it from the first read in TLS 1.3,
+			// an accepted one reads the close notification
+			_, err = conn.Read(make([]byte, 1))
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			conn.Close()
+		}
+		clientErr <- err
+	}()
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	server := tls.Server(conn, serverConfig)
+	err = server.Handshake()
+	if err != nil {
+		conn.Close()
+		<-clientErr
+		return tls.ConnectionState{}, err
+	}
+	state := server.ConnectionState()
+	server.Close()
+	return state, <-clientErr
+}
+
+func TestReloaderVerifiesClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := Files{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server.key"), ClientCAFile: filepath.Join(dir, "ca.pem")}
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{DNSNames: []string{"profile.internal"}})
+	writeFile(t, files.CertFile, certPEM, time.Now())
+	writeFile(t, files.KeyFile, keyPEM, time.Now())
+	writeFile(t, files.ClientCAFile, ca.pem, time.Now())
+
+	reloader, err := NewReloader(files, time.Minute, true)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	clientCertPEM, clientKeyPEM := ca.issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "billing"},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "corp", Path: "/billing"}},
+	})
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	require.NoError(t, err)
+	state, err := handshake(t, reloader.ServerConfig(), &tls.Config{ServerName: "profile.internal", RootCAs: roots, Certificates: []tls.Certificate{clientCert}})
+	require.NoError(t, err)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	cert, ok := PeerCertificate(ctx)
+	require.True(t, ok)
+	require.Equal(t, []string{"spiffe://corp/billing", "billing"}, Identities(cert))
+
+	_, err = handshake(t, reloader.ServerConfig(), &tls.Config{ServerName: "profile.internal", RootCAs: roots})
+	require.Error(t, err)
+
+	_, ok = PeerCertificate(context.Background())
+	require.False(t, ok)
+}
+
+func TestReloaderPicksUpChangedFiles(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := Files{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server.key")}
+	modTime := time.Now().Add(-time.Hour)
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{DNSNames: []string{"old.internal"}})
+	writeFile(t, files.CertFile, certPEM, modTime)
+	writeFile(t, files.KeyFile, keyPEM, modTime)
+
+	reloader, err := NewReloader(files, 0, false)
+	require.NoError(t, err)
+	servedName := func() string {
+		leaf, err := x509.ParseCertificate(reloader.current().Certificates[0].Certificate[0])
+		require.NoError(t, err)
+		return leaf.DNSNames[0]
+	}
+	require.Equal(t, "old.internal", servedName())
+
+	// a half written pair is not picked up, the previous certificate is kept
+	newCertPEM, newKeyPEM := ca.issue(t, &x509.Certificate{DNSNames: []string{"new.internal"}})
+	writeFile(t, files.CertFile, newCertPEM, modTime.Add(time.Minute))
+	require.Equal(t, "old.internal", servedName())
+
+	writeFile(t, files.KeyFile, newKeyPEM, modTime.Add(time.Minute))
+	require.Equal(t, "new.internal", servedName())
+
+	_, err = NewReloader(Files{CertFile: files.CertFile, KeyFile: files.KeyFile}, 0, true)
+	require.Error(t, err)
+}
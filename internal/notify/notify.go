@@ -0,0 +1,87 @@
+// Package notify delivers messages, such as password reset tokens, to profile owners
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Message struct represents a single message to a profile owner
+type Message struct {
+	ProfileID uuid.UUID `json:"profile_id"`
+	// To is an address of the recipient
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier interface delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// LogNotifier struct writes messages to a logrus logger, it is meant for development only.
+// The body is logged as a field rather than the message text, it carries secrets such as reset tokens
+type LogNotifier struct {
+	logger logrus.FieldLogger
+}
+
+// NewLogNotifier creates a new LogNotifier
+func NewLogNotifier(logger logrus.FieldLogger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Notify implements Notifier interface
+func (n *LogNotifier) Notify(_ context.Context, msg *Message) error {
+	n.logger.WithFields(logrus.Fields{
+		"profile_id": msg.ProfileID,
+		"to":         msg.To,
+		"subject":    msg.Subject,
+		"body":       msg.Body,
+	}).Info("notification")
+	return nil
+}
+
+// FileNotifier struct appends messages to a file as JSON lines
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier creates a new FileNotifier
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+// fileRecord struct represents a single line of the FileNotifier output
+type fileRecord struct {
+	*Message
+	Time time.Time `json:"time"`
+}
+
+// Notify implements Notifier interface
+func (n *FileNotifier) Notify(_ context.Context, msg *Message) error {
+	line, err := json.Marshal(fileRecord{Message: msg, Time: time.Now()})
+	if err != nil {
+		return fmt.Errorf("Marshal: %w", err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("OpenFile: %w", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("Write: %w", err)
+	}
+	return file.Close()
+}
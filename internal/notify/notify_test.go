@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	notifier := NewFileNotifier(path)
+	for _, subject := range []string{"first", "second"} {
+		err := notifier.Notify(context.Background(), &Message{ProfileID: uuid.New(), To: "user@example.com", Subject: subject, Body: "body"})
+		require.NoError(t, err)
+	}
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	var subjects []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		msg := &Message{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), msg))
+		subjects = append(subjects, msg.Subject)
+	}
+	require.Equal(t, []string{"first", "second"}, subjects)
+}
+
+func TestLogNotifierKeepsBodyOutOfMessage(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	err := NewLogNotifier(logger).Notify(context.Background(), &Message{ProfileID: uuid.New(), To: "user@example.com", Subject: "reset", Body: "token: secret-token"})
+	require.NoError(t, err)
+	require.Len(t, hook.Entries, 1)
+	require.NotContains(t, hook.LastEntry().Message, "secret-token")
+	require.Equal(t, "token: secret-token", hook.LastEntry().Data["body"])
+}
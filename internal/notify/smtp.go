@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier struct sends messages as plain text emails
+type SMTPNotifier struct {
+	// Addr is host:port of the SMTP server
+	Addr string
+	From string
+	// Auth is optional, net/smtp refuses to send credentials over an unencrypted connection to a remote host
+	Auth smtp.Auth
+}
+
+// Notify implements Notifier interface, the SMTP dialogue is aborted once ctx is done
+func (n *SMTPNotifier) Notify(ctx context.Context, msg *Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", msg.To)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return fmt.Errorf("DialContext: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks a pending read or write of the dialogue
+			_ = conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("SplitHostPort: %w", err)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("NewClient: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+	err = n.send(client, host, msg)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("send: %w", ctx.Err())
+		}
+		return fmt.Errorf("send: %w", err)
+	}
+	return nil
+}
+
+// send function runs the SMTP dialogue of smtp.SendMail on the client
+func (n *SMTPNotifier) send(client *smtp.Client, host string, msg *Message) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err := client.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err != nil {
+			return fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	if n.Auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("server does not support AUTH")
+		}
+		err := client.Auth(n.Auth)
+		if err != nil {
+			return fmt.Errorf("Auth: %w", err)
+		}
+	}
+	err := client.Mail(n.From)
+	if err != nil {
+		return fmt.Errorf("Mail: %w", err)
+	}
+	err = client.Rcpt(msg.To)
+	if err != nil {
+		return fmt.Errorf("Rcpt: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("Data: %w", err)
+	}
+	_, err = w.Write(n.compose(msg))
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("Close: %w", err)
+	}
+	return client.Quit()
+}
+
+// compose function renders the message as an RFC 5322 email
+func (n *SMTPNotifier) compose(msg *Message) []byte {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		host = "localhost"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%d@%s>\r\n", time.Now().UnixNano(), host)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
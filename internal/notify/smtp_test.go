@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPMail struct represents an email received by the fake SMTP server
+type fakeSMTPMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// startFakeSMTP function serves a minimal SMTP dialogue on a local port and reports every received email
+func startFakeSMTP(t *testing.T) (string, <-chan *fakeSMTPMail) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+	mails := make(chan *fakeSMTPMail, 1)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeSMTP(conn, mails)
+		}
+	}()
+	return lis.Addr().String(), mails
+}
+
+func serveFakeSMTP(conn net.Conn, mails chan<- *fakeSMTPMail) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost fake SMTP")
+	mail := &fakeSMTPMail{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		switch upper := strings.ToUpper(cmd); {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			mail.From = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			mail.To = append(mail.To, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			mail.Data = data.String()
+			mails <- mail
+			mail = &fakeSMTPMail{}
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mails := startFakeSMTP(t)
+	notifier := &SMTPNotifier{Addr: addr, From: "profile@example.com"}
+
+	err := notifier.Notify(context.Background(), &Message{
+		ProfileID: uuid.New(),
+		To:        "user@example.com",
+		Subject:   "Password reset",
+		Body:      "Your reset token is abc\nIt expires in an hour",
+	})
+	require.NoError(t, err)
+
+	mail := <-mails
+	require.Equal(t, "profile@example.com", mail.From)
+	require.Equal(t, []string{"user@example.com"}, mail.To)
+	require.Contains(t, mail.Data, "Subject: Password reset\r\n")
+	require.Contains(t, mail.Data, "Your reset token is abc\r\nIt expires in an hour")
+}
+
+func TestSMTPNotifierRejectsHeaderInjection(t *testing.T) {
+	notifier := &SMTPNotifier{Addr: "127.0.0.1:1", From: "profile@example.com"}
+	err := notifier.Notify(context.Background(), &Message{To: "user@example.com\r\nBcc: victim@example.com"})
+	require.Error(t, err)
+}
+
+func TestSMTPNotifierHonoursContext(t *testing.T) {
+	// the server accepts connections but never greets
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = lis.Close() }()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	notifier := &SMTPNotifier{Addr: lis.Addr().String(), From: "profile@example.com"}
+	start := time.Now()
+	err = notifier.Notify(ctx, &Message{ProfileID: uuid.New(), To: "user@example.com", Subject: "subject", Body: "body"})
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
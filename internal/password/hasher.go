@@ -0,0 +1,201 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported hashing algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// BcryptMaxLength is the longest password in bytes bcrypt accepts
+const BcryptMaxLength = 72
+
+// ErrUnknownAlgorithm is returned when an encoded hash was produced by an unsupported algorithm
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+
+// Hasher interface represents a password hashing algorithm producing self-describing encoded hashes
+type Hasher interface {
+	// Algorithm returns a name of the algorithm
+	Algorithm() string
+	// Hash returns an encoded hash of the password, including algorithm and parameters
+	Hash(password []byte) ([]byte, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(encoded, password []byte) (bool, error)
+	// NeedsRehash reports whether the encoded hash was produced with other parameters
+	NeedsRehash(encoded []byte) bool
+}
+
+// BcryptHasher struct hashes passwords with bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+// Algorithm implements Hasher interface
+func (h *BcryptHasher) Algorithm() string {
+	return AlgorithmBcrypt
+}
+
+// Hash implements Hasher interface
+func (h *BcryptHasher) Hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, h.Cost)
+}
+
+// Verify implements Hasher interface
+func (h *BcryptHasher) Verify(encoded, password []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(encoded, password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("CompareHashAndPassword: %w", err)
+	}
+	return true, nil
+}
+
+// NeedsRehash implements Hasher interface
+func (h *BcryptHasher) NeedsRehash(encoded []byte) bool {
+	cost, err := bcrypt.Cost(encoded)
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher struct hashes passwords with argon2id and encodes them in PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Algorithm implements Hasher interface
+func (h *Argon2idHasher) Algorithm() string {
+	return AlgorithmArgon2id
+}
+
+// Hash implements Hasher interface
+func (h *Argon2idHasher) Hash(password []byte) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	key := argon2.IDKey(password, salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+// Verify implements Hasher interface
+func (h *Argon2idHasher) Verify(encoded, password []byte) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey(password, params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// NeedsRehash implements Hasher interface
+func (h *Argon2idHasher) NeedsRehash(encoded []byte) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.Memory || params.iterations != h.Iterations || params.parallelism != h.Parallelism ||
+		uint32(len(params.salt)) != h.SaltLength || uint32(len(params.key)) != h.KeyLength
+}
+
+func decodeArgon2id(encoded []byte) (*argon2idParams, error) {
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	params := &argon2idParams{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	return params, nil
+}
+
+// Manager struct hashes new passwords with the configured hasher and verifies hashes of every supported algorithm
+type Manager struct {
+	current Hasher
+	hashers map[string]Hasher
+}
+
+// NewManager creates a new Manager, hashing new passwords with current
+func NewManager(current Hasher) *Manager {
+	hashers := map[string]Hasher{
+		AlgorithmBcrypt:   &BcryptHasher{Cost: bcrypt.DefaultCost},
+		AlgorithmArgon2id: &Argon2idHasher{},
+	}
+	hashers[current.Algorithm()] = current
+	return &Manager{current: current, hashers: hashers}
+}
+
+// Hash function hashes the password with the configured hasher
+func (m *Manager) Hash(password []byte) ([]byte, error) {
+	return m.current.Hash(password)
+}
+
+// Verify function checks the password against an encoded hash of any supported algorithm.
+// rehash is true when the password matches but the hash is outdated and must be replaced
+func (m *Manager) Verify(encoded, password []byte) (ok, rehash bool, err error) {
+	algorithm := Identify(encoded)
+	hasher, known := m.hashers[algorithm]
+	if !known {
+		return false, false, ErrUnknownAlgorithm
+	}
+	ok, err = hasher.Verify(encoded, password)
+	if err != nil || !ok {
+		return false, false, err
+	}
+	return true, algorithm != m.current.Algorithm() || m.current.NeedsRehash(encoded), nil
+}
+
+// Identify function returns an algorithm of the encoded hash, or an empty string if it is unknown
+func Identify(encoded []byte) string {
+	switch {
+	case bytes.HasPrefix(encoded, []byte("$2a$")), bytes.HasPrefix(encoded, []byte("$2b$")), bytes.HasPrefix(encoded, []byte("$2y$")):
+		return AlgorithmBcrypt
+	case bytes.HasPrefix(encoded, []byte("$argon2id$")):
+		return AlgorithmArgon2id
+	default:
+		return ""
+	}
+}
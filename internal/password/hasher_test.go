@@ -0,0 +1,81 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testBcrypt   = &BcryptHasher{Cost: 4}
+	testArgon2id = &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	testPassword = []byte("Correct-h0rse")
+)
+
+func TestHashers(t *testing.T) {
+	for _, hasher := range []Hasher{testBcrypt, testArgon2id} {
+		t.Run(hasher.Algorithm(), func(t *testing.T) {
+			encoded, err := hasher.Hash(testPassword)
+			require.NoError(t, err)
+			require.Equal(t, hasher.Algorithm(), Identify(encoded))
+			require.False(t, hasher.NeedsRehash(encoded))
+
+			ok, err := hasher.Verify(encoded, testPassword)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			ok, err = hasher.Verify(encoded, []byte("wrong"))
+			require.NoError(t, err)
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	encoded, err := testArgon2id.Hash(testPassword)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(encoded), "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	stronger := *testArgon2id
+	stronger.Iterations = 2
+	require.True(t, stronger.NeedsRehash(encoded))
+	ok, err := stronger.Verify(encoded, testPassword)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestManagerRehash(t *testing.T) {
+	bcryptHash, err := testBcrypt.Hash(testPassword)
+	require.NoError(t, err)
+
+	manager := NewManager(testArgon2id)
+	ok, rehash, err := manager.Verify(bcryptHash, testPassword)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, rehash)
+
+	ok, rehash, err = manager.Verify(bcryptHash, []byte("wrong"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.False(t, rehash)
+
+	argonHash, err := manager.Hash(testPassword)
+	require.NoError(t, err)
+	ok, rehash, err = manager.Verify(argonHash, testPassword)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, rehash)
+
+	manager = NewManager(&BcryptHasher{Cost: 5})
+	ok, rehash, err = manager.Verify(bcryptHash, testPassword)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, rehash)
+}
+
+func TestManagerUnknownAlgorithm(t *testing.T) {
+	manager := NewManager(testBcrypt)
+	_, _, err := manager.Verify([]byte("plaintext"), testPassword)
+	require.ErrorIs(t, err, ErrUnknownAlgorithm)
+}
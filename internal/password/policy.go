@@ -0,0 +1,106 @@
+// Package password contains password policy and hashing
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/eugenshima/profile/internal/model"
+)
+
+// field is a name of the request field reported in policy violations
+const field = "Password"
+
+// Policy struct represents a set of rules every new password must satisfy
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Blocklist contains lowercased breached or common passwords
+	Blocklist map[string]struct{}
+}
+
+// LoadBlocklist function reads a list of forbidden passwords, one per line.
+// Empty lines and lines starting with # are skipped
+func LoadBlocklist(path string) (map[string]struct{}, error) {
+	blocklist := make(map[string]struct{})
+	if path == "" {
+		return blocklist, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan: %w", err)
+	}
+	return blocklist, nil
+}
+
+// Validate function checks the password against the policy and returns every violation at once
+func (p *Policy) Validate(password string) error {
+	verr := &model.ValidationError{}
+	violate := func(description string) {
+		verr.Violations = append(verr.Violations, model.FieldViolation{Field: field, Description: description})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violate(fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violate(fmt.Sprintf("must be at most %d bytes long", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violate("must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violate("must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violate("must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violate("must contain a symbol")
+	}
+	if _, ok := p.Blocklist[strings.ToLower(password)]; ok {
+		violate("is too common or known to be breached")
+	}
+
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = &Policy{
+	MinLength:     8,
+	MaxLength:     72,
+	RequireUpper:  true,
+	RequireLower:  true,
+	RequireDigit:  true,
+	RequireSymbol: true,
+	Blocklist:     map[string]struct{}{"p@ssw0rd!": {}},
+}
+
+func TestValidate(t *testing.T) {
+	err := testPolicy.Validate("Correct-h0rse")
+	require.NoError(t, err)
+}
+
+func TestValidateListsEveryViolation(t *testing.T) {
+	err := testPolicy.Validate("abc")
+	require.ErrorIs(t, err, model.ErrInvalidArgument)
+
+	var verr *model.ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Len(t, verr.Violations, 4)
+	for _, v := range verr.Violations {
+		require.Equal(t, "Password", v.Field)
+	}
+}
+
+func TestValidateTooLong(t *testing.T) {
+	long := make([]byte, 73)
+	for i := range long {
+		long[i] = 'a'
+	}
+	err := testPolicy.Validate("A1-" + string(long))
+	require.ErrorIs(t, err, model.ErrInvalidArgument)
+}
+
+func TestValidateBlocklist(t *testing.T) {
+	err := testPolicy.Validate("P@ssw0rd!")
+	var verr *model.ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Len(t, verr.Violations, 1)
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "common.txt")
+	err := os.WriteFile(path, []byte("# common passwords\nQwerty123\n\n  letmein  \n"), 0o600)
+	require.NoError(t, err)
+
+	blocklist, err := LoadBlocklist(path)
+	require.NoError(t, err)
+	require.Len(t, blocklist, 2)
+	require.Contains(t, blocklist, "qwerty123")
+	require.Contains(t, blocklist, "letmein")
+
+	blocklist, err = LoadBlocklist("")
+	require.NoError(t, err)
+	require.Empty(t, blocklist)
+}
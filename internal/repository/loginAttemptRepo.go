@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/lockout"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// LoginAttemptRepository represents a PostgreSQL store of failed login attempts shared by every replica
+type LoginAttemptRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewLoginAttemptRepository creates a new LoginAttemptRepository
+func NewLoginAttemptRepository(pool *pgxpool.Pool) *LoginAttemptRepository {
+	return &LoginAttemptRepository{pool: pool}
+}
+
+// Get function returns failed attempts of the key
+func (db *LoginAttemptRepository) Get(ctx context.Context, key string) (*lockout.Attempts, error) {
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	var lockedUntil *time.Time
+	attempts := &lockout.Attempts{}
+	err = tx.QueryRow(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM profile.login_attempts WHERE key=$1", key,
+	).Scan(&attempts.Failures, &attempts.LastFailureAt, &lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+		return attempts, nil
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	if lockedUntil != nil {
+		attempts.LockedUntil = *lockedUntil
+	}
+	return attempts, nil
+}
+
+// AddFailure function counts a failure of the key in a single upsert, so concurrent replicas never lose a failure
+func (db *LoginAttemptRepository) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (counted *lockout.Attempts, err error) {
+	// read committed lets concurrent upserts of the same key wait for each other instead of failing to serialize
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			counted, err = nil, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	var lockedUntil *time.Time
+	attempts := &lockout.Attempts{}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO profile.login_attempts AS a (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN GREATEST(a.last_failure_at, COALESCE(a.locked_until, a.last_failure_at)) < $2 - make_interval(secs => $3) THEN 1
+				ELSE a.failures + 1
+			END,
+			locked_until = CASE
+				WHEN GREATEST(a.last_failure_at, COALESCE(a.locked_until, a.last_failure_at)) < $2 - make_interval(secs => $3) THEN NULL
+				ELSE a.locked_until
+			END,
+			last_failure_at = $2
+		RETURNING failures, last_failure_at, locked_until`,
+		key, now, window.Seconds(),
+	).Scan(&attempts.Failures, &attempts.LastFailureAt, &lockedUntil)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	if lockedUntil != nil {
+		attempts.LockedUntil = *lockedUntil
+	}
+	return attempts, nil
+}
+
+// Lock function locks the key until the given time
+func (db *LoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) (err error) {
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	_, err = tx.Exec(ctx,
+		`INSERT INTO profile.login_attempts (key, failures, last_failure_at, locked_until) VALUES ($1, 0, now(), $2)
+		ON CONFLICT (key) DO UPDATE SET locked_until = GREATEST(profile.login_attempts.locked_until, EXCLUDED.locked_until)`,
+		key, until,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// Reset function deletes failed attempts of the key
+func (db *LoginAttemptRepository) Reset(ctx context.Context, key string) (err error) {
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	_, err = tx.Exec(ctx, "DELETE FROM profile.login_attempts WHERE key=$1", key)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
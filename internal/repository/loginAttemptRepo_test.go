@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginAttempts(t *testing.T) {
+	attemptRps := NewLoginAttemptRepository(rps.pool)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Microsecond)
+	defer func() {
+		err := attemptRps.Reset(ctx, "account:test_login")
+		require.NoError(t, err)
+	}()
+
+	attempts, err := attemptRps.Get(ctx, "account:test_login")
+	require.NoError(t, err)
+	require.Zero(t, attempts.Failures)
+
+	for i := 1; i <= 2; i++ {
+		attempts, err = attemptRps.AddFailure(ctx, "account:test_login", now, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, i, attempts.Failures)
+	}
+	err = attemptRps.Lock(ctx, "account:test_login", now.Add(time.Minute))
+	require.NoError(t, err)
+	attempts, err = attemptRps.Get(ctx, "account:test_login")
+	require.NoError(t, err)
+	require.True(t, attempts.LockedUntil.Equal(now.Add(time.Minute)))
+
+	// the count restarts after a quiet window following the lock
+	attempts, err = attemptRps.AddFailure(ctx, "account:test_login", now.Add(3*time.Minute), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+	require.True(t, attempts.LockedUntil.IsZero())
+}
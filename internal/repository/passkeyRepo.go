@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// CreateWebAuthnChallenge function stores a new challenge, expired challenges are removed on the way
+func (db *ProfileRepository) CreateWebAuthnChallenge(ctx context.Context, challenge *model.WebAuthnChallenge) (err error) {
+	ctx, done := db.instrument(ctx, "CreateWebAuthnChallenge")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	_, err = tx.Exec(ctx, "DELETE FROM profile.webauthn_challenges WHERE expires_at < now()")
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO profile.webauthn_challenges (challenge_hash, ceremony, profile_id, expires_at) VALUES ($1, $2, $3, $4)",
+		challenge.Hash, challenge.Ceremony, uuid.NullUUID{UUID: challenge.ProfileID, Valid: challenge.ProfileID != uuid.Nil}, challenge.ExpiresAt,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		err = model.NewNotFoundError("Profile")
+		return fmt.Errorf("exec: %w", err)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// UseWebAuthnChallenge function uses up an unexpired challenge of the ceremony and returns its profile, which is uuid.Nil for logins.
+// ErrInvalidToken is returned if the challenge is unknown, expired or already used
+func (db *ProfileRepository) UseWebAuthnChallenge(ctx context.Context, ceremony string, hash []byte) (profileID uuid.UUID, err error) {
+	ctx, done := db.instrument(ctx, "UseWebAuthnChallenge")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			profileID, err = uuid.Nil, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	var owner uuid.NullUUID
+	err = tx.QueryRow(ctx,
+		`UPDATE profile.webauthn_challenges SET used_at=now()
+		WHERE challenge_hash=$1 AND ceremony=$2 AND used_at IS NULL AND expires_at > now()
+		RETURNING profile_id`, hash, ceremony,
+	).Scan(&owner)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure) {
+		return uuid.Nil, fmt.Errorf("QueryRow: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return uuid.Nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return owner.UUID, nil
+}
+
+// SavePasskey function stores a new credential of the profile
+func (db *ProfileRepository) SavePasskey(ctx context.Context, passkey *model.Passkey) (err error) {
+	ctx, done := db.instrument(ctx, "SavePasskey")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	_, err = tx.Exec(ctx,
+		"INSERT INTO profile.passkeys (credential_id, profile_id, public_key, aaguid, sign_count) VALUES ($1, $2, $3, $4, $5)",
+		passkey.CredentialID, passkey.ProfileID, passkey.PublicKey, passkey.AAGUID, passkey.SignCount,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return fmt.Errorf("exec: %w", model.NewAlreadyExistsError("Passkey"))
+	}
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// passkeyColumns lists columns scanned by scanPasskey
+const passkeyColumns = "credential_id, profile_id, public_key, aaguid, sign_count, created_at, last_used_at"
+
+// scanPasskey function scans a row of passkeyColumns
+func scanPasskey(row pgx.Row, passkey *model.Passkey) error {
+	return row.Scan(&passkey.CredentialID, &passkey.ProfileID, &passkey.PublicKey, &passkey.AAGUID,
+		&passkey.SignCount, &passkey.CreatedAt, &passkey.LastUsedAt)
+}
+
+// GetPasskey function returns a credential by its ID
+func (db *ProfileRepository) GetPasskey(ctx context.Context, credentialID []byte) (*model.Passkey, error) {
+	ctx, done := db.instrument(ctx, "GetPasskey")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	passkey := &model.Passkey{}
+	err = scanPasskey(tx.QueryRow(ctx, "SELECT "+passkeyColumns+" FROM profile.passkeys WHERE credential_id=$1", credentialID), passkey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("Passkey"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return passkey, nil
+}
+
+// ListPasskeys function returns credentials of the profile, the oldest first
+func (db *ProfileRepository) ListPasskeys(ctx context.Context, profileID uuid.UUID) ([]*model.Passkey, error) {
+	ctx, done := db.instrument(ctx, "ListPasskeys")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	rows, err := tx.Query(ctx, "SELECT "+passkeyColumns+" FROM profile.passkeys WHERE profile_id=$1 ORDER BY created_at", profileID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Query: %v", err)
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var passkeys []*model.Passkey
+	for rows.Next() {
+		passkey := &model.Passkey{}
+		err = scanPasskey(rows, passkey)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Scan: %v", err)
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	err = rows.Err()
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Rows: %v", err)
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return passkeys, nil
+}
+
+// UsePasskey function records a login by the credential with a new signature counter.
+// ErrInvalidCredentials is returned if the counter did not grow since, authenticators without a counter always report zero
+func (db *ProfileRepository) UsePasskey(ctx context.Context, credentialID []byte, signCount int64) (err error) {
+	ctx, done := db.instrument(ctx, "UsePasskey")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx,
+		`UPDATE profile.passkeys SET sign_count=$2, last_used_at=now()
+		WHERE credential_id=$1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))`,
+		credentialID, signCount,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure {
+		// the same assertion is being used concurrently
+		return fmt.Errorf("exec: %w", model.ErrInvalidCredentials)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.ErrInvalidCredentials)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebAuthnChallenge(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	registration := &model.WebAuthnChallenge{Hash: []byte("registration"), Ceremony: "webauthn.create", ProfileID: testProfile.ID, ExpiresAt: time.Now().Add(time.Minute)}
+	err = rps.CreateWebAuthnChallenge(context.Background(), registration)
+	require.NoError(t, err)
+	login := &model.WebAuthnChallenge{Hash: []byte("login"), Ceremony: "webauthn.get", ExpiresAt: time.Now().Add(time.Minute)}
+	err = rps.CreateWebAuthnChallenge(context.Background(), login)
+	require.NoError(t, err)
+
+	// challenges are bound to their ceremony
+	_, err = rps.UseWebAuthnChallenge(context.Background(), "webauthn.get", registration.Hash)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+	id, err := rps.UseWebAuthnChallenge(context.Background(), "webauthn.create", registration.Hash)
+	require.NoError(t, err)
+	require.Equal(t, testProfile.ID, id)
+	_, err = rps.UseWebAuthnChallenge(context.Background(), "webauthn.create", registration.Hash)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	id, err = rps.UseWebAuthnChallenge(context.Background(), "webauthn.get", login.Hash)
+	require.NoError(t, err)
+	require.Equal(t, uuid.Nil, id)
+}
+
+func TestPasskey(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	passkey := &model.Passkey{CredentialID: []byte("credential"), ProfileID: testProfile.ID, PublicKey: []byte("cose"), AAGUID: make([]byte, 16)}
+	err = rps.SavePasskey(context.Background(), passkey)
+	require.NoError(t, err)
+	err = rps.SavePasskey(context.Background(), passkey)
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+
+	passkeys, err := rps.ListPasskeys(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+
+	err = rps.UsePasskey(context.Background(), passkey.CredentialID, 5)
+	require.NoError(t, err)
+	err = rps.UsePasskey(context.Background(), passkey.CredentialID, 5)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+	stored, err := rps.GetPasskey(context.Background(), passkey.CredentialID)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), stored.SignCount)
+	require.NotNil(t, stored.LastUsedAt)
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// CreatePasswordReset function stores a new reset token of the profile, outstanding tokens of the profile stop working.
+// ErrLocked is returned if a reset of the profile was created within cooldown
+func (db *ProfileRepository) CreatePasswordReset(ctx context.Context, reset *model.PasswordReset, cooldown time.Duration) (err error) {
+	ctx, done := db.instrument(ctx, "CreatePasswordReset")
+	defer done()
+	// read committed lets concurrent requests of the profile see each other's reset after waiting for its row lock
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	_, err = tx.Exec(ctx, "SELECT 1 FROM profile.profile WHERE id=$1 FOR UPDATE", reset.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	var recent bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM profile.password_resets WHERE profile_id=$1 AND created_at > now() - make_interval(secs => $2))",
+		reset.ProfileID, cooldown.Seconds(),
+	).Scan(&recent)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return fmt.Errorf("QueryRow: %w", err)
+	}
+	if recent {
+		return fmt.Errorf("QueryRow: %w", model.ErrLocked)
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM profile.password_resets WHERE profile_id=$1 AND used_at IS NULL", reset.ProfileID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO profile.password_resets (id, profile_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		reset.ID, reset.ProfileID, reset.Hash, reset.ExpiresAt,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword function uses up an unexpired reset token, replaces the password of its profile and revokes every session
+// of the profile in one transaction, revoked is a number of revoked sessions.
+// ErrInvalidToken is returned if the token is unknown, expired or already used
+func (db *ProfileRepository) ResetPassword(ctx context.Context, tokenHash, password []byte) (profileID uuid.UUID, revoked int64, err error) {
+	ctx, done := db.instrument(ctx, "ResetPassword")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return uuid.Nil, 0, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			profileID, revoked, err = uuid.Nil, 0, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	err = tx.QueryRow(ctx,
+		`UPDATE profile.password_resets SET used_at=now()
+		WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+		RETURNING profile_id`, tokenHash,
+	).Scan(&profileID)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure) {
+		// unknown, expired, used or being used concurrently
+		err = model.ErrInvalidToken
+		return uuid.Nil, 0, fmt.Errorf("QueryRow: %w", err)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return uuid.Nil, 0, fmt.Errorf("QueryRow: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE profile.profile SET password=$1, credentials_version=credentials_version+1, version=version+1, updated_at=now() WHERE id=$2",
+		password, profileID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return uuid.Nil, 0, fmt.Errorf("exec: %w", err)
+	}
+	revoked, err = revokeSessions(ctx, tx, profileID, uuid.Nil)
+	if err != nil {
+		return uuid.Nil, 0, fmt.Errorf("revokeSessions: %w", err)
+	}
+	return profileID, revoked, nil
+}
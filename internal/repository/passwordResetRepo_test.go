@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetPassword(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	outdated := &model.PasswordReset{ID: uuid.New(), ProfileID: testProfile.ID, Hash: []byte("outdated_reset"), ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.CreatePasswordReset(context.Background(), outdated, 0)
+	require.NoError(t, err)
+	reset := &model.PasswordReset{ID: uuid.New(), ProfileID: testProfile.ID, Hash: []byte("reset_hash"), ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.CreatePasswordReset(context.Background(), reset, 0)
+	require.NoError(t, err)
+	// a reset within the cooldown neither replaces the last one nor is stored
+	throttled := &model.PasswordReset{ID: uuid.New(), ProfileID: testProfile.ID, Hash: []byte("throttled_reset"), ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.CreatePasswordReset(context.Background(), throttled, time.Minute)
+	require.ErrorIs(t, err, model.ErrLocked)
+	err = rps.SaveRefreshToken(context.Background(), &model.UpdateTokens{ID: testProfile.ID, RefreshToken: []byte("reset_session_hash"), ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	// a newer request replaces outstanding tokens
+	_, _, err = rps.ResetPassword(context.Background(), outdated.Hash, []byte("new_password_hash"))
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+	_, _, err = rps.ResetPassword(context.Background(), throttled.Hash, []byte("new_password_hash"))
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	id, revoked, err := rps.ResetPassword(context.Background(), reset.Hash, []byte("new_password_hash"))
+	require.NoError(t, err)
+	require.Equal(t, testProfile.ID, id)
+	require.Equal(t, int64(1), revoked)
+	stored, err := rps.GetRefreshToken(context.Background(), []byte("reset_session_hash"))
+	require.NoError(t, err)
+	require.NotNil(t, stored.RevokedAt)
+	_, pass, err := rps.GetIDByLoginPassword(context.Background(), testProfile.Login)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new_password_hash"), pass)
+
+	_, _, err = rps.ResetPassword(context.Background(), reset.Hash, []byte("another_hash"))
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+}
@@ -3,49 +3,97 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/eugenshima/profile/internal/logging"
 	"github.com/eugenshima/profile/internal/model"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// profileColumns is a list of columns scanned by scanProfile
+const profileColumns = "id, login, password, username, email, email_verified_at, created_at, updated_at, version, credentials_version"
+
+// scanProfile function scans a row of profileColumns
+func scanProfile(row pgx.Row, profile *model.Profile) error {
+	return row.Scan(&profile.ID, &profile.Login, &profile.Password, &profile.Username, &profile.Email, &profile.EmailVerifiedAt,
+		&profile.CreatedAt, &profile.UpdatedAt, &profile.Version, &profile.CredentialsVersion)
+}
+
+// tracer creates spans of repository queries
+var tracer = otel.Tracer("github.com/eugenshima/profile/internal/repository")
+
 // ProfileRepository represents a repository level
 type ProfileRepository struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	queries QueryObserver
 }
 
-// NewProfileRepository creates a new ProfileRepository
-func NewProfileRepository(pool *pgxpool.Pool) *ProfileRepository {
-	return &ProfileRepository{pool: pool}
+// QueryObserver interface receives durations of repository queries named after the methods running them
+type QueryObserver interface {
+	ObserveQuery(query string, duration time.Duration)
+}
+
+// NewProfileRepository creates a new ProfileRepository, queries may be nil
+func NewProfileRepository(pool *pgxpool.Pool, queries QueryObserver) *ProfileRepository {
+	return &ProfileRepository{pool: pool, queries: queries}
+}
+
+// instrument function starts a span of the named query and returns a function ending it and reporting the duration,
+// every method starts with it. Statements of the query are traced as children of the span by the connection logger
+func (db *ProfileRepository) instrument(ctx context.Context, query string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "ProfileRepository."+query, trace.WithAttributes(semconv.DBSystemPostgreSQL))
+	return ctx, func() {
+		span.End()
+		if db.queries != nil {
+			db.queries.ObserveQuery(query, time.Since(start))
+		}
+	}
 }
 
+// GetIDByLoginPassword function returns an ID and a password hash of the profile with the given login or verified email.
+// A login match wins over an email match
 func (db *ProfileRepository) GetIDByLoginPassword(ctx context.Context, login string) (ID uuid.UUID, pass []byte, err error) {
+	ctx, done := db.instrument(ctx, "GetIDByLoginPassword")
+	defer done()
 	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
 	if err != nil {
 		return uuid.Nil, nil, fmt.Errorf("BeginTx: %w", err)
 	}
 	defer func() {
 		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				logrus.Errorf("Rollback: %v", err)
-				return
-			}
-		} else {
-			err = tx.Commit(ctx)
-			if err != nil {
-				logrus.Errorf("Commit: %v", err)
-				return
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
 			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
 		}
 	}()
 
-	err = tx.QueryRow(ctx, "SELECT id, password FROM profile.profile WHERE login=$1", login).Scan(&ID, &pass)
+	err = tx.QueryRow(ctx,
+		`SELECT id, password FROM profile.profile
+		WHERE login=$1 OR (lower(email)=lower($1) AND email_verified_at IS NOT NULL)
+		ORDER BY login=$1 DESC LIMIT 1`, login,
+	).Scan(&ID, &pass)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("Profile"))
+	}
 	if err != nil {
-		logrus.Errorf("QueryRow: %v", err)
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
 		return uuid.Nil, nil, fmt.Errorf("QueryRow: %w", err)
 	}
 	return ID, pass, nil
@@ -53,6 +101,8 @@ func (db *ProfileRepository) GetIDByLoginPassword(ctx context.Context, login str
 
 // GetProfileByID function returns a profile with the given ID
 func (db *ProfileRepository) GetProfileByID(ctx context.Context, id uuid.UUID) (*model.Profile, error) {
+	ctx, done := db.instrument(ctx, "GetProfileByID")
+	defer done()
 	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
 	if err != nil {
 		return nil, fmt.Errorf("BeginTx: %w", err)
@@ -61,110 +111,324 @@ func (db *ProfileRepository) GetProfileByID(ctx context.Context, id uuid.UUID) (
 		if err != nil {
 			err = tx.Rollback(ctx)
 			if err != nil {
-				logrus.Errorf("Rollback: %v", err)
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
 				return
 			}
 		} else {
 			err = tx.Commit(ctx)
 			if err != nil {
-				logrus.Errorf("Commit: %v", err)
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
 				return
 			}
 		}
 	}()
 	profile := &model.Profile{}
-	err = tx.QueryRow(ctx, "SELECT id, login, password, refresh_token, username FROM profile.profile WHERE id = $1", id).Scan(&profile.ID, &profile.Login, &profile.Password, &profile.RefreshToken, &profile.Username)
+	err = scanProfile(tx.QueryRow(ctx, "SELECT "+profileColumns+" FROM profile.profile WHERE id = $1", id), profile)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("Profile"))
+	}
 	if err != nil {
-		logrus.Errorf("QueryRow: %v", err)
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
 		return nil, fmt.Errorf("QueryRow: %w", err)
 	}
 	return profile, nil
 }
 
-// CreateProfile function creates a new profile in database
-func (db *ProfileRepository) CreateProfile(ctx context.Context, profile *model.Profile) error {
-	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+// CreateProfile function creates a new profile in database with the user role.
+// ErrAlreadyExists is returned if the login is a login or a verified email of another profile
+func (db *ProfileRepository) CreateProfile(ctx context.Context, profile *model.Profile) (err error) {
+	ctx, done := db.instrument(ctx, "CreateProfile")
+	defer done()
+	// read committed, see claimLoginName
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
 	if err != nil {
 		return fmt.Errorf("BeginTx: %w", err)
 	}
 	defer func() {
 		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				logrus.Errorf("Rollback: %v", err)
-				return
-			}
-		} else {
-			err = tx.Commit(ctx)
-			if err != nil {
-				logrus.Errorf("Commit: %v", err)
-				return
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
 			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
 		}
 	}()
-	_, err = db.pool.Exec(ctx, "INSERT INTO profile.profile (id, login, password, username) VALUES ($1, $2, $3, $4)", profile.ID, profile.Login, profile.Password, profile.Username)
+	err = claimLoginName(ctx, tx, profile.ID, verifiedEmailTaken, profile.Login)
+	if err != nil {
+		return fmt.Errorf("claimLoginName: %w", err)
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO profile.profile (id, login, password, username, email) VALUES ($1, $2, $3, $4, $5)",
+		profile.ID, profile.Login, profile.Password, profile.Username, profile.Email)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return fmt.Errorf("exec: %w", model.NewAlreadyExistsError("Profile"))
+	}
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
+	_, err = tx.Exec(ctx, "INSERT INTO profile.profile_roles (profile_id, role) VALUES ($1, $2)", profile.ID, model.RoleUser)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
 	return nil
 }
 
-// UpdateProfile function updates the profile information in database
-func (db *ProfileRepository) SaveRefreshToken(ctx context.Context, profile *model.UpdateTokens) error {
+// UpdateProfile function updates set fields of the profile and returns the updated profile.
+// ErrVersionMismatch is returned if the profile exists with a version other than the expected one,
+// ErrAlreadyExists if the new login is a login or a verified email of another profile
+func (db *ProfileRepository) UpdateProfile(ctx context.Context, update *model.ProfileUpdate) (updated *model.Profile, err error) {
+	ctx, done := db.instrument(ctx, "UpdateProfile")
+	defer done()
+	// read committed, see claimLoginName
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			updated, err = nil, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	if update.Login != nil {
+		err = claimLoginName(ctx, tx, update.ID, verifiedEmailTaken, *update.Login)
+		if err != nil {
+			return nil, fmt.Errorf("claimLoginName: %w", err)
+		}
+	}
+	profile := &model.Profile{}
+	err = scanProfile(tx.QueryRow(ctx,
+		`UPDATE profile.profile SET login=COALESCE($1, login), username=COALESCE($2, username),
+			email_verified_at=CASE WHEN $3::varchar IS NOT NULL AND $3 <> email THEN NULL ELSE email_verified_at END,
+			email=COALESCE($3, email), updated_at=now(), version=version+1
+		WHERE id=$4 AND ($5=0 OR version=$5)
+		RETURNING `+profileColumns,
+		update.Login, update.Username, update.Email, update.ID, update.Version,
+	), profile)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return nil, fmt.Errorf("QueryRow: %w", model.NewAlreadyExistsError("Profile"))
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", missingOrStale(ctx, tx, update.ID))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return profile, nil
+}
+
+// missingOrStale function tells why a conditional write of the profile matched no rows
+func missingOrStale(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	var exists bool
+	err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM profile.profile WHERE id=$1)", id).Scan(&exists)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return err
+	}
+	if exists {
+		return model.ErrVersionMismatch
+	}
+	return model.NewNotFoundError("Profile")
+}
+
+// loginNamesLockID is a key of the transaction level advisory lock serializing writes of logins and verified emails
+const loginNamesLockID = 872316
+
+const (
+	// verifiedEmailTaken checks whether a name is a verified email of another profile
+	verifiedEmailTaken = "SELECT EXISTS(SELECT 1 FROM profile.profile WHERE id<>$1 AND lower(email)=lower($2) AND email_verified_at IS NOT NULL)"
+	// loginTaken checks whether a name is a login of another profile
+	loginTaken = "SELECT EXISTS(SELECT 1 FROM profile.profile WHERE id<>$1 AND lower(login)=lower($2))"
+)
+
+// claimLoginName function returns ErrAlreadyExists if the taken query finds the name in use by another profile.
+// Logins and verified emails both identify a profile on login, so a login may not be a verified email of another
+// profile and the other way round. The check holds the login names lock until tx ends, tx must be read committed
+// for the check to see names committed while waiting for the lock
+func claimLoginName(ctx context.Context, tx pgx.Tx, id uuid.UUID, taken, name string) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", loginNamesLockID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("pg_advisory_xact_lock: %v", err)
+		return fmt.Errorf("pg_advisory_xact_lock: %w", err)
+	}
+	var exists bool
+	err = tx.QueryRow(ctx, taken, id, name).Scan(&exists)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return fmt.Errorf("QueryRow: %w", err)
+	}
+	if exists {
+		return model.NewAlreadyExistsError("Profile")
+	}
+	return nil
+}
+
+// UpdatePassword function replaces the password hash of the profile with a rehash of the same password,
+// it keeps the version so a login does not invalidate etags held by clients
+func (db *ProfileRepository) UpdatePassword(ctx context.Context, id uuid.UUID, password []byte) (err error) {
+	ctx, done := db.instrument(ctx, "UpdatePassword")
+	defer done()
 	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
 	if err != nil {
 		return fmt.Errorf("BeginTx: %w", err)
 	}
 	defer func() {
 		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				logrus.Errorf("Rollback: %v", err)
-				return
-			}
-		} else {
-			err = tx.Commit(ctx)
-			if err != nil {
-				logrus.Errorf("Commit: %v", err)
-				return
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
 			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
 		}
 	}()
-	tag, err := tx.Exec(
-		ctx,
-		"UPDATE profile.profile SET refresh_token=$1 WHERE id=$2",
-		profile.RefreshToken, profile.ID,
-	)
-	if err != nil || tag.RowsAffected() == 0 {
-		logrus.Errorf("Exec: %v", err)
+	tag, err := tx.Exec(ctx, "UPDATE profile.profile SET password=$1, updated_at=now() WHERE id=$2", password, id)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
 		return fmt.Errorf("exec: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
 	return nil
 }
 
-func (db *ProfileRepository) DeleteProfileByID(ctx context.Context, id uuid.UUID) error {
+// ChangePassword function replaces the password hash of the profile on behalf of its owner, bumping the credentials version.
+// Every session except exceptID is revoked in the same transaction, revoked is a number of revoked sessions
+func (db *ProfileRepository) ChangePassword(ctx context.Context, id uuid.UUID, password []byte, exceptID uuid.UUID) (revoked int64, err error) {
+	ctx, done := db.instrument(ctx, "ChangePassword")
+	defer done()
 	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
 	if err != nil {
-		return fmt.Errorf("BeginTx: %w", err)
+		return 0, fmt.Errorf("BeginTx: %w", err)
 	}
 	defer func() {
 		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				logrus.Errorf("Rollback: %v", err)
-				return
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
 			}
-		} else {
-			err = tx.Commit(ctx)
-			if err != nil {
-				logrus.Errorf("Commit: %v", err)
-				return
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			revoked, err = 0, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx, "UPDATE profile.profile SET password=$1, credentials_version=credentials_version+1, version=version+1, updated_at=now() WHERE id=$2", password, id)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return 0, fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
+	revoked, err = revokeSessions(ctx, tx, id, exceptID)
+	if err != nil {
+		return 0, fmt.Errorf("revokeSessions: %w", err)
+	}
+	return revoked, nil
+}
+
+// DeleteProfileByID function deletes the profile if it has the expected version, zero version skips the check
+func (db *ProfileRepository) DeleteProfileByID(ctx context.Context, id uuid.UUID, version int64) (err error) {
+	ctx, done := db.instrument(ctx, "DeleteProfileByID")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
 			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
 		}
 	}()
-	tag, err := tx.Exec(ctx, "DELETE FROM profile.profile WHERE id=$1", id)
-	if err != nil || tag.RowsAffected() == 0 {
+	tag, err := tx.Exec(ctx, "DELETE FROM profile.profile WHERE id=$1 AND ($2=0 OR version=$2)", id, version)
+	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", missingOrStale(ctx, tx, id))
+	}
 	return nil
 }
+
+// MarkEmailVerified function marks the email of the profile as verified if it is still the given one.
+// ErrInvalidToken is returned if the profile has another email by now, ErrAlreadyExists if the email is a login
+// or a verified email of another profile
+func (db *ProfileRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (verified *model.Profile, err error) {
+	ctx, done := db.instrument(ctx, "MarkEmailVerified")
+	defer done()
+	// read committed, see claimLoginName
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			verified, err = nil, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	err = claimLoginName(ctx, tx, id, loginTaken, email)
+	if err != nil {
+		return nil, fmt.Errorf("claimLoginName: %w", err)
+	}
+	profile := &model.Profile{}
+	err = scanProfile(tx.QueryRow(ctx,
+		`UPDATE profile.profile SET email_verified_at=COALESCE(email_verified_at, now()), version=version+1, updated_at=now()
+		WHERE id=$1 AND email=$2 AND email <> ''
+		RETURNING `+profileColumns, id, email,
+	), profile)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		// another profile has verified the same email first
+		return nil, fmt.Errorf("QueryRow: %w", model.NewAlreadyExistsError("Profile"))
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return profile, nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/eugenshima/profile/internal/model"
 	"github.com/google/uuid"
@@ -13,10 +14,9 @@ var rps *ProfileRepository
 
 var (
 	testProfile = &model.Profile{
-		ID:           uuid.New(),
-		Login:        "test_login",
-		Password:     []byte("test_password"),
-		RefreshToken: []byte("test_token"),
+		ID:       uuid.New(),
+		Login:    "test_login",
+		Password: []byte("test_password"),
 	}
 	testAuth = &model.Auth{
 		Login:    "test_login",
@@ -60,7 +60,7 @@ func TestGetIdByWrongLoginPassword(t *testing.T) {
 	}()
 
 	id, _, err := rps.GetIDByLoginPassword(context.Background(), "fake login")
-	require.NoError(t, err)
+	require.ErrorIs(t, err, model.ErrNotFound)
 	require.Equal(t, id, uuid.Nil)
 }
 
@@ -89,7 +89,7 @@ func TestGetProfileByWrongID(t *testing.T) {
 	}()
 
 	profile, err := rps.GetProfileByID(context.Background(), uuid.New())
-	require.Error(t, err)
+	require.ErrorIs(t, err, model.ErrNotFound)
 	require.Nil(t, profile)
 }
 
@@ -114,5 +114,300 @@ func TestSaveRefreshTokenError(t *testing.T) {
 	}()
 	testUpdateToken.ID = uuid.New()
 	err = rps.SaveRefreshToken(context.Background(), testUpdateToken)
-	require.Error(t, err)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestCreateProfileAlreadyExists(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+
+	duplicate := *testProfile
+	duplicate.ID = uuid.New()
+	err = rps.CreateProfile(context.Background(), &duplicate)
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+}
+
+func TestUpdatePassword(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+
+	before, err := rps.GetProfileByID(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	newHash := []byte("new_password_hash")
+	err = rps.UpdatePassword(context.Background(), testProfile.ID, newHash)
+	require.NoError(t, err)
+	_, pass, err := rps.GetIDByLoginPassword(context.Background(), testProfile.Login)
+	require.NoError(t, err)
+	require.Equal(t, newHash, pass)
+	after, err := rps.GetProfileByID(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Equal(t, before.Version, after.Version)
+	require.True(t, after.UpdatedAt.After(before.UpdatedAt))
+
+	err = rps.UpdatePassword(context.Background(), uuid.New(), newHash)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	other := &model.Profile{ID: uuid.New(), Login: "other_login", Password: []byte("test_password")}
+	err = rps.CreateProfile(context.Background(), other)
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+		err = DeleteTestProfile(other.ID)
+		require.NoError(t, err)
+	}()
+
+	username := "new_username"
+	updated, err := rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Username: &username})
+	require.NoError(t, err)
+	require.Equal(t, username, updated.Username)
+	require.Equal(t, testProfile.Login, updated.Login)
+
+	login := other.Login
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Login: &login})
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: uuid.New(), Username: &username})
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestUpdateProfileVersion(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	profile, err := rps.GetProfileByID(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+
+	username := "first_writer"
+	updated, err := rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Username: &username, Version: profile.Version})
+	require.NoError(t, err)
+	require.Equal(t, profile.Version+1, updated.Version)
+
+	username = "second_writer"
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Username: &username, Version: profile.Version})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+	err = rps.DeleteProfileByID(context.Background(), testProfile.ID, profile.Version)
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+}
+
+func TestChangePassword(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	current := &model.UpdateTokens{ID: testProfile.ID, RefreshToken: []byte("kept_session_hash"), ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.SaveRefreshToken(context.Background(), current)
+	require.NoError(t, err)
+	err = rps.SaveRefreshToken(context.Background(), &model.UpdateTokens{ID: testProfile.ID, RefreshToken: []byte("revoked_session_hash"), ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	before, err := rps.GetProfileByID(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+
+	// the password and the revocation of other sessions are written together
+	revoked, err := rps.ChangePassword(context.Background(), testProfile.ID, []byte("changed_password_hash"), current.FamilyID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), revoked)
+	sessions, err := rps.ListSessions(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, current.FamilyID, sessions[0].ID)
+	after, err := rps.GetProfileByID(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("changed_password_hash"), after.Password)
+	require.Equal(t, before.CredentialsVersion+1, after.CredentialsVersion)
+	require.Equal(t, before.Version+1, after.Version)
+
+	_, err = rps.ChangePassword(context.Background(), uuid.New(), []byte("changed_password_hash"), uuid.Nil)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestVerifiedEmailLogin(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	email := "Owner@example.com"
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Email: &email})
+	require.NoError(t, err)
+	_, _, err = rps.GetIDByLoginPassword(context.Background(), "owner@example.com")
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	verified, err := rps.MarkEmailVerified(context.Background(), testProfile.ID, email)
+	require.NoError(t, err)
+	require.NotNil(t, verified.EmailVerifiedAt)
+	id, _, err := rps.GetIDByLoginPassword(context.Background(), "owner@example.com")
+	require.NoError(t, err)
+	require.Equal(t, testProfile.ID, id)
+
+	// changing the email resets its verification
+	email = "new@example.com"
+	updated, err := rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Email: &email})
+	require.NoError(t, err)
+	require.Nil(t, updated.EmailVerifiedAt)
+	_, err = rps.MarkEmailVerified(context.Background(), testProfile.ID, "Owner@example.com")
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+}
+
+func TestLoginAndVerifiedEmailCollision(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	email := "victim@example.com"
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Email: &email})
+	require.NoError(t, err)
+	_, err = rps.MarkEmailVerified(context.Background(), testProfile.ID, email)
+	require.NoError(t, err)
+
+	// a login may not be a verified email of another profile
+	attacker := &model.Profile{ID: uuid.New(), Login: "Victim@example.com", Password: []byte("test_password")}
+	err = rps.CreateProfile(context.Background(), attacker)
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+	attacker.Login = "attacker_login"
+	err = rps.CreateProfile(context.Background(), attacker)
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(attacker.ID)
+		require.NoError(t, err)
+	}()
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: attacker.ID, Login: &email})
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+	id, _, err := rps.GetIDByLoginPassword(context.Background(), email)
+	require.NoError(t, err)
+	require.Equal(t, testProfile.ID, id)
+
+	// an email may not be verified if it is a login of another profile
+	attackerEmail := "Attacker_Login"
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Email: &attackerEmail})
+	require.NoError(t, err)
+	_, err = rps.MarkEmailVerified(context.Background(), testProfile.ID, attackerEmail)
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+
+	// a profile may use its own verified email as the login
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Email: &email})
+	require.NoError(t, err)
+	_, err = rps.MarkEmailVerified(context.Background(), testProfile.ID, email)
+	require.NoError(t, err)
+	_, err = rps.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: testProfile.ID, Login: &email})
+	require.NoError(t, err)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	err = rps.SaveRefreshToken(context.Background(), &model.UpdateTokens{
+		ID:           testProfile.ID,
+		RefreshToken: []byte("old_hash"),
+		Device:       "test_device",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	old, err := rps.GetRefreshToken(context.Background(), []byte("old_hash"))
+	require.NoError(t, err)
+	require.Equal(t, testProfile.ID, old.ProfileID)
+	require.Nil(t, old.RotatedAt)
+
+	newToken := &model.UpdateTokens{ID: testProfile.ID, FamilyID: old.FamilyID, RefreshToken: []byte("new_hash"), ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.RotateRefreshToken(context.Background(), old.ID, newToken)
+	require.NoError(t, err)
+	old, err = rps.GetRefreshToken(context.Background(), []byte("old_hash"))
+	require.NoError(t, err)
+	require.NotNil(t, old.RotatedAt)
+
+	newToken.RefreshToken = []byte("another_hash")
+	err = rps.RotateRefreshToken(context.Background(), old.ID, newToken)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestRevokeSession(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	familyToken := &model.UpdateTokens{ID: testProfile.ID, RefreshToken: []byte("family_hash"), Device: "test_device", ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.SaveRefreshToken(context.Background(), familyToken)
+	require.NoError(t, err)
+	sessions, err := rps.ListSessions(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, familyToken.FamilyID, sessions[0].ID)
+	require.Equal(t, "test_device", sessions[0].Device)
+	state, err := rps.GetSessionState(context.Background(), familyToken.FamilyID)
+	require.NoError(t, err)
+	require.Equal(t, testProfile.ID, state.ProfileID)
+	require.Nil(t, state.RevokedAt)
+	require.Equal(t, int64(1), state.CredentialsVersion)
+
+	// sessions of other profiles are left alone
+	err = rps.RevokeSession(context.Background(), uuid.New(), familyToken.FamilyID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+	err = rps.RevokeSession(context.Background(), testProfile.ID, familyToken.FamilyID)
+	require.NoError(t, err)
+	stored, err := rps.GetRefreshToken(context.Background(), []byte("family_hash"))
+	require.NoError(t, err)
+	require.NotNil(t, stored.RevokedAt)
+	sessions, err = rps.ListSessions(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+	state, err = rps.GetSessionState(context.Background(), familyToken.FamilyID)
+	require.NoError(t, err)
+	require.NotNil(t, state.RevokedAt)
+	_, err = rps.GetSessionState(context.Background(), uuid.New())
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	err = rps.RevokeSession(context.Background(), uuid.Nil, familyToken.FamilyID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+	_, err = rps.GetRefreshToken(context.Background(), []byte("unknown_hash"))
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	current := &model.UpdateTokens{ID: testProfile.ID, RefreshToken: []byte("current_hash"), ExpiresAt: time.Now().Add(time.Hour)}
+	err = rps.SaveRefreshToken(context.Background(), current)
+	require.NoError(t, err)
+	for _, hash := range []string{"other_hash", "another_hash"} {
+		err = rps.SaveRefreshToken(context.Background(), &model.UpdateTokens{ID: testProfile.ID, RefreshToken: []byte(hash), ExpiresAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+	}
+
+	revoked, err := rps.RevokeAllSessions(context.Background(), testProfile.ID, current.FamilyID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), revoked)
+	sessions, err := rps.ListSessions(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, current.FamilyID, sessions[0].ID)
 }
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// SaveRefreshToken function stores a refresh token hash of the profile, starting a new session if no token family is given
+func (db *ProfileRepository) SaveRefreshToken(ctx context.Context, profile *model.UpdateTokens) (err error) {
+	ctx, done := db.instrument(ctx, "SaveRefreshToken")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	if profile.FamilyID == uuid.Nil {
+		profile.FamilyID = uuid.New()
+		_, err = tx.Exec(ctx,
+			"INSERT INTO profile.sessions (id, profile_id, device, user_agent, client_ip) VALUES ($1, $2, $3, $4, $5)",
+			profile.FamilyID, profile.ID, profile.Device, profile.UserAgent, profile.ClientIP,
+		)
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO profile.refresh_tokens (id, family_id, profile_id, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5)",
+			uuid.New(), profile.FamilyID, profile.ID, profile.RefreshToken, profile.ExpiresAt,
+		)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken function returns a stored refresh token by its hash
+func (db *ProfileRepository) GetRefreshToken(ctx context.Context, hash []byte) (*model.RefreshToken, error) {
+	ctx, done := db.instrument(ctx, "GetRefreshToken")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	refreshToken := &model.RefreshToken{}
+	err = tx.QueryRow(ctx,
+		`SELECT id, family_id, profile_id, token_hash, created_at, expires_at, rotated_at, revoked_at
+		FROM profile.refresh_tokens WHERE token_hash=$1`, hash,
+	).Scan(&refreshToken.ID, &refreshToken.FamilyID, &refreshToken.ProfileID, &refreshToken.Hash,
+		&refreshToken.CreatedAt, &refreshToken.ExpiresAt, &refreshToken.RotatedAt, &refreshToken.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("RefreshToken"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return refreshToken, nil
+}
+
+// RotateRefreshToken function marks an active refresh token as rotated and stores its successor in the same family.
+// ErrNotFound is returned if the old token was already rotated or revoked
+func (db *ProfileRepository) RotateRefreshToken(ctx context.Context, oldID uuid.UUID, newToken *model.UpdateTokens) (err error) {
+	ctx, done := db.instrument(ctx, "RotateRefreshToken")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx,
+		"UPDATE profile.refresh_tokens SET rotated_at=now() WHERE id=$1 AND rotated_at IS NULL AND revoked_at IS NULL",
+		oldID,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure {
+		// the token was rotated by a concurrent transaction
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("RefreshToken"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		err = model.NewNotFoundError("RefreshToken")
+		return fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO profile.refresh_tokens (id, family_id, profile_id, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		uuid.New(), newToken.FamilyID, newToken.ID, newToken.RefreshToken, newToken.ExpiresAt,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx, "UPDATE profile.sessions SET last_used_at=now() WHERE id=$1", newToken.FamilyID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// ListProfileRoles function returns roles of the profile with their permissions, ordered by name
+func (db *ProfileRepository) ListProfileRoles(ctx context.Context, profileID uuid.UUID) ([]*model.Role, error) {
+	ctx, done := db.instrument(ctx, "ListProfileRoles")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	rows, err := tx.Query(ctx,
+		`SELECT r.name, r.description, COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM profile.profile_roles pr
+		JOIN profile.roles r ON r.name=pr.role
+		LEFT JOIN profile.role_permissions rp ON rp.role=r.name
+		WHERE pr.profile_id=$1
+		GROUP BY r.name, r.description
+		ORDER BY r.name`, profileID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Query: %v", err)
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var roles []*model.Role
+	for rows.Next() {
+		role := &model.Role{}
+		err = rows.Scan(&role.Name, &role.Description, &role.Permissions)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Scan: %v", err)
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	err = rows.Err()
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Rows: %v", err)
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return roles, nil
+}
+
+// AssignRole function assigns the role to the profile, assigning a role twice is not an error.
+// ErrNotFound is returned if either the profile or the role does not exist
+func (db *ProfileRepository) AssignRole(ctx context.Context, profileID uuid.UUID, role string) (err error) {
+	ctx, done := db.instrument(ctx, "AssignRole")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	_, err = tx.Exec(ctx,
+		"INSERT INTO profile.profile_roles (profile_id, role) VALUES ($1, $2) ON CONFLICT (profile_id, role) DO NOTHING",
+		profileID, role,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation && pgErr.ConstraintName == "profile_roles_role_fkey" {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Role"))
+	}
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// RevokeRole function removes the role from the profile, ErrNotFound is returned if the profile does not have it
+func (db *ProfileRepository) RevokeRole(ctx context.Context, profileID uuid.UUID, role string) (err error) {
+	ctx, done := db.instrument(ctx, "RevokeRole")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx, "DELETE FROM profile.profile_roles WHERE profile_id=$1 AND role=$2", profileID, role)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Role"))
+	}
+	return nil
+}
+
+// RolePermissions function returns permissions of every role by its name
+func (db *ProfileRepository) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	ctx, done := db.instrument(ctx, "RolePermissions")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	rows, err := tx.Query(ctx, "SELECT role, permission FROM profile.role_permissions ORDER BY role, permission")
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Query: %v", err)
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	permissions := make(map[string][]string)
+	for rows.Next() {
+		var role, permission string
+		err = rows.Scan(&role, &permission)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Scan: %v", err)
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		permissions[role] = append(permissions[role], permission)
+	}
+	err = rows.Err()
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Rows: %v", err)
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return permissions, nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoles(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	roles, err := rps.ListProfileRoles(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	require.Equal(t, model.RoleUser, roles[0].Name)
+	require.Contains(t, roles[0].Permissions, "profile:delete:self")
+
+	err = rps.AssignRole(context.Background(), testProfile.ID, model.RoleAdmin)
+	require.NoError(t, err)
+	err = rps.AssignRole(context.Background(), testProfile.ID, model.RoleAdmin)
+	require.NoError(t, err)
+	err = rps.AssignRole(context.Background(), testProfile.ID, "unknown")
+	require.ErrorIs(t, err, model.ErrNotFound)
+	var resourceErr *model.ResourceError
+	require.True(t, errors.As(err, &resourceErr))
+	require.Equal(t, "Role", resourceErr.Resource)
+	roles, err = rps.ListProfileRoles(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Len(t, roles, 2)
+
+	err = rps.RevokeRole(context.Background(), testProfile.ID, model.RoleAdmin)
+	require.NoError(t, err)
+	err = rps.RevokeRole(context.Background(), testProfile.ID, model.RoleAdmin)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	permissions, err := rps.RolePermissions(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, permissions[model.RoleAdmin], "profile:delete:any")
+	require.NotContains(t, permissions[model.RoleUser], "profile:delete:any")
+}
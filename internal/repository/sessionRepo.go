@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+// ListSessions function returns active sessions of the profile, most recently used first
+func (db *ProfileRepository) ListSessions(ctx context.Context, profileID uuid.UUID) ([]*model.Session, error) {
+	ctx, done := db.instrument(ctx, "ListSessions")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	rows, err := tx.Query(ctx,
+		`SELECT s.id, s.profile_id, s.device, s.user_agent, s.client_ip, s.created_at, s.last_used_at, s.revoked_at
+		FROM profile.sessions s
+		WHERE s.profile_id=$1 AND s.revoked_at IS NULL AND EXISTS (
+			SELECT 1 FROM profile.refresh_tokens t
+			WHERE t.family_id=s.id AND t.rotated_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > now()
+		)
+		ORDER BY s.last_used_at DESC`, profileID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Query: %v", err)
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var sessions []*model.Session
+	for rows.Next() {
+		session := &model.Session{}
+		err = rows.Scan(&session.ID, &session.ProfileID, &session.Device, &session.UserAgent, &session.ClientIP,
+			&session.CreatedAt, &session.LastUsedAt, &session.RevokedAt)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Scan: %v", err)
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Rows: %v", err)
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return sessions, nil
+}
+
+// GetSessionState function returns a state of the session whether or not it is revoked,
+// together with the current credentials version of its profile
+func (db *ProfileRepository) GetSessionState(ctx context.Context, id uuid.UUID) (state *model.SessionState, err error) {
+	ctx, done := db.instrument(ctx, "GetSessionState")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			state, err = nil, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	state = &model.SessionState{}
+	err = tx.QueryRow(ctx,
+		`SELECT s.profile_id, s.revoked_at, p.credentials_version
+		FROM profile.sessions s JOIN profile.profile p ON p.id=s.profile_id WHERE s.id=$1`, id,
+	).Scan(&state.ProfileID, &state.RevokedAt, &state.CredentialsVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("Session"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return state, nil
+}
+
+// RevokeSession function revokes an active session of the profile together with its refresh tokens,
+// uuid.Nil profileID revokes the session of any profile
+func (db *ProfileRepository) RevokeSession(ctx context.Context, profileID, id uuid.UUID) (err error) {
+	ctx, done := db.instrument(ctx, "RevokeSession")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx, `UPDATE profile.sessions SET revoked_at=now()
+		WHERE id=$1 AND revoked_at IS NULL AND ($2::uuid IS NULL OR profile_id=$2)`,
+		id, uuid.NullUUID{UUID: profileID, Valid: profileID != uuid.Nil},
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Session"))
+	}
+	_, err = tx.Exec(ctx, "UPDATE profile.refresh_tokens SET revoked_at=now() WHERE family_id=$1 AND revoked_at IS NULL", id)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions function revokes every active session of the profile except the given one
+// and returns a number of revoked sessions
+func (db *ProfileRepository) RevokeAllSessions(ctx context.Context, profileID, exceptID uuid.UUID) (revoked int64, err error) {
+	ctx, done := db.instrument(ctx, "RevokeAllSessions")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return 0, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			revoked, err = 0, fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	revoked, err = revokeSessions(ctx, tx, profileID, exceptID)
+	if err != nil {
+		return 0, fmt.Errorf("revokeSessions: %w", err)
+	}
+	return revoked, nil
+}
+
+// revokeSessions function revokes every active session of the profile except the given one together with
+// their refresh tokens in tx and returns a number of revoked sessions
+func revokeSessions(ctx context.Context, tx pgx.Tx, profileID, exceptID uuid.UUID) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		"UPDATE profile.sessions SET revoked_at=now() WHERE profile_id=$1 AND id<>$2 AND revoked_at IS NULL",
+		profileID, exceptID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return 0, fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE profile.refresh_tokens SET revoked_at=now() WHERE profile_id=$1 AND family_id<>$2 AND revoked_at IS NULL",
+		profileID, exceptID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return 0, fmt.Errorf("exec: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
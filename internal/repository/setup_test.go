@@ -6,6 +6,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/eugenshima/profile/internal/migrator"
+	"github.com/eugenshima/profile/migration"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/ory/dockertest"
@@ -41,6 +43,14 @@ func SetupTestPgx() (*pgxpool.Pool, func(), error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect pgxpool: %w", err)
 	}
+	mgr, err := migrator.NewMigrator(dbpool, migration.FS)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	_, err = mgr.Up(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
 	cleanup := func() {
 		dbpool.Close()
 		pool.Purge(resource)
@@ -57,7 +67,7 @@ func TestMain(m *testing.M) {
 		cleanupPgx()
 		os.Exit(1)
 	}
-	rps = NewProfileRepository(dbpool)
+	rps = NewProfileRepository(dbpool, nil)
 
 	exitVal := m.Run()
 	cleanupPgx()
@@ -73,7 +83,7 @@ func CreateTestProfile() error {
 }
 
 func DeleteTestProfile(id uuid.UUID) error {
-	err := rps.DeleteProfileByID(context.Background(), id)
+	err := rps.DeleteProfileByID(context.Background(), id, 0)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// SaveTOTP function stores a new unconfirmed authenticator of the profile, replacing an unconfirmed one.
+// ErrAlreadyExists is returned if the profile already has a confirmed authenticator
+func (db *ProfileRepository) SaveTOTP(ctx context.Context, totp *model.TOTP) (err error) {
+	ctx, done := db.instrument(ctx, "SaveTOTP")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO profile.totp (profile_id, secret) VALUES ($1, $2)
+		ON CONFLICT (profile_id) DO UPDATE SET secret=EXCLUDED.secret, last_used_step=0, created_at=now()
+		WHERE profile.totp.confirmed_at IS NULL`,
+		totp.ProfileID, totp.Secret,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return fmt.Errorf("exec: %w", model.NewNotFoundError("Profile"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.NewAlreadyExistsError("TOTP"))
+	}
+	return nil
+}
+
+// GetTOTP function returns the authenticator of the profile
+func (db *ProfileRepository) GetTOTP(ctx context.Context, profileID uuid.UUID) (*model.TOTP, error) {
+	ctx, done := db.instrument(ctx, "GetTOTP")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = tx.Rollback(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", err)
+				return
+			}
+		} else {
+			err = tx.Commit(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("Commit: %v", err)
+				return
+			}
+		}
+	}()
+	totp := &model.TOTP{}
+	err = tx.QueryRow(ctx,
+		"SELECT profile_id, secret, confirmed_at, last_used_step, created_at FROM profile.totp WHERE profile_id=$1", profileID,
+	).Scan(&totp.ProfileID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep, &totp.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("TOTP"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("QueryRow: %v", err)
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	return totp, nil
+}
+
+// ConfirmTOTP function confirms the unconfirmed authenticator of the profile by a code of the time step
+// and replaces recovery codes of the profile with the given hashes in one transaction.
+// ErrNotFound is returned if the profile has no unconfirmed authenticator
+func (db *ProfileRepository) ConfirmTOTP(ctx context.Context, profileID uuid.UUID, step int64, recoveryHashes [][]byte) (err error) {
+	ctx, done := db.instrument(ctx, "ConfirmTOTP")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx,
+		"UPDATE profile.totp SET confirmed_at=now(), last_used_step=$2 WHERE profile_id=$1 AND confirmed_at IS NULL",
+		profileID, step,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure {
+		// confirmed or replaced concurrently
+		err = model.NewNotFoundError("TOTP")
+		return fmt.Errorf("exec: %w", err)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		err = model.NewNotFoundError("TOTP")
+		return fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM profile.recovery_codes WHERE profile_id=$1", profileID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	for _, hash := range recoveryHashes {
+		_, err = tx.Exec(ctx, "INSERT INTO profile.recovery_codes (profile_id, code_hash) VALUES ($1, $2)", profileID, hash)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Exec: %v", err)
+			return fmt.Errorf("exec: %w", err)
+		}
+	}
+	return nil
+}
+
+// UseTOTPStep function records that a code of the time step was accepted.
+// ErrInvalidCredentials is returned if a code of the same or a later step was accepted before
+func (db *ProfileRepository) UseTOTPStep(ctx context.Context, profileID uuid.UUID, step int64) (err error) {
+	ctx, done := db.instrument(ctx, "UseTOTPStep")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx,
+		"UPDATE profile.totp SET last_used_step=$2 WHERE profile_id=$1 AND confirmed_at IS NOT NULL AND last_used_step < $2",
+		profileID, step,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure {
+		// the same code is being used concurrently
+		return fmt.Errorf("exec: %w", model.ErrInvalidCredentials)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.ErrInvalidCredentials)
+	}
+	return nil
+}
+
+// UseRecoveryCode function uses up an unused recovery code of the profile.
+// ErrInvalidCredentials is returned if the code is unknown or already used
+func (db *ProfileRepository) UseRecoveryCode(ctx context.Context, profileID uuid.UUID, hash []byte) (err error) {
+	ctx, done := db.instrument(ctx, "UseRecoveryCode")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx,
+		"UPDATE profile.recovery_codes SET used_at=now() WHERE profile_id=$1 AND code_hash=$2 AND used_at IS NULL",
+		profileID, hash,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.SerializationFailure {
+		return fmt.Errorf("exec: %w", model.ErrInvalidCredentials)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exec: %w", model.ErrInvalidCredentials)
+	}
+	return nil
+}
+
+// DeleteTOTP function removes the authenticator and recovery codes of the profile
+func (db *ProfileRepository) DeleteTOTP(ctx context.Context, profileID uuid.UUID) (err error) {
+	ctx, done := db.instrument(ctx, "DeleteTOTP")
+	defer done()
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "repeatable read"})
+	if err != nil {
+		return fmt.Errorf("BeginTx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			errRollback := tx.Rollback(ctx)
+			if errRollback != nil {
+				logging.FromContext(ctx).Errorf("Rollback: %v", errRollback)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("Commit: %v", err)
+			err = fmt.Errorf("Commit: %w", err)
+		}
+	}()
+	tag, err := tx.Exec(ctx, "DELETE FROM profile.totp WHERE profile_id=$1", profileID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		err = model.NewNotFoundError("TOTP")
+		return fmt.Errorf("exec: %w", err)
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM profile.recovery_codes WHERE profile_id=$1", profileID)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Exec: %v", err)
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
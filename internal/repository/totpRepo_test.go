@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	err := CreateTestProfile()
+	require.NoError(t, err)
+	defer func() {
+		err = DeleteTestProfile(testProfile.ID)
+		require.NoError(t, err)
+	}()
+	err = rps.SaveTOTP(context.Background(), &model.TOTP{ProfileID: testProfile.ID, Secret: []byte("sealed_secret")})
+	require.NoError(t, err)
+	totp, err := rps.GetTOTP(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	require.Nil(t, totp.ConfirmedAt)
+
+	err = rps.ConfirmTOTP(context.Background(), testProfile.ID, 100, [][]byte{[]byte("recovery_hash")})
+	require.NoError(t, err)
+	err = rps.SaveTOTP(context.Background(), &model.TOTP{ProfileID: testProfile.ID, Secret: []byte("another_secret")})
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+
+	// codes of the confirming step and earlier ones are replays
+	err = rps.UseTOTPStep(context.Background(), testProfile.ID, 100)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+	err = rps.UseTOTPStep(context.Background(), testProfile.ID, 101)
+	require.NoError(t, err)
+
+	err = rps.UseRecoveryCode(context.Background(), testProfile.ID, []byte("recovery_hash"))
+	require.NoError(t, err)
+	err = rps.UseRecoveryCode(context.Background(), testProfile.ID, []byte("recovery_hash"))
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	err = rps.DeleteTOTP(context.Background(), testProfile.ID)
+	require.NoError(t, err)
+	_, err = rps.GetTOTP(context.Background(), testProfile.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
@@ -0,0 +1,60 @@
+// Package secretbox encrypts small secrets stored at rest
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeySize is a size of AES-256 keys
+const KeySize = 32
+
+// ErrDecrypt is returned when a sealed secret was tampered with or sealed by another key or for another owner
+var ErrDecrypt = errors.New("cannot decrypt secret")
+
+// Box struct seals secrets with AES-256-GCM
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox creates a new Box
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes long", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("NewCipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("NewGCM: %w", err)
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal function encrypts the secret, owner is authenticated but not encrypted, so a sealed secret cannot be moved to another owner
+func (b *Box) Seal(secret, owner []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(secret)+b.aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	return b.aead.Seal(nonce, nonce, secret, owner), nil
+}
+
+// Open function decrypts a secret sealed for the owner
+func (b *Box) Open(sealed, owner []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	secret, err := b.aead.Open(nil, nonce, ciphertext, owner)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return secret, nil
+}
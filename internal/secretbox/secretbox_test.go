@@ -0,0 +1,34 @@
+package secretbox
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	box, err := NewBox(bytes.Repeat([]byte{7}, KeySize))
+	require.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("totp secret"), []byte("owner"))
+	require.NoError(t, err)
+	require.NotContains(t, string(sealed), "totp secret")
+
+	secret, err := box.Open(sealed, []byte("owner"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("totp secret"), secret)
+
+	_, err = box.Open(sealed, []byte("another owner"))
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	other, err := NewBox(bytes.Repeat([]byte{8}, KeySize))
+	require.NoError(t, err)
+	_, err = other.Open(sealed, []byte("owner"))
+	require.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestNewBoxInvalidKey(t *testing.T) {
+	_, err := NewBox([]byte("short"))
+	require.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/notify"
+	"github.com/eugenshima/profile/internal/token"
+
+	"github.com/google/uuid"
+)
+
+// validateEmail function returns a violation if the email is not a bare address
+func validateEmail(email string) *model.FieldViolation {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return &model.FieldViolation{Field: "Email", Description: "must be a valid email address"}
+	}
+	if utf8.RuneCountInString(email) > maxFieldLength {
+		return &model.FieldViolation{Field: "Email", Description: fmt.Sprintf("must be at most %d characters long", maxFieldLength)}
+	}
+	return nil
+}
+
+// SendVerification function sends a signed verification code to the unverified email of the profile
+func (s *ProfileService) SendVerification(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "SendVerification")
+	defer func() { endSpan(span, err) }()
+	profile, err := s.rps.GetProfileByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("GetProfileByID: %w", err)
+	}
+	if profile.Email == "" {
+		return fmt.Errorf("SendVerification: %w", &model.PreconditionError{Subject: "Email", Description: "profile has no email"})
+	}
+	if profile.EmailVerifiedAt != nil {
+		return fmt.Errorf("SendVerification: %w", &model.PreconditionError{Subject: "Email", Description: "email is already verified"})
+	}
+	// the code is bound to the address, so it stops working once the email is changed
+	code, expiresAt, err := s.tokens.IssuePurposeToken(token.PurposeEmailVerification, id, profile.Email, s.lifetimes.EmailVerification)
+	if err != nil {
+		return fmt.Errorf("IssuePurposeToken: %w", err)
+	}
+	err = s.notifier.Notify(ctx, &notify.Message{
+		ProfileID: id,
+		To:        profile.Email,
+		Subject:   "Verify your email",
+		Body: fmt.Sprintf("Use this code to verify your email: %s\nIt expires at %s.",
+			code, expiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		return fmt.Errorf("Notify: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail function checks a verification code and marks the email it was sent to as verified
+func (s *ProfileService) VerifyEmail(ctx context.Context, code string) (verified *model.Profile, err error) {
+	ctx, span := startSpan(ctx, "VerifyEmail")
+	defer func() { endSpan(span, err) }()
+	id, email, err := s.tokens.ValidatePurposeToken(token.PurposeEmailVerification, code)
+	if err != nil {
+		return nil, fmt.Errorf("ValidatePurposeToken: %w", err)
+	}
+	profile, err := s.rps.MarkEmailVerified(ctx, id, email)
+	if err != nil {
+		return nil, fmt.Errorf("MarkEmailVerified: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventEmailVerified,
+		ProfileID: id,
+		Details:   map[string]interface{}{"email": email},
+	})
+	return profile, nil
+}
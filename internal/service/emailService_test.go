@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	profile := &model.Profile{ID: uuid.New(), Login: "email_login", Email: "owner@example.com"}
+	mockRepository.On("GetProfileByID", mock.Anything, profile.ID).Return(profile, nil).Once()
+	testNotifier.messages = nil
+	testAudit.events = nil
+
+	err := testService.SendVerification(context.Background(), profile.ID)
+	require.NoError(t, err)
+	require.Len(t, testNotifier.messages, 1)
+	require.Equal(t, profile.Email, testNotifier.messages[0].To)
+	code := strings.Fields(strings.SplitN(testNotifier.messages[0].Body, ": ", 2)[1])[0]
+
+	verifiedAt := time.Now()
+	verified := &model.Profile{ID: profile.ID, Email: profile.Email, EmailVerifiedAt: &verifiedAt}
+	mockRepository.On("MarkEmailVerified", mock.Anything, profile.ID, profile.Email).Return(verified, nil).Once()
+	updated, err := testService.VerifyEmail(context.Background(), code)
+	require.NoError(t, err)
+	require.NotNil(t, updated.EmailVerifiedAt)
+	require.Equal(t, audit.EventEmailVerified, testAudit.events[0].Type)
+
+	// access tokens are not verification codes and vice versa
+	accessToken, _, err := testService.tokens.IssueAccessToken(profile.ID, uuid.New(), 1, nil)
+	require.NoError(t, err)
+	_, err = testService.VerifyEmail(context.Background(), accessToken)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+	_, err = testService.ValidateToken(context.Background(), code)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestSendVerificationPrecondition(t *testing.T) {
+	verifiedAt := time.Now()
+	noEmail := &model.Profile{ID: uuid.New()}
+	verified := &model.Profile{ID: uuid.New(), Email: "owner@example.com", EmailVerifiedAt: &verifiedAt}
+	mockRepository.On("GetProfileByID", mock.Anything, noEmail.ID).Return(noEmail, nil).Once()
+	mockRepository.On("GetProfileByID", mock.Anything, verified.ID).Return(verified, nil).Once()
+
+	err := testService.SendVerification(context.Background(), noEmail.ID)
+	require.ErrorIs(t, err, model.ErrFailedPrecondition)
+	err = testService.SendVerification(context.Background(), verified.ID)
+	require.ErrorIs(t, err, model.ErrFailedPrecondition)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestUpdateProfileValidatesEmail(t *testing.T) {
+	for _, email := range []string{"not-an-email", "Owner <owner@example.com>"} {
+		_, err := testService.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: uuid.New(), Email: &email})
+		require.ErrorIs(t, err, model.ErrInvalidArgument, email)
+	}
+}
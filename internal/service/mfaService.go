@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/lockout"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/token"
+	"github.com/eugenshima/profile/internal/totp"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// totpSkew is a number of time steps around the current one whose codes are accepted, it tolerates clock drift
+const totpSkew = 1
+
+// recoveryCodeLength is a number of random bytes in a recovery code
+const recoveryCodeLength = 10
+
+// recoveryEncoding is a base32 encoding of recovery codes, which avoids ambiguous characters
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTOTP function generates a new unconfirmed authenticator of the profile, it replaces an unconfirmed one.
+// The authenticator is not asked for on login until ConfirmTOTP
+func (s *ProfileService) EnrollTOTP(ctx context.Context, id uuid.UUID) (enrollment *model.TOTPEnrollment, err error) {
+	ctx, span := startSpan(ctx, "EnrollTOTP")
+	defer func() { endSpan(span, err) }()
+	if s.mfa.Box == nil {
+		return nil, fmt.Errorf("EnrollTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "two-factor authentication is not configured"})
+	}
+	profile, err := s.rps.GetProfileByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetProfileByID: %w", err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("GenerateSecret: %w", err)
+	}
+	sealed, err := s.mfa.Box.Seal(secret, id[:])
+	if err != nil {
+		return nil, fmt.Errorf("Seal: %w", err)
+	}
+	err = s.rps.SaveTOTP(ctx, &model.TOTP{ProfileID: id, Secret: sealed})
+	if errors.Is(err, model.ErrAlreadyExists) {
+		return nil, fmt.Errorf("SaveTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "two-factor authentication is already enabled"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SaveTOTP: %w", err)
+	}
+	return &model.TOTPEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(s.mfa.Issuer, profile.Login, secret),
+	}, nil
+}
+
+// ConfirmTOTP function enables two-factor authentication once the code proves the enrolled authenticator works.
+// It returns new recovery codes, which are shown only once, each of them can be used instead of a code a single time
+func (s *ProfileService) ConfirmTOTP(ctx context.Context, id uuid.UUID, code string) (codes []string, err error) {
+	ctx, span := startSpan(ctx, "ConfirmTOTP")
+	defer func() { endSpan(span, err) }()
+	stored, err := s.rps.GetTOTP(ctx, id)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("GetTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "no authenticator is being enrolled"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetTOTP: %w", err)
+	}
+	if stored.ConfirmedAt != nil {
+		return nil, fmt.Errorf("ConfirmTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "two-factor authentication is already enabled"})
+	}
+	secret, err := s.openSecret(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, fmt.Errorf("Validate: %w", model.NewValidationError("Code", "is invalid or expired"))
+	}
+	codes, hashes, err := newRecoveryCodes(s.mfa.RecoveryCodes)
+	if err != nil {
+		return nil, fmt.Errorf("newRecoveryCodes: %w", err)
+	}
+	err = s.rps.ConfirmTOTP(ctx, id, step, hashes)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("ConfirmTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "no authenticator is being enrolled"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ConfirmTOTP: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{Type: audit.EventTOTPEnabled, ProfileID: id})
+	return codes, nil
+}
+
+// DisableTOTP function removes the authenticator and recovery codes of the profile.
+// An enabled authenticator is removed only by its code or a recovery code, checked the same way as CompleteMFA does
+func (s *ProfileService) DisableTOTP(ctx context.Context, id uuid.UUID, code, clientIP string) (err error) {
+	ctx, span := startSpan(ctx, "DisableTOTP")
+	defer func() { endSpan(span, err) }()
+	stored, err := s.rps.GetTOTP(ctx, id)
+	if errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("GetTOTP: %w", &model.PreconditionError{Subject: "TOTP", Description: "two-factor authentication is not enabled"})
+	}
+	if err != nil {
+		return fmt.Errorf("GetTOTP: %w", err)
+	}
+	if stored.ConfirmedAt != nil {
+		profile, err := s.rps.GetProfileByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("GetProfileByID: %w", err)
+		}
+		err = s.verifySecondFactor(ctx, stored, code, &model.Auth{Login: profile.Login, ClientIP: clientIP})
+		if err != nil {
+			return err
+		}
+	}
+	err = s.rps.DeleteTOTP(ctx, id)
+	if err != nil {
+		return fmt.Errorf("DeleteTOTP: %w", err)
+	}
+	if stored.ConfirmedAt != nil {
+		s.audit.Emit(ctx, &audit.Event{
+			Type:      audit.EventTOTPDisabled,
+			ProfileID: id,
+			Details:   map[string]interface{}{"client_ip": clientIP},
+		})
+	}
+	return nil
+}
+
+// CompleteMFA function exchanges an MFA challenge issued by Login and a code of the authenticator
+// or a recovery code for a new pair of tokens. UserAgent and ClientIP of auth describe the new session
+func (s *ProfileService) CompleteMFA(ctx context.Context, challenge, code string, auth *model.Auth) (tokens *model.Tokens, err error) {
+	ctx, span := startSpan(ctx, "CompleteMFA")
+	defer func() { endSpan(span, err) }()
+	defer func() { s.recordLogin(LoginMethodMFA, tokens, err) }()
+	id, device, err := s.tokens.ValidatePurposeToken(token.PurposeMFAChallenge, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("ValidatePurposeToken: %w", err)
+	}
+	profile, err := s.rps.GetProfileByID(ctx, id)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("GetProfileByID: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetProfileByID: %w", err)
+	}
+	auth.Login, auth.Device = profile.Login, device
+	err = s.lockout.Check(ctx, lockout.ProfileAccount(id), auth.ClientIP)
+	if err != nil {
+		return nil, fmt.Errorf("Check: %w", err)
+	}
+	stored, err := s.rps.GetTOTP(ctx, id)
+	if errors.Is(err, model.ErrNotFound) {
+		// disabled since the challenge was issued
+		return nil, fmt.Errorf("GetTOTP: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetTOTP: %w", err)
+	}
+	err = s.verifySecondFactor(ctx, stored, code, auth)
+	if err != nil {
+		return nil, err
+	}
+	s.loginSucceeded(ctx, id)
+	return s.issueTokens(ctx, id, auth)
+}
+
+// totpEnabled function reports whether the profile has a confirmed authenticator
+func (s *ProfileService) totpEnabled(ctx context.Context, id uuid.UUID) (bool, error) {
+	stored, err := s.rps.GetTOTP(ctx, id)
+	if errors.Is(err, model.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("GetTOTP: %w", err)
+	}
+	return stored.ConfirmedAt != nil, nil
+}
+
+// issueMFAChallenge function signs a challenge of a login whose password was verified, the device of the login is bound to it
+func (s *ProfileService) issueMFAChallenge(id uuid.UUID, auth *model.Auth) (*model.Tokens, error) {
+	challenge, expiresAt, err := s.tokens.IssuePurposeToken(token.PurposeMFAChallenge, id, auth.Device, s.lifetimes.MFAChallenge)
+	if err != nil {
+		return nil, fmt.Errorf("IssuePurposeToken: %w", err)
+	}
+	return &model.Tokens{ProfileID: id, MFAChallenge: challenge, MFAChallengeExpiresAt: expiresAt}, nil
+}
+
+// verifySecondFactor function checks a code of the confirmed authenticator or an unused recovery code,
+// a mismatch is counted against the lockout of the login and its source IP
+func (s *ProfileService) verifySecondFactor(ctx context.Context, stored *model.TOTP, code string, auth *model.Auth) error {
+	if stored.ConfirmedAt == nil {
+		return fmt.Errorf("verifySecondFactor: %w", model.ErrInvalidToken)
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		secret, err := s.openSecret(ctx, stored)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+		if !ok {
+			return s.loginFailed(ctx, stored.ProfileID, auth)
+		}
+		err = s.rps.UseTOTPStep(ctx, stored.ProfileID, step)
+		if errors.Is(err, model.ErrInvalidCredentials) {
+			// the code was used already
+			return s.loginFailed(ctx, stored.ProfileID, auth)
+		}
+		if err != nil {
+			return fmt.Errorf("UseTOTPStep: %w", err)
+		}
+		return nil
+	}
+	err := s.rps.UseRecoveryCode(ctx, stored.ProfileID, hashRecoveryCode(code))
+	if errors.Is(err, model.ErrInvalidCredentials) {
+		return s.loginFailed(ctx, stored.ProfileID, auth)
+	}
+	if err != nil {
+		return fmt.Errorf("UseRecoveryCode: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventRecoveryCodeUsed,
+		ProfileID: stored.ProfileID,
+		Details:   map[string]interface{}{"client_ip": auth.ClientIP},
+	})
+	return nil
+}
+
+// openSecret function decrypts a stored TOTP secret, it is sealed for its profile
+func (s *ProfileService) openSecret(ctx context.Context, stored *model.TOTP) ([]byte, error) {
+	if s.mfa.Box == nil {
+		return nil, fmt.Errorf("openSecret: %w", &model.PreconditionError{Subject: "TOTP", Description: "two-factor authentication is not configured"})
+	}
+	secret, err := s.mfa.Box.Open(stored.Secret, stored.ProfileID[:])
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": stored.ProfileID}).Errorf("Open: %v", err)
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	return secret, nil
+}
+
+// newRecoveryCodes function generates n recovery codes and the hashes to be stored instead of them
+func newRecoveryCodes(n int) (codes []string, hashes [][]byte, err error) {
+	for i := 0; i < n; i++ {
+		raw := make([]byte, recoveryCodeLength)
+		_, err = rand.Read(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Read: %w", err)
+		}
+		encoded := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		// groups of four are easier to copy by hand
+		groups := make([]string, 0, len(encoded)/4)
+		for j := 0; j < len(encoded); j += 4 {
+			groups = append(groups, encoded[j:j+4])
+		}
+		code := strings.Join(groups, "-")
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode function returns a hash of the recovery code, ignoring case and separators
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return token.HashOpaqueToken(normalized)
+}
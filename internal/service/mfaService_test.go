@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/totp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// confirmedTOTP function returns a confirmed authenticator of the profile and its plaintext secret
+func confirmedTOTP(t *testing.T, id uuid.UUID) (*model.TOTP, []byte) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	sealed, err := testBox.Seal(secret, id[:])
+	require.NoError(t, err)
+	confirmedAt := time.Now()
+	return &model.TOTP{ProfileID: id, Secret: sealed, ConfirmedAt: &confirmedAt}, secret
+}
+
+func TestEnrollAndConfirmTOTP(t *testing.T) {
+	id := uuid.New()
+	mockRepository.On("GetProfileByID", mock.Anything, id).Return(&model.Profile{ID: id, Login: "totp_login"}, nil).Once()
+	var stored *model.TOTP
+	mockRepository.On("SaveTOTP", mock.Anything, mock.MatchedBy(func(saved *model.TOTP) bool {
+		stored = saved
+		return saved.ProfileID == id
+	})).Return(nil).Once()
+
+	enrollment, err := testService.EnrollTOTP(context.Background(), id)
+	require.NoError(t, err)
+	require.Contains(t, enrollment.URI, "otpauth://totp/profile:totp_login?")
+	secret, err := testBox.Open(stored.Secret, id[:])
+	require.NoError(t, err)
+	require.Equal(t, enrollment.Secret, totp.EncodeSecret(secret))
+	require.NotContains(t, string(stored.Secret), string(secret))
+
+	mockRepository.On("GetTOTP", mock.Anything, id).Return(stored, nil).Twice()
+	_, err = testService.ConfirmTOTP(context.Background(), id, "abcdef")
+	require.ErrorIs(t, err, model.ErrInvalidArgument)
+	var hashes [][]byte
+	mockRepository.On("ConfirmTOTP", mock.Anything, id, totp.Step(time.Now()), mock.MatchedBy(func(saved [][]byte) bool {
+		hashes = saved
+		return true
+	})).Return(nil).Once()
+	codes, err := testService.ConfirmTOTP(context.Background(), id, totp.Code(secret, totp.Step(time.Now())))
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	for i, code := range codes {
+		require.Equal(t, hashRecoveryCode(code), hashes[i])
+	}
+	require.Equal(t, audit.EventTOTPEnabled, testAudit.events[len(testAudit.events)-1].Type)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	id := uuid.New()
+	hash, err := testService.hasher.Hash([]byte("password"))
+	require.NoError(t, err)
+	stored, secret := confirmedTOTP(t, id)
+	testRecorder.reset()
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "mfa_login").Return(id, hash, nil).Once()
+	mockRepository.On("GetTOTP", mock.Anything, id).Return(stored, nil).Twice()
+
+	challenge, err := testService.Login(context.Background(), &model.Auth{Login: "mfa_login", Password: []byte("password"), Device: "phone"})
+	require.NoError(t, err)
+	require.NotEmpty(t, challenge.MFAChallenge)
+	require.Empty(t, challenge.AccessToken)
+	require.Empty(t, challenge.RefreshToken)
+
+	step := totp.Step(time.Now())
+	mockRepository.On("GetProfileByID", mock.Anything, id).Return(&model.Profile{ID: id, Login: "mfa_login"}, nil).Once()
+	mockRepository.On("UseTOTPStep", mock.Anything, id, step).Return(nil).Once()
+	mockRepository.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(session *model.UpdateTokens) bool {
+		return session.ID == id && session.Device == "phone" && session.ClientIP == "10.0.0.1"
+	})).Return(nil).Once()
+	mockRepository.On("ListProfileRoles", mock.Anything, id).Return([]*model.Role{{Name: model.RoleUser}}, nil).Once()
+	mockRepository.On("GetSessionState", mock.Anything, mock.AnythingOfType("uuid.UUID")).Return(&model.SessionState{ProfileID: id, CredentialsVersion: 1}, nil).Once()
+
+	tokens, err := testService.CompleteMFA(context.Background(), challenge.MFAChallenge, totp.Code(secret, step), &model.Auth{ClientIP: "10.0.0.1"})
+	require.NoError(t, err)
+	require.Equal(t, id, tokens.ProfileID)
+	require.NotEmpty(t, tokens.AccessToken)
+	require.Equal(t, map[string]int{"password/mfa_required": 1, "mfa/success": 1}, testRecorder.logins)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestCompleteMFARejectsInvalidCodes(t *testing.T) {
+	id := uuid.New()
+	stored, secret := confirmedTOTP(t, id)
+	challenge, err := testService.issueMFAChallenge(id, &model.Auth{})
+	require.NoError(t, err)
+	mockRepository.On("GetProfileByID", mock.Anything, id).Return(&model.Profile{ID: id, Login: "invalid_mfa_login"}, nil).Times(3)
+	mockRepository.On("GetTOTP", mock.Anything, id).Return(stored, nil).Times(3)
+
+	step := totp.Step(time.Now())
+	wrong := totp.Code(secret, step-5)
+	_, err = testService.CompleteMFA(context.Background(), challenge.MFAChallenge, wrong, &model.Auth{})
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	// a code of an already used step is a replay
+	mockRepository.On("UseTOTPStep", mock.Anything, id, step).Return(model.ErrInvalidCredentials).Once()
+	_, err = testService.CompleteMFA(context.Background(), challenge.MFAChallenge, totp.Code(secret, step), &model.Auth{})
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	// failed codes count against the lockout of the login like failed passwords do
+	mockRepository.On("UseRecoveryCode", mock.Anything, id, hashRecoveryCode("unknown-code")).Return(model.ErrInvalidCredentials).Once()
+	_, err = testService.CompleteMFA(context.Background(), challenge.MFAChallenge, "unknown-code", &model.Auth{})
+	require.ErrorIs(t, err, model.ErrLocked)
+
+	// other single purpose tokens are not challenges
+	_, err = testService.CompleteMFA(context.Background(), challenge.MFAChallenge+"x", totp.Code(secret, step), &model.Auth{})
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestDisableTOTPWithRecoveryCode(t *testing.T) {
+	id := uuid.New()
+	stored, _ := confirmedTOTP(t, id)
+	mockRepository.On("GetTOTP", mock.Anything, id).Return(stored, nil).Once()
+	mockRepository.On("GetProfileByID", mock.Anything, id).Return(&model.Profile{ID: id, Login: "disable_login"}, nil).Once()
+	mockRepository.On("UseRecoveryCode", mock.Anything, id, hashRecoveryCode("abcd-efgh")).Return(nil).Once()
+	mockRepository.On("DeleteTOTP", mock.Anything, id).Return(nil).Once()
+
+	// recovery codes ignore case and separators
+	err := testService.DisableTOTP(context.Background(), id, "ABCD EFGH", "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, audit.EventTOTPDisabled, testAudit.events[len(testAudit.events)-1].Type)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestDisableTOTPNotEnabled(t *testing.T) {
+	id := uuid.New()
+	mockRepository.On("GetTOTP", mock.Anything, id).Return(nil, model.ErrNotFound).Once()
+
+	err := testService.DisableTOTP(context.Background(), id, "123456", "")
+	require.ErrorIs(t, err, model.ErrFailedPrecondition)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
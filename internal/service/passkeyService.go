@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/webauthn"
+
+	"github.com/google/uuid"
+)
+
+// BeginPasskeyRegistration function issues a registration challenge of the profile
+// and returns creation options for navigator.credentials.create
+func (s *ProfileService) BeginPasskeyRegistration(ctx context.Context, id uuid.UUID) (options []byte, err error) {
+	ctx, span := startSpan(ctx, "BeginPasskeyRegistration")
+	defer func() { endSpan(span, err) }()
+	profile, err := s.rps.GetProfileByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetProfileByID: %w", err)
+	}
+	passkeys, err := s.rps.ListPasskeys(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("ListPasskeys: %w", err)
+	}
+	exclude := make([][]byte, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, passkey.CredentialID)
+	}
+	challenge, err := s.newWebAuthnChallenge(ctx, webauthn.CeremonyCreate, id)
+	if err != nil {
+		return nil, err
+	}
+	displayName := profile.Username
+	if displayName == "" {
+		displayName = profile.Login
+	}
+	options, err = s.webauthn.CreationOptions(challenge, &webauthn.User{ID: id[:], Name: profile.Login, DisplayName: displayName}, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("CreationOptions: %w", err)
+	}
+	return options, nil
+}
+
+// FinishPasskeyRegistration function verifies a response of the authenticator to a registration challenge of the profile
+// and stores the new passkey
+func (s *ProfileService) FinishPasskeyRegistration(ctx context.Context, id uuid.UUID, clientDataJSON, attestationObject []byte) (passkey *model.Passkey, err error) {
+	ctx, span := startSpan(ctx, "FinishPasskeyRegistration")
+	defer func() { endSpan(span, err) }()
+	challenge, challengeProfileID, err := s.useWebAuthnChallenge(ctx, webauthn.CeremonyCreate, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if challengeProfileID != id {
+		return nil, fmt.Errorf("challenge of another profile: %w", model.ErrInvalidToken)
+	}
+	credential, err := s.webauthn.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("VerifyRegistration: %w", err)
+	}
+	passkey = &model.Passkey{
+		CredentialID: credential.ID,
+		ProfileID:    id,
+		PublicKey:    credential.PublicKey,
+		AAGUID:       credential.AAGUID,
+		SignCount:    int64(credential.SignCount),
+	}
+	err = s.rps.SavePasskey(ctx, passkey)
+	if err != nil {
+		return nil, fmt.Errorf("SavePasskey: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventPasskeyRegistered,
+		ProfileID: id,
+		Details:   map[string]interface{}{"aaguid": fmt.Sprintf("%x", passkey.AAGUID)},
+	})
+	return passkey, nil
+}
+
+// BeginPasskeyLogin function issues a login challenge and returns request options for navigator.credentials.get.
+// Passkeys are discoverable, so the profile is not known until FinishPasskeyLogin
+func (s *ProfileService) BeginPasskeyLogin(ctx context.Context) (options []byte, err error) {
+	ctx, span := startSpan(ctx, "BeginPasskeyLogin")
+	defer func() { endSpan(span, err) }()
+	challenge, err := s.newWebAuthnChallenge(ctx, webauthn.CeremonyGet, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	options, err = s.webauthn.RequestOptions(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("RequestOptions: %w", err)
+	}
+	return options, nil
+}
+
+// FinishPasskeyLogin function verifies a response of the authenticator to a login challenge and issues a new pair of tokens
+// the same way as Login does. A passkey verifies possession and the user, so no second factor is asked for
+func (s *ProfileService) FinishPasskeyLogin(ctx context.Context, assertion *model.PasskeyAssertion) (tokens *model.Tokens, err error) {
+	ctx, span := startSpan(ctx, "FinishPasskeyLogin")
+	defer func() { endSpan(span, err) }()
+	defer func() { s.recordLogin(LoginMethodPasskey, tokens, err) }()
+	challenge, _, err := s.useWebAuthnChallenge(ctx, webauthn.CeremonyGet, assertion.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	passkey, err := s.rps.GetPasskey(ctx, assertion.CredentialID)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("GetPasskey: %w", model.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetPasskey: %w", err)
+	}
+	if len(assertion.UserHandle) > 0 && !bytes.Equal(assertion.UserHandle, passkey.ProfileID[:]) {
+		return nil, fmt.Errorf("user handle mismatch: %w", model.ErrInvalidCredentials)
+	}
+	signCount, err := s.webauthn.VerifyAssertion(challenge, &webauthn.Credential{
+		ID:        passkey.CredentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: uint32(passkey.SignCount),
+	}, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("VerifyAssertion: %w", err)
+	}
+	err = s.rps.UsePasskey(ctx, passkey.CredentialID, int64(signCount))
+	if err != nil {
+		return nil, fmt.Errorf("UsePasskey: %w", err)
+	}
+	return s.issueTokens(ctx, passkey.ProfileID, &model.Auth{
+		Device:    assertion.Device,
+		UserAgent: assertion.UserAgent,
+		ClientIP:  assertion.ClientIP,
+	})
+}
+
+// newWebAuthnChallenge function generates and stores a challenge of the ceremony, only its hash is stored
+func (s *ProfileService) newWebAuthnChallenge(ctx context.Context, ceremony string, id uuid.UUID) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("NewChallenge: %w", err)
+	}
+	hash := sha256.Sum256(challenge)
+	err = s.rps.CreateWebAuthnChallenge(ctx, &model.WebAuthnChallenge{
+		Hash:      hash[:],
+		Ceremony:  ceremony,
+		ProfileID: id,
+		ExpiresAt: time.Now().Add(s.lifetimes.WebAuthnChallenge),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CreateWebAuthnChallenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// useWebAuthnChallenge function uses up the stored challenge client data was created for
+// and returns the challenge with its profile, which is uuid.Nil for logins
+func (s *ProfileService) useWebAuthnChallenge(ctx context.Context, ceremony string, clientDataJSON []byte) ([]byte, uuid.UUID, error) {
+	challenge, err := s.webauthn.ClientChallenge(clientDataJSON, ceremony)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("ClientChallenge: %w", err)
+	}
+	hash := sha256.Sum256(challenge)
+	id, err := s.rps.UseWebAuthnChallenge(ctx, ceremony, hash[:])
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("UseWebAuthnChallenge: %w", err)
+	}
+	return challenge, id, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/webauthn"
+	"github.com/eugenshima/profile/internal/webauthn/webauthntest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// expectChallenge function expects a challenge of the ceremony to be stored and used once, returning the profile it was issued for
+func expectChallenge(ceremony string, id uuid.UUID) {
+	var hash []byte
+	mockRepository.On("CreateWebAuthnChallenge", mock.Anything, mock.MatchedBy(func(challenge *model.WebAuthnChallenge) bool {
+		hash = challenge.Hash
+		return challenge.Ceremony == ceremony && challenge.ProfileID == id
+	})).Return(nil).Once()
+	mockRepository.On("UseWebAuthnChallenge", mock.Anything, ceremony, mock.MatchedBy(func(used []byte) bool {
+		return string(used) == string(hash)
+	})).Return(id, nil).Once()
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	id := uuid.New()
+	authenticator, err := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	require.NoError(t, err)
+	existing := &model.Passkey{CredentialID: []byte("existing")}
+	mockRepository.On("GetProfileByID", mock.Anything, id).Return(&model.Profile{ID: id, Login: "passkey_login"}, nil).Once()
+	mockRepository.On("ListPasskeys", mock.Anything, id).Return([]*model.Passkey{existing}, nil).Once()
+	expectChallenge(webauthn.CeremonyCreate, id)
+
+	options, err := testService.BeginPasskeyRegistration(context.Background(), id)
+	require.NoError(t, err)
+	require.Contains(t, string(options), `"excludeCredentials":[{"type":"public-key","id":"ZXhpc3Rpbmc"}]`)
+	challenge, err := webauthntest.Challenge(options)
+	require.NoError(t, err)
+	clientData, attestation, err := authenticator.Register(challenge, id[:])
+	require.NoError(t, err)
+
+	var stored *model.Passkey
+	mockRepository.On("SavePasskey", mock.Anything, mock.MatchedBy(func(passkey *model.Passkey) bool {
+		stored = passkey
+		return passkey.ProfileID == id && string(passkey.CredentialID) == string(authenticator.CredentialID)
+	})).Return(nil).Once()
+	_, err = testService.FinishPasskeyRegistration(context.Background(), id, clientData, attestation)
+	require.NoError(t, err)
+
+	expectChallenge(webauthn.CeremonyGet, uuid.Nil)
+	options, err = testService.BeginPasskeyLogin(context.Background())
+	require.NoError(t, err)
+	challenge, err = webauthntest.Challenge(options)
+	require.NoError(t, err)
+	clientData, authData, signature, err := authenticator.Assert(challenge)
+	require.NoError(t, err)
+
+	mockRepository.On("GetPasskey", mock.Anything, authenticator.CredentialID).Return(stored, nil).Once()
+	mockRepository.On("UsePasskey", mock.Anything, authenticator.CredentialID, int64(1)).Return(nil).Once()
+	mockRepository.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(session *model.UpdateTokens) bool {
+		return session.ID == id && session.Device == "laptop"
+	})).Return(nil).Once()
+	mockRepository.On("ListProfileRoles", mock.Anything, id).Return([]*model.Role{{Name: model.RoleUser}}, nil).Once()
+	mockRepository.On("GetSessionState", mock.Anything, mock.AnythingOfType("uuid.UUID")).Return(&model.SessionState{ProfileID: id, CredentialsVersion: 1}, nil).Once()
+	tokens, err := testService.FinishPasskeyLogin(context.Background(), &model.PasskeyAssertion{
+		CredentialID:      authenticator.CredentialID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        id[:],
+		Device:            "laptop",
+	})
+	require.NoError(t, err)
+	require.Equal(t, id, tokens.ProfileID)
+	require.NotEmpty(t, tokens.AccessToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestFinishPasskeyLoginRejectsForeignUserHandle(t *testing.T) {
+	authenticator, err := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	require.NoError(t, err)
+	challenge := []byte("login_challenge")
+	hash := sha256.Sum256(challenge)
+	passkey := &model.Passkey{CredentialID: authenticator.CredentialID, ProfileID: uuid.New(), PublicKey: authenticator.PublicKey()}
+	mockRepository.On("UseWebAuthnChallenge", mock.Anything, webauthn.CeremonyGet, hash[:]).Return(uuid.Nil, nil).Once()
+	mockRepository.On("GetPasskey", mock.Anything, authenticator.CredentialID).Return(passkey, nil).Once()
+	clientData, authData, signature, err := authenticator.Assert(challenge)
+	require.NoError(t, err)
+
+	other := uuid.New()
+	_, err = testService.FinishPasskeyLogin(context.Background(), &model.PasskeyAssertion{
+		CredentialID:      authenticator.CredentialID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        other[:],
+	})
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestFinishPasskeyRegistrationRejectsUnknownChallenge(t *testing.T) {
+	id := uuid.New()
+	authenticator, err := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	require.NoError(t, err)
+	challenge := []byte("unknown_challenge")
+	hash := sha256.Sum256(challenge)
+	mockRepository.On("UseWebAuthnChallenge", mock.Anything, webauthn.CeremonyCreate, hash[:]).Return(uuid.Nil, model.ErrInvalidToken).Once()
+	clientData, attestation, err := authenticator.Register(challenge, id[:])
+	require.NoError(t, err)
+
+	_, err = testService.FinishPasskeyRegistration(context.Background(), id, clientData, attestation)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/lockout"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/notify"
+	"github.com/eugenshima/profile/internal/token"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangePassword function replaces the password after verifying the current one the same way as Login does.
+// Every session except change.KeepSessionID is revoked, revoked is a number of revoked sessions
+func (s *ProfileService) ChangePassword(ctx context.Context, change *model.PasswordChange) (revoked int64, err error) {
+	ctx, span := startSpan(ctx, "ChangePassword")
+	defer func() { endSpan(span, err) }()
+	profile, err := s.rps.GetProfileByID(ctx, change.ProfileID)
+	if err != nil {
+		return 0, fmt.Errorf("GetProfileByID: %w", err)
+	}
+	auth := &model.Auth{Login: profile.Login, Password: change.CurrentPassword, ClientIP: change.ClientIP}
+	err = s.lockout.Check(ctx, lockout.ProfileAccount(profile.ID), auth.ClientIP)
+	if err != nil {
+		return 0, fmt.Errorf("Check: %w", err)
+	}
+	_, err = s.verifyPassword(ctx, profile.ID, profile.Password, auth)
+	if err != nil {
+		return 0, err
+	}
+	s.loginSucceeded(ctx, profile.ID)
+	err = s.validateNewPassword(change.NewPassword, change.CurrentPassword)
+	if err != nil {
+		return 0, fmt.Errorf("validateNewPassword: %w", err)
+	}
+	hash, err := s.hashPassword(ctx, change.NewPassword)
+	if err != nil {
+		return 0, fmt.Errorf("Hash: %w", err)
+	}
+	revoked, err = s.rps.ChangePassword(ctx, profile.ID, hash, change.KeepSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("ChangePassword: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventPasswordChanged,
+		ProfileID: profile.ID,
+		Details: map[string]interface{}{
+			"client_ip":        change.ClientIP,
+			"revoked_sessions": revoked,
+		},
+	})
+	return revoked, nil
+}
+
+// validateNewPassword function checks the new password against the policy and requires it to differ from the old one.
+// Violations are reported for the NewPassword field
+func (s *ProfileService) validateNewPassword(newPassword, oldPassword []byte) error {
+	verr := &model.ValidationError{}
+	err := s.policy.Validate(string(newPassword))
+	if err != nil && !errors.As(err, &verr) {
+		return err
+	}
+	for i := range verr.Violations {
+		verr.Violations[i].Field = "NewPassword"
+	}
+	if oldPassword != nil && string(newPassword) == string(oldPassword) {
+		verr.Violations = append(verr.Violations, model.FieldViolation{Field: "NewPassword", Description: "must differ from the current password"})
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
+const (
+	// passwordResetDeliveryTimeout limits how long a password reset started in the background may take
+	passwordResetDeliveryTimeout = 30 * time.Second
+	// passwordResetCooldown is the least time between two password resets sent to the same profile
+	passwordResetCooldown = time.Minute
+	// maxPendingPasswordResets bounds password resets delivered at once, further requests are dropped
+	maxPendingPasswordResets = 64
+)
+
+// RequestPasswordReset function sends a single-use reset token to the verified email of the owner of the login.
+// The login is looked up and the token is delivered in the background, so callers cannot probe for registered logins
+// by the outcome or the duration of the call. Requests over the cooldown of the profile or the limit of pending
+// deliveries are dropped the same way. Wait waits for deliveries in progress
+func (s *ProfileService) RequestPasswordReset(ctx context.Context, login string) {
+	ctx, span := startSpan(ctx, "RequestPasswordReset")
+	defer span.End()
+	select {
+	case s.resetSlots <- struct{}{}:
+	default:
+		logging.FromContext(ctx).Warn("too many password resets in progress, the request is dropped")
+		return
+	}
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, passwordResetDeliveryTimeout)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer func() { <-s.resetSlots }()
+		defer cancel()
+		err := s.deliverPasswordReset(ctx, login)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("deliverPasswordReset: %v", err)
+		}
+	}()
+}
+
+// deliverPasswordReset function stores a reset token of the owner of the login and sends it to their verified email.
+// An unknown login, a profile without a verified email and a reset within the cooldown are not errors
+func (s *ProfileService) deliverPasswordReset(ctx context.Context, login string) (err error) {
+	ctx, span := startSpan(ctx, "deliverPasswordReset")
+	defer func() { endSpan(span, err) }()
+	id, _, err := s.rps.GetIDByLoginPassword(ctx, login)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("GetIDByLoginPassword: %w", err)
+	}
+	profile, err := s.rps.GetProfileByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("GetProfileByID: %w", err)
+	}
+	if profile.EmailVerifiedAt == nil {
+		// nobody has proven they own an address of the profile
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": id}).Info("password reset skipped, the profile has no verified email")
+		return nil
+	}
+	resetToken, hash, err := token.NewOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("NewOpaqueToken: %w", err)
+	}
+	reset := &model.PasswordReset{ID: uuid.New(), ProfileID: id, Hash: hash, ExpiresAt: time.Now().Add(s.lifetimes.PasswordReset)}
+	err = s.rps.CreatePasswordReset(ctx, reset, passwordResetCooldown)
+	if errors.Is(err, model.ErrLocked) {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": id}).Info("password reset skipped, one was sent recently")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("CreatePasswordReset: %w", err)
+	}
+	err = s.notifier.Notify(ctx, &notify.Message{
+		ProfileID: id,
+		To:        profile.Email,
+		Subject:   "Password reset",
+		Body: fmt.Sprintf("Use this token to reset your password: %s\nIt expires at %s. If you did not ask for a reset, ignore this message.",
+			resetToken, reset.ExpiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		return fmt.Errorf("Notify: %w", err)
+	}
+	return nil
+}
+
+// Wait function waits for password resets started in the background to be delivered
+func (s *ProfileService) Wait() {
+	s.background.Wait()
+}
+
+// detachedContext struct keeps values of a request context, such as its logger and span, without its cancellation,
+// so work started by the request can outlive it
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline implements context.Context interface
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements context.Context interface
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err implements context.Context interface
+func (detachedContext) Err() error {
+	return nil
+}
+
+// ConfirmPasswordReset function sets a new password using a reset token, the token can be used once.
+// Every session of the profile is revoked and a lockout of the login is lifted
+func (s *ProfileService) ConfirmPasswordReset(ctx context.Context, resetToken string, newPassword []byte) (err error) {
+	ctx, span := startSpan(ctx, "ConfirmPasswordReset")
+	defer func() { endSpan(span, err) }()
+	if resetToken == "" {
+		return fmt.Errorf("ConfirmPasswordReset: %w", model.ErrInvalidToken)
+	}
+	err = s.validateNewPassword(newPassword, nil)
+	if err != nil {
+		return fmt.Errorf("validateNewPassword: %w", err)
+	}
+	hash, err := s.hashPassword(ctx, newPassword)
+	if err != nil {
+		return fmt.Errorf("Hash: %w", err)
+	}
+	id, revoked, err := s.rps.ResetPassword(ctx, token.HashOpaqueToken(resetToken), hash)
+	if err != nil {
+		return fmt.Errorf("ResetPassword: %w", err)
+	}
+	err = s.lockout.Unlock(ctx, lockout.ProfileAccount(id))
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": id}).Errorf("Unlock: %v", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventPasswordReset,
+		ProfileID: id,
+		Details:   map[string]interface{}{"revoked_sessions": revoked},
+	})
+	return nil
+}
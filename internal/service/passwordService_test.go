@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/token"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newPasswordProfile function returns a stored profile with the given plaintext password
+func newPasswordProfile(t *testing.T, login, plaintext string) *model.Profile {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), 4)
+	require.NoError(t, err)
+	return &model.Profile{ID: uuid.New(), Login: login, Password: hash}
+}
+
+func TestChangePassword(t *testing.T) {
+	profile := newPasswordProfile(t, "change_login", "current-password")
+	keep := uuid.New()
+	mockRepository.On("GetProfileByID", mock.Anything, profile.ID).Return(profile, nil).Once()
+	mockRepository.On("ChangePassword", mock.Anything, profile.ID, mock.MatchedBy(func(hash []byte) bool {
+		return bcrypt.CompareHashAndPassword(hash, []byte("new-password")) == nil
+	}), keep).Return(int64(2), nil).Once()
+	testAudit.events = nil
+
+	revoked, err := testService.ChangePassword(context.Background(), &model.PasswordChange{
+		ProfileID:       profile.ID,
+		CurrentPassword: []byte("current-password"),
+		NewPassword:     []byte("new-password"),
+		KeepSessionID:   keep,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), revoked)
+	require.Len(t, testAudit.events, 1)
+	require.Equal(t, audit.EventPasswordChanged, testAudit.events[0].Type)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestChangePasswordReportsFailedRevocation(t *testing.T) {
+	profile := newPasswordProfile(t, "revocation_login", "current-password")
+	mockRepository.On("GetProfileByID", mock.Anything, profile.ID).Return(profile, nil).Once()
+	mockRepository.On("ChangePassword", mock.Anything, profile.ID, mock.AnythingOfType("[]uint8"), uuid.Nil).
+		Return(int64(0), errors.New("connection refused")).Once()
+	testAudit.events = nil
+
+	_, err := testService.ChangePassword(context.Background(), &model.PasswordChange{
+		ProfileID:       profile.ID,
+		CurrentPassword: []byte("current-password"),
+		NewPassword:     []byte("new-password"),
+	})
+	require.Error(t, err)
+	require.Empty(t, testAudit.events)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestChangePasswordRejected(t *testing.T) {
+	profile := newPasswordProfile(t, "rejected_login", "current-password")
+	mockRepository.On("GetProfileByID", mock.Anything, profile.ID).Return(profile, nil).Twice()
+
+	_, err := testService.ChangePassword(context.Background(), &model.PasswordChange{
+		ProfileID:       profile.ID,
+		CurrentPassword: []byte("wrong-password"),
+		NewPassword:     []byte("new-password"),
+	})
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = testService.ChangePassword(context.Background(), &model.PasswordChange{
+		ProfileID:       profile.ID,
+		CurrentPassword: []byte("current-password"),
+		NewPassword:     []byte("current-password"),
+	})
+	require.ErrorIs(t, err, model.ErrInvalidArgument)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	id := uuid.New()
+	var stored *model.PasswordReset
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "reset_login").Return(id, []byte("hash"), nil).Once()
+	mockRepository.On("CreatePasswordReset", mock.Anything, mock.MatchedBy(func(reset *model.PasswordReset) bool {
+		stored = reset
+		return reset.ProfileID == id
+	}), passwordResetCooldown).Return(nil).Once()
+	verifiedAt := time.Now()
+	mockRepository.On("GetProfileByID", mock.Anything, id).Return(&model.Profile{ID: id, Email: "owner@example.com", EmailVerifiedAt: &verifiedAt}, nil).Once()
+	unverified, recent := uuid.New(), uuid.New()
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "unverified@example.com").Return(unverified, []byte("hash"), nil).Once()
+	mockRepository.On("GetProfileByID", mock.Anything, unverified).Return(&model.Profile{ID: unverified, Login: "unverified@example.com", Email: "unverified@example.com"}, nil).Once()
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "recent_login").Return(recent, []byte("hash"), nil).Once()
+	mockRepository.On("GetProfileByID", mock.Anything, recent).Return(&model.Profile{ID: recent, Email: "recent@example.com", EmailVerifiedAt: &verifiedAt}, nil).Once()
+	mockRepository.On("CreatePasswordReset", mock.Anything, mock.AnythingOfType("*model.PasswordReset"), passwordResetCooldown).Return(fmt.Errorf("QueryRow: %w", model.ErrLocked)).Once()
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "unknown_login").Return(uuid.Nil, nil, fmt.Errorf("QueryRow: %w", model.ErrNotFound)).Once()
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "failing_login").Return(uuid.Nil, nil, errors.New("connection refused")).Once()
+	testNotifier.messages = nil
+
+	// the delivery outlives the request
+	ctx, cancel := context.WithCancel(context.Background())
+	testService.RequestPasswordReset(ctx, "reset_login")
+	cancel()
+	testService.Wait()
+	require.Len(t, testNotifier.messages, 1)
+	require.Equal(t, "owner@example.com", testNotifier.messages[0].To)
+
+	// the token is only sent to the owner, the stored hash must match it
+	sentToken := strings.Fields(strings.SplitN(testNotifier.messages[0].Body, ": ", 2)[1])[0]
+	require.Equal(t, token.HashOpaqueToken(sentToken), stored.Hash)
+
+	// unknown logins and failures are not reported to the caller, nothing is sent to unverified addresses
+	// or within the cooldown
+	for _, login := range []string{"unknown_login", "failing_login", "unverified@example.com", "recent_login"} {
+		testService.RequestPasswordReset(context.Background(), login)
+	}
+	testService.Wait()
+	require.Len(t, testNotifier.messages, 1)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	profile := &model.Profile{ID: uuid.New(), Login: "confirm_login"}
+	mockRepository.On("ResetPassword", mock.Anything, token.HashOpaqueToken("reset-token"), mock.AnythingOfType("[]uint8")).Return(profile.ID, int64(1), nil).Once()
+	mockRepository.On("ResetPassword", mock.Anything, token.HashOpaqueToken("used-token"), mock.AnythingOfType("[]uint8")).
+		Return(uuid.Nil, int64(0), fmt.Errorf("QueryRow: %w", model.ErrInvalidToken)).Once()
+
+	err := testService.ConfirmPasswordReset(context.Background(), "reset-token", []byte("new-password"))
+	require.NoError(t, err)
+
+	err = testService.ConfirmPasswordReset(context.Background(), "used-token", []byte("new-password"))
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestRequestPasswordResetDropsOverLimit(t *testing.T) {
+	for i := 0; i < maxPendingPasswordResets; i++ {
+		testService.resetSlots <- struct{}{}
+	}
+	// no delivery is started, so the repository is not called
+	testService.RequestPasswordReset(context.Background(), "dropped_login")
+	testService.Wait()
+	for i := 0; i < maxPendingPasswordResets; i++ {
+		<-testService.resetSlots
+	}
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
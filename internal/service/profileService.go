@@ -3,59 +3,341 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/lockout"
+	"github.com/eugenshima/profile/internal/logging"
 	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/notify"
+	"github.com/eugenshima/profile/internal/password"
+	"github.com/eugenshima/profile/internal/secretbox"
+	"github.com/eugenshima/profile/internal/token"
+	"github.com/eugenshima/profile/internal/webauthn"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/sirupsen/logrus"
 )
 
+// maxFieldLength is a maximum length of text profile fields, it matches the varchar columns
+const maxFieldLength = 255
+
+//go:generate /home/yauhenishymanski/work/bin/mockery --name=ProfileRepositoryInterface --case=underscore --output=./mocks
+
 // ProfileService struct represents a profile service
 type ProfileService struct {
-	rps ProfileRepositoryInterface
+	rps     ProfileRepositoryInterface
+	policy  *password.Policy
+	hasher  *password.Manager
+	tokens  *token.Manager
+	lockout *lockout.Guard
+	// notifier delivers password reset tokens and email verification codes
+	notifier  notify.Notifier
+	lifetimes Lifetimes
+	mfa       MFA
+	webauthn  *webauthn.RelyingParty
+	audit     audit.Sink
+	recorder  Recorder
+	// background tracks password resets delivered after RequestPasswordReset returns
+	background sync.WaitGroup
+	// resetSlots bounds password resets delivered at once
+	resetSlots chan struct{}
+}
+
+// Recorder interface counts business events of the service for monitoring
+type Recorder interface {
+	LoginAttempted(method, result string)
+	ProfileCreated()
+}
+
+// Login methods and results reported to Recorder
+const (
+	LoginMethodPassword = "password"
+	LoginMethodMFA      = "mfa"
+	LoginMethodPasskey  = "passkey"
+
+	LoginSucceeded   = "success"
+	LoginMFARequired = "mfa_required"
+	LoginFailed      = "failure"
+	LoginErrored     = "error"
+)
+
+// Lifetimes struct contains lifetimes of single purpose tokens issued by the service
+type Lifetimes struct {
+	PasswordReset     time.Duration
+	EmailVerification time.Duration
+	MFAChallenge      time.Duration
+	WebAuthnChallenge time.Duration
+}
+
+// MFA struct contains two-factor authentication settings
+type MFA struct {
+	// Box seals TOTP secrets, enrollment is disabled without it
+	Box *secretbox.Box
+	// Issuer names the service in authenticator apps
+	Issuer string
+	// RecoveryCodes is a number of recovery codes generated on confirmation
+	RecoveryCodes int
 }
 
 // NewProfileService creates a new ProfileService
-func NewProfileService(rps ProfileRepositoryInterface) *ProfileService {
-	return &ProfileService{rps: rps}
+func NewProfileService(rps ProfileRepositoryInterface, policy *password.Policy, hasher *password.Manager, tokens *token.Manager,
+	guard *lockout.Guard, notifier notify.Notifier, lifetimes Lifetimes, mfa MFA, rp *webauthn.RelyingParty, auditSink audit.Sink,
+	recorder Recorder) *ProfileService {
+	return &ProfileService{rps: rps, policy: policy, hasher: hasher, tokens: tokens, lockout: guard, notifier: notifier,
+		lifetimes: lifetimes, mfa: mfa, webauthn: rp, audit: auditSink, recorder: recorder,
+		resetSlots: make(chan struct{}, maxPendingPasswordResets)}
 }
 
 // ProfileRepositoryInterface represents a profile repository methods
 type ProfileRepositoryInterface interface {
 	GetProfileByID(ctx context.Context, id uuid.UUID) (*model.Profile, error)
 	CreateProfile(ctx context.Context, profile *model.Profile) error
+	UpdateProfile(ctx context.Context, update *model.ProfileUpdate) (*model.Profile, error)
 	SaveRefreshToken(ctx context.Context, profile *model.UpdateTokens) error
+	GetRefreshToken(ctx context.Context, hash []byte) (*model.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID uuid.UUID, newToken *model.UpdateTokens) error
+	ListSessions(ctx context.Context, profileID uuid.UUID) ([]*model.Session, error)
+	GetSessionState(ctx context.Context, id uuid.UUID) (*model.SessionState, error)
+	RevokeSession(ctx context.Context, profileID, id uuid.UUID) error
+	RevokeAllSessions(ctx context.Context, profileID, exceptID uuid.UUID) (int64, error)
 	GetIDByLoginPassword(ctx context.Context, login string) (uuid.UUID, []byte, error)
-	DeleteProfileByID(ctx context.Context, id uuid.UUID) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, password []byte) error
+	ChangePassword(ctx context.Context, id uuid.UUID, password []byte, exceptID uuid.UUID) (int64, error)
+	CreatePasswordReset(ctx context.Context, reset *model.PasswordReset, cooldown time.Duration) error
+	ResetPassword(ctx context.Context, tokenHash, password []byte) (uuid.UUID, int64, error)
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (*model.Profile, error)
+	SaveTOTP(ctx context.Context, totp *model.TOTP) error
+	GetTOTP(ctx context.Context, profileID uuid.UUID) (*model.TOTP, error)
+	ConfirmTOTP(ctx context.Context, profileID uuid.UUID, step int64, recoveryHashes [][]byte) error
+	UseTOTPStep(ctx context.Context, profileID uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, profileID uuid.UUID, hash []byte) error
+	DeleteTOTP(ctx context.Context, profileID uuid.UUID) error
+	CreateWebAuthnChallenge(ctx context.Context, challenge *model.WebAuthnChallenge) error
+	UseWebAuthnChallenge(ctx context.Context, ceremony string, hash []byte) (uuid.UUID, error)
+	SavePasskey(ctx context.Context, passkey *model.Passkey) error
+	GetPasskey(ctx context.Context, credentialID []byte) (*model.Passkey, error)
+	ListPasskeys(ctx context.Context, profileID uuid.UUID) ([]*model.Passkey, error)
+	UsePasskey(ctx context.Context, credentialID []byte, signCount int64) error
+	ListProfileRoles(ctx context.Context, profileID uuid.UUID) ([]*model.Role, error)
+	AssignRole(ctx context.Context, profileID uuid.UUID, role string) error
+	RevokeRole(ctx context.Context, profileID uuid.UUID, role string) error
+	RolePermissions(ctx context.Context) (map[string][]string, error)
+	DeleteProfileByID(ctx context.Context, id uuid.UUID, version int64) error
 }
 
 // GetProfileByID returns a profile by given ID
-func (s *ProfileService) GetProfileByID(ctx context.Context, id uuid.UUID) (*model.Profile, error) {
+func (s *ProfileService) GetProfileByID(ctx context.Context, id uuid.UUID) (profile *model.Profile, err error) {
+	ctx, span := startSpan(ctx, "GetProfileByID")
+	defer func() { endSpan(span, err) }()
 	return s.rps.GetProfileByID(ctx, id)
 }
 
-// CreateNewProfile function creates new profile
-func (s *ProfileService) CreateNewProfile(ctx context.Context, profile *model.Profile) error {
-	return s.rps.CreateProfile(ctx, profile)
+// CreateNewProfile function validates the plaintext password against the policy, hashes it and creates new profile
+func (s *ProfileService) CreateNewProfile(ctx context.Context, profile *model.Profile) (err error) {
+	ctx, span := startSpan(ctx, "CreateNewProfile")
+	defer func() { endSpan(span, err) }()
+	if profile.Login == "" {
+		return fmt.Errorf("CreateNewProfile: %w", model.NewValidationError("Login", "must not be empty"))
+	}
+	if profile.Email != "" {
+		if violation := validateEmail(profile.Email); violation != nil {
+			return fmt.Errorf("CreateNewProfile: %w", &model.ValidationError{Violations: []model.FieldViolation{*violation}})
+		}
+	}
+	err = s.policy.Validate(string(profile.Password))
+	if err != nil {
+		return fmt.Errorf("Validate: %w", err)
+	}
+	hash, err := s.hashPassword(ctx, profile.Password)
+	if err != nil {
+		return fmt.Errorf("Hash: %w", err)
+	}
+	profile.Password = hash
+	err = s.rps.CreateProfile(ctx, profile)
+	if err != nil {
+		return err
+	}
+	s.recorder.ProfileCreated()
+	return nil
+}
+
+// UpdateProfile function validates and applies a partial update of the profile, returning the updated profile
+func (s *ProfileService) UpdateProfile(ctx context.Context, update *model.ProfileUpdate) (updated *model.Profile, err error) {
+	ctx, span := startSpan(ctx, "UpdateProfile")
+	defer func() { endSpan(span, err) }()
+	verr := &model.ValidationError{}
+	if update.Login != nil {
+		*update.Login = strings.TrimSpace(*update.Login)
+		if *update.Login == "" {
+			verr.Violations = append(verr.Violations, model.FieldViolation{Field: "Login", Description: "must not be empty"})
+		}
+		if utf8.RuneCountInString(*update.Login) > maxFieldLength {
+			verr.Violations = append(verr.Violations, model.FieldViolation{Field: "Login", Description: fmt.Sprintf("must be at most %d characters long", maxFieldLength)})
+		}
+	}
+	if update.Username != nil && utf8.RuneCountInString(*update.Username) > maxFieldLength {
+		verr.Violations = append(verr.Violations, model.FieldViolation{Field: "Username", Description: fmt.Sprintf("must be at most %d characters long", maxFieldLength)})
+	}
+	if update.Email != nil {
+		*update.Email = strings.TrimSpace(*update.Email)
+		// an empty email removes it
+		if violation := validateEmail(*update.Email); *update.Email != "" && violation != nil {
+			verr.Violations = append(verr.Violations, *violation)
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return nil, fmt.Errorf("UpdateProfile: %w", verr)
+	}
+	profile, err := s.rps.UpdateProfile(ctx, update)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateProfile: %w", err)
+	}
+	return profile, nil
+}
+
+// Login function verifies login and password and issues a new pair of tokens.
+// Too many failed attempts temporarily lock the account or the source IP
+func (s *ProfileService) Login(ctx context.Context, login *model.Auth) (tokens *model.Tokens, err error) {
+	ctx, span := startSpan(ctx, "Login")
+	defer func() { endSpan(span, err) }()
+	defer func() { s.recordLogin(LoginMethodPassword, tokens, err) }()
+	id, hash, err := s.rps.GetIDByLoginPassword(ctx, login.Login)
+	notFound := errors.Is(err, model.ErrNotFound)
+	if err != nil && !notFound {
+		return nil, fmt.Errorf("GetIDByLoginPassword: %w", err)
+	}
+	err = s.lockout.Check(ctx, lockout.Account(id, login.Login), login.ClientIP)
+	if err != nil {
+		return nil, fmt.Errorf("Check: %w", err)
+	}
+	if notFound {
+		return nil, s.loginFailed(ctx, uuid.Nil, login)
+	}
+	rehash, err := s.verifyPassword(ctx, id, hash, login)
+	if err != nil {
+		return nil, err
+	}
+	if rehash {
+		s.rehashPassword(ctx, id, login.Password)
+	}
+	enabled, err := s.totpEnabled(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		// failed attempts are kept until the second factor is verified as well
+		return s.issueMFAChallenge(id, login)
+	}
+	s.loginSucceeded(ctx, id)
+	return s.issueTokens(ctx, id, login)
+}
+
+// verifyPassword function checks the plaintext password of auth against the stored hash,
+// a mismatch is counted against the lockout of the login and its source IP
+func (s *ProfileService) verifyPassword(ctx context.Context, id uuid.UUID, hash []byte, auth *model.Auth) (rehash bool, err error) {
+	_, span := tracer.Start(ctx, "password.Verify")
+	ok, rehash, err := s.hasher.Verify(hash, auth.Password)
+	span.End()
+	if err != nil {
+		return false, fmt.Errorf("Verify: %w", err)
+	}
+	if !ok {
+		return false, s.loginFailed(ctx, id, auth)
+	}
+	return rehash, nil
+}
+
+// loginSucceeded function resets failed login attempts of the profile once every factor is verified
+func (s *ProfileService) loginSucceeded(ctx context.Context, id uuid.UUID) {
+	err := s.lockout.Succeed(ctx, lockout.ProfileAccount(id))
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": id}).Errorf("Succeed: %v", err)
+	}
+}
+
+// recordLogin function reports a result of a login attempt, rejected credentials, challenges and locks are failures
+// while other errors mean the service could not decide
+func (s *ProfileService) recordLogin(method string, tokens *model.Tokens, err error) {
+	var locked *model.LockedError
+	switch {
+	case err == nil && tokens.MFAChallenge != "":
+		s.recorder.LoginAttempted(method, LoginMFARequired)
+	case err == nil:
+		s.recorder.LoginAttempted(method, LoginSucceeded)
+	case errors.Is(err, model.ErrInvalidCredentials), errors.Is(err, model.ErrInvalidToken), errors.As(err, &locked):
+		s.recorder.LoginAttempted(method, LoginFailed)
+	default:
+		s.recorder.LoginAttempted(method, LoginErrored)
+	}
+}
+
+// loginFailed function counts a failed login against the profile, or the typed login if id is nil, and returns
+// an error to report, which is a *model.LockedError if the failure locked the account
+func (s *ProfileService) loginFailed(ctx context.Context, id uuid.UUID, login *model.Auth) error {
+	lockedFor, err := s.lockout.Fail(ctx, lockout.Account(id, login.Login), login.ClientIP)
+	if err != nil {
+		return fmt.Errorf("Fail: %w", err)
+	}
+	if lockedFor == 0 {
+		return fmt.Errorf("Verify: %w", model.ErrInvalidCredentials)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventAccountLocked,
+		ProfileID: id,
+		Details: map[string]interface{}{
+			"login":      login.Login,
+			"client_ip":  login.ClientIP,
+			"locked_for": lockedFor.String(),
+		},
+	})
+	return fmt.Errorf("Fail: %w", &model.LockedError{RetryAfter: lockedFor})
+}
+
+// UnlockProfile function removes a lock and failed login attempts of the profile
+func (s *ProfileService) UnlockProfile(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "UnlockProfile")
+	defer func() { endSpan(span, err) }()
+	_, err = s.rps.GetProfileByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("GetProfileByID: %w", err)
+	}
+	err = s.lockout.Unlock(ctx, lockout.ProfileAccount(id))
+	if err != nil {
+		return fmt.Errorf("Unlock: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{Type: audit.EventAccountUnlocked, ProfileID: id})
+	return nil
 }
 
-func (s *ProfileService) UpdateProfile(ctx context.Context, profile *model.UpdateTokens) error {
-	return s.rps.SaveRefreshToken(ctx, profile)
+// hashPassword function hashes the plaintext password, hashing is deliberately slow, so it is traced on its own
+func (s *ProfileService) hashPassword(ctx context.Context, plaintext []byte) ([]byte, error) {
+	_, span := tracer.Start(ctx, "password.Hash")
+	defer span.End()
+	return s.hasher.Hash(plaintext)
 }
 
-func (s *ProfileService) Login(ctx context.Context, login *model.Auth) (uuid.UUID, error) {
-	id, password, err := s.rps.GetIDByLoginPassword(ctx, login.Login)
+// rehashPassword function replaces an outdated password hash, login must not fail because of it
+func (s *ProfileService) rehashPassword(ctx context.Context, id uuid.UUID, plaintext []byte) {
+	hash, err := s.hashPassword(ctx, plaintext)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("GetIDByLoginPassword: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": id}).Errorf("Hash: %v", err)
+		return
 	}
-	err = bcrypt.CompareHashAndPassword(password, []byte(login.Password))
+	err = s.rps.UpdatePassword(ctx, id, hash)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("CompareHashAndPassword: %w", err)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"ID": id}).Errorf("UpdatePassword: %v", err)
 	}
-	return id, nil
 }
 
-func (s *ProfileService) DeleteProfileByID(ctx context.Context, id uuid.UUID) error {
-	return s.rps.DeleteProfileByID(ctx, id)
+// DeleteProfileByID function deletes the profile, a non-zero version must match the current one
+func (s *ProfileService) DeleteProfileByID(ctx context.Context, id uuid.UUID, version int64) (err error) {
+	ctx, span := startSpan(ctx, "DeleteProfileByID")
+	defer func() { endSpan(span, err) }()
+	return s.rps.DeleteProfileByID(ctx, id, version)
 }
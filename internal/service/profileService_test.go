@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLocksAfterFailures(t *testing.T) {
+	auth := &model.Auth{Login: "locked_login", Password: []byte("wrong"), ClientIP: "10.0.0.1"}
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, auth.Login).Return(uuid.Nil, nil, fmt.Errorf("QueryRow: %w", model.ErrNotFound)).Times(4)
+	testAudit.events = nil
+	testRecorder.reset()
+
+	for i := 0; i < 2; i++ {
+		_, err := testService.Login(context.Background(), auth)
+		require.ErrorIs(t, err, model.ErrInvalidCredentials)
+	}
+	_, err := testService.Login(context.Background(), auth)
+	require.ErrorIs(t, err, model.ErrLocked)
+	require.Len(t, testAudit.events, 1)
+	require.Equal(t, audit.EventAccountLocked, testAudit.events[0].Type)
+
+	// a locked login is rejected before credentials are checked
+	_, err = testService.Login(context.Background(), auth)
+	require.ErrorIs(t, err, model.ErrLocked)
+	require.Equal(t, map[string]int{"password/failure": 4}, testRecorder.logins)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestLoginCountsFailuresPerProfile(t *testing.T) {
+	profile := newPasswordProfile(t, "shared_login", "right-password")
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "shared_login").Return(profile.ID, profile.Password, nil).Twice()
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "shared@example.com").Return(profile.ID, profile.Password, nil).Twice()
+
+	// the login and the verified email of the profile share a counter
+	for _, login := range []string{"shared_login", "shared_login"} {
+		_, err := testService.Login(context.Background(), &model.Auth{Login: login, Password: []byte("wrong")})
+		require.ErrorIs(t, err, model.ErrInvalidCredentials)
+	}
+	_, err := testService.Login(context.Background(), &model.Auth{Login: "shared@example.com", Password: []byte("wrong")})
+	require.ErrorIs(t, err, model.ErrLocked)
+	_, err = testService.Login(context.Background(), &model.Auth{Login: "shared@example.com", Password: []byte("right-password")})
+	require.ErrorIs(t, err, model.ErrLocked)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestCreateNewProfileRecordsCreation(t *testing.T) {
+	testRecorder.reset()
+	mockRepository.On("CreateProfile", mock.Anything, mock.MatchedBy(func(profile *model.Profile) bool {
+		return profile.Login == "created_login"
+	})).Return(nil).Once()
+	mockRepository.On("CreateProfile", mock.Anything, mock.MatchedBy(func(profile *model.Profile) bool {
+		return profile.Login == "taken_login"
+	})).Return(model.ErrAlreadyExists).Once()
+
+	err := testService.CreateNewProfile(context.Background(), &model.Profile{Login: "created_login", Password: []byte("password")})
+	require.NoError(t, err)
+	err = testService.CreateNewProfile(context.Background(), &model.Profile{Login: "taken_login", Password: []byte("password")})
+	require.ErrorIs(t, err, model.ErrAlreadyExists)
+	require.Equal(t, 1, testRecorder.created)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestCreateNewProfileStoresHash(t *testing.T) {
+	mockRepository.On("CreateProfile", mock.Anything, mock.MatchedBy(func(profile *model.Profile) bool {
+		if profile.Login != "hashed_login" || string(profile.Password) == "plain-password" {
+			return false
+		}
+		ok, _, err := testService.hasher.Verify(profile.Password, []byte("plain-password"))
+		return err == nil && ok
+	})).Return(nil).Once()
+
+	err := testService.CreateNewProfile(context.Background(), &model.Profile{Login: "hashed_login", Password: []byte("plain-password")})
+	require.NoError(t, err)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestUnlockProfile(t *testing.T) {
+	profile := newPasswordProfile(t, "unlocked_login", "right-password")
+	auth := &model.Auth{Login: profile.Login, Password: []byte("wrong")}
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, auth.Login).Return(profile.ID, profile.Password, nil).Times(5)
+	mockRepository.On("GetProfileByID", mock.Anything, profile.ID).Return(profile, nil).Once()
+	for i := 0; i < 3; i++ {
+		_, _ = testService.Login(context.Background(), auth)
+	}
+	_, err := testService.Login(context.Background(), auth)
+	require.ErrorIs(t, err, model.ErrLocked)
+
+	err = testService.UnlockProfile(context.Background(), profile.ID)
+	require.NoError(t, err)
+	_, err = testService.Login(context.Background(), auth)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestUpdateProfileValidates(t *testing.T) {
+	login := "   "
+	_, err := testService.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: uuid.New(), Login: &login})
+	require.ErrorIs(t, err, model.ErrInvalidArgument)
+
+	login = " new_login "
+	updated := &model.Profile{ID: uuid.New(), Login: "new_login"}
+	mockRepository.On("UpdateProfile", mock.Anything, mock.MatchedBy(func(update *model.ProfileUpdate) bool {
+		return *update.Login == "new_login" && update.Username == nil
+	})).Return(updated, nil).Once()
+	profile, err := testService.UpdateProfile(context.Background(), &model.ProfileUpdate{ID: updated.ID, Login: &login})
+	require.NoError(t, err)
+	require.Equal(t, updated, profile)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
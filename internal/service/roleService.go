@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ListRoles function returns roles of the profile with their permissions
+func (s *ProfileService) ListRoles(ctx context.Context, profileID uuid.UUID) (roles []*model.Role, err error) {
+	ctx, span := startSpan(ctx, "ListRoles")
+	defer func() { endSpan(span, err) }()
+	return s.rps.ListProfileRoles(ctx, profileID)
+}
+
+// AssignRole function assigns the role to the profile, it is reflected in access tokens issued afterwards
+func (s *ProfileService) AssignRole(ctx context.Context, profileID uuid.UUID, role string) (err error) {
+	ctx, span := startSpan(ctx, "AssignRole")
+	defer func() { endSpan(span, err) }()
+	if role == "" {
+		return fmt.Errorf("AssignRole: %w", model.NewValidationError("Role", "must not be empty"))
+	}
+	err = s.rps.AssignRole(ctx, profileID, role)
+	if err != nil {
+		return fmt.Errorf("AssignRole: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{Type: audit.EventRoleAssigned, ProfileID: profileID, Details: map[string]interface{}{"role": role}})
+	return nil
+}
+
+// RevokeRole function removes the role from the profile, access tokens issued before keep it until they expire
+func (s *ProfileService) RevokeRole(ctx context.Context, profileID uuid.UUID, role string) (err error) {
+	ctx, span := startSpan(ctx, "RevokeRole")
+	defer func() { endSpan(span, err) }()
+	err = s.rps.RevokeRole(ctx, profileID, role)
+	if err != nil {
+		return fmt.Errorf("RevokeRole: %w", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{Type: audit.EventRoleRevoked, ProfileID: profileID, Details: map[string]interface{}{"role": role}})
+	return nil
+}
+
+// RolePermissions function returns permissions of every role by its name
+func (s *ProfileService) RolePermissions(ctx context.Context) (permissions map[string][]string, err error) {
+	ctx, span := startSpan(ctx, "RolePermissions")
+	defer func() { endSpan(span, err) }()
+	return s.rps.RolePermissions(ctx)
+}
+
+// roleNames function returns names of the profile roles to embed into access tokens
+func (s *ProfileService) roleNames(ctx context.Context, profileID uuid.UUID) ([]string, error) {
+	roles, err := s.rps.ListProfileRoles(ctx, profileID)
+	if err != nil {
+		return nil, fmt.Errorf("ListProfileRoles: %w", err)
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignRole(t *testing.T) {
+	id := uuid.New()
+	mockRepository.On("AssignRole", mock.Anything, id, model.RoleAdmin).Return(nil).Once()
+	mockRepository.On("AssignRole", mock.Anything, id, "missing").Return(fmt.Errorf("exec: %w", model.ErrNotFound)).Once()
+	testAudit.events = nil
+
+	err := testService.AssignRole(context.Background(), id, model.RoleAdmin)
+	require.NoError(t, err)
+	require.Len(t, testAudit.events, 1)
+	require.Equal(t, audit.EventRoleAssigned, testAudit.events[0].Type)
+	require.Equal(t, model.RoleAdmin, testAudit.events[0].Details["role"])
+
+	err = testService.AssignRole(context.Background(), id, "missing")
+	require.ErrorIs(t, err, model.ErrNotFound)
+	err = testService.AssignRole(context.Background(), id, "")
+	require.ErrorIs(t, err, model.ErrInvalidArgument)
+	require.Len(t, testAudit.events, 1)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestRevokeRole(t *testing.T) {
+	id := uuid.New()
+	mockRepository.On("RevokeRole", mock.Anything, id, model.RoleAdmin).Return(nil).Once()
+	mockRepository.On("RevokeRole", mock.Anything, id, model.RoleAdmin).Return(fmt.Errorf("exec: %w", model.ErrNotFound)).Once()
+	testAudit.events = nil
+
+	err := testService.RevokeRole(context.Background(), id, model.RoleAdmin)
+	require.NoError(t, err)
+	err = testService.RevokeRole(context.Background(), id, model.RoleAdmin)
+	require.ErrorIs(t, err, model.ErrNotFound)
+	require.Len(t, testAudit.events, 1)
+	require.Equal(t, audit.EventRoleRevoked, testAudit.events[0].Type)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
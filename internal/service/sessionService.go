@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+
+	"github.com/eugenshima/profile/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ListSessions function returns active sessions of the profile
+func (s *ProfileService) ListSessions(ctx context.Context, profileID uuid.UUID) (sessions []*model.Session, err error) {
+	ctx, span := startSpan(ctx, "ListSessions")
+	defer func() { endSpan(span, err) }()
+	return s.rps.ListSessions(ctx, profileID)
+}
+
+// RevokeSession function revokes a session of the profile, its refresh tokens stop working immediately.
+// uuid.Nil profileID revokes the session of any profile
+func (s *ProfileService) RevokeSession(ctx context.Context, profileID, id uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "RevokeSession")
+	defer func() { endSpan(span, err) }()
+	return s.rps.RevokeSession(ctx, profileID, id)
+}
+
+// RevokeAllSessions function revokes every session of the profile except the given one, uuid.Nil keeps none
+func (s *ProfileService) RevokeAllSessions(ctx context.Context, profileID, exceptID uuid.UUID) (revoked int64, err error) {
+	ctx, span := startSpan(ctx, "RevokeAllSessions")
+	defer func() { endSpan(span, err) }()
+	return s.rps.RevokeAllSessions(ctx, profileID, exceptID)
+}
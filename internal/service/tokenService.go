@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/token"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// RefreshTokens function exchanges a valid refresh token for a new pair of tokens, the old refresh token stops working.
+// Presenting an already rotated refresh token revokes its whole family
+func (s *ProfileService) RefreshTokens(ctx context.Context, refreshToken string) (tokens *model.Tokens, err error) {
+	ctx, span := startSpan(ctx, "RefreshTokens")
+	defer func() { endSpan(span, err) }()
+	current, err := s.rps.GetRefreshToken(ctx, token.HashRefreshToken(refreshToken))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("GetRefreshToken: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetRefreshToken: %w", err)
+	}
+	switch {
+	case current.RevokedAt != nil:
+		return nil, fmt.Errorf("refresh token revoked: %w", model.ErrInvalidToken)
+	case current.RotatedAt != nil:
+		s.revokeReusedFamily(ctx, current)
+		return nil, fmt.Errorf("refresh token reused: %w", model.ErrInvalidToken)
+	case time.Now().After(current.ExpiresAt):
+		return nil, fmt.Errorf("refresh token expired: %w", model.ErrInvalidToken)
+	}
+
+	newRefreshToken, hash, expiresAt, err := s.tokens.NewRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("NewRefreshToken: %w", err)
+	}
+	err = s.rps.RotateRefreshToken(ctx, current.ID, &model.UpdateTokens{
+		ID:           current.ProfileID,
+		FamilyID:     current.FamilyID,
+		RefreshToken: hash,
+		ExpiresAt:    expiresAt,
+	})
+	if errors.Is(err, model.ErrNotFound) {
+		// the token was rotated concurrently, which is a reuse as well
+		s.revokeReusedFamily(ctx, current)
+		return nil, fmt.Errorf("RotateRefreshToken: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+	accessToken, accessExpiresAt, err := s.issueAccessToken(ctx, current.ProfileID, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Tokens{
+		ProfileID:             current.ProfileID,
+		SessionID:             current.FamilyID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          newRefreshToken,
+		RefreshTokenExpiresAt: expiresAt,
+	}, nil
+}
+
+// ValidateToken function verifies an access token and returns its claims,
+// tokens of a revoked session or issued before the password was changed or reset are rejected before they expire
+func (s *ProfileService) ValidateToken(ctx context.Context, accessToken string) (claims *model.AccessClaims, err error) {
+	ctx, span := startSpan(ctx, "ValidateToken")
+	defer func() { endSpan(span, err) }()
+	claims, err = s.tokens.ValidateAccessToken(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("ValidateAccessToken: %w", err)
+	}
+	state, err := s.rps.GetSessionState(ctx, claims.SessionID)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("GetSessionState: %w", model.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetSessionState: %w", err)
+	}
+	if state.RevokedAt != nil || state.ProfileID != claims.ProfileID {
+		return nil, fmt.Errorf("session revoked: %w", model.ErrInvalidToken)
+	}
+	if state.CredentialsVersion != claims.CredentialsVersion {
+		return nil, fmt.Errorf("credentials changed: %w", model.ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// issueAccessToken function signs an access token of the session with the current roles and credentials version of the profile
+func (s *ProfileService) issueAccessToken(ctx context.Context, profileID, sessionID uuid.UUID) (string, time.Time, error) {
+	roles, err := s.roleNames(ctx, profileID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	state, err := s.rps.GetSessionState(ctx, sessionID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("GetSessionState: %w", err)
+	}
+	accessToken, expiresAt, err := s.tokens.IssueAccessToken(profileID, sessionID, state.CredentialsVersion, roles)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("IssueAccessToken: %w", err)
+	}
+	return accessToken, expiresAt, nil
+}
+
+// issueTokens function starts a new session described by auth and issues a new pair of tokens for it
+func (s *ProfileService) issueTokens(ctx context.Context, id uuid.UUID, auth *model.Auth) (*model.Tokens, error) {
+	refreshToken, hash, expiresAt, err := s.tokens.NewRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("NewRefreshToken: %w", err)
+	}
+	session := &model.UpdateTokens{
+		ID:           id,
+		RefreshToken: hash,
+		Device:       auth.Device,
+		UserAgent:    auth.UserAgent,
+		ClientIP:     auth.ClientIP,
+		ExpiresAt:    expiresAt,
+	}
+	err = s.rps.SaveRefreshToken(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("SaveRefreshToken: %w", err)
+	}
+	accessToken, accessExpiresAt, err := s.issueAccessToken(ctx, id, session.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Tokens{
+		ProfileID:             id,
+		SessionID:             session.FamilyID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: expiresAt,
+	}, nil
+}
+
+// revokeReusedFamily function revokes a session after one of its rotated refresh tokens was presented again
+func (s *ProfileService) revokeReusedFamily(ctx context.Context, reused *model.RefreshToken) {
+	err := s.rps.RevokeSession(ctx, reused.ProfileID, reused.FamilyID)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		logging.FromContext(ctx).WithFields(logrus.Fields{"FamilyID": reused.FamilyID}).Errorf("RevokeSession: %v", err)
+	}
+	s.audit.Emit(ctx, &audit.Event{
+		Type:      audit.EventRefreshTokenReuse,
+		ProfileID: reused.ProfileID,
+		Details: map[string]interface{}{
+			"family_id": reused.FamilyID,
+			"token_id":  reused.ID,
+		},
+	})
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/lockout"
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/notify"
+	"github.com/eugenshima/profile/internal/password"
+	"github.com/eugenshima/profile/internal/secretbox"
+	"github.com/eugenshima/profile/internal/service/mocks"
+	"github.com/eugenshima/profile/internal/token"
+	"github.com/eugenshima/profile/internal/webauthn"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	mockRepository *mocks.ProfileRepositoryInterface
+	testAudit      *recordingSink
+	testNotifier   *recordingNotifier
+	testRecorder   *countingRecorder
+	testService    *ProfileService
+	testBox        *secretbox.Box
+)
+
+// Relying party of passkey tests
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// recordingSink struct keeps emitted audit events in memory
+type recordingSink struct {
+	events []*audit.Event
+}
+
+func (s *recordingSink) Emit(_ context.Context, event *audit.Event) {
+	s.events = append(s.events, event)
+}
+
+// recordingNotifier struct keeps sent messages in memory
+type recordingNotifier struct {
+	messages []*notify.Message
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, msg *notify.Message) error {
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// countingRecorder struct counts recorded business events
+type countingRecorder struct {
+	logins  map[string]int
+	created int
+}
+
+func (r *countingRecorder) LoginAttempted(method, result string) {
+	r.logins[method+"/"+result]++
+}
+
+func (r *countingRecorder) ProfileCreated() {
+	r.created++
+}
+
+// reset function forgets events recorded by previous tests
+func (r *countingRecorder) reset() {
+	r.logins, r.created = make(map[string]int), 0
+}
+
+// TestMain execute all tests
+func TestMain(m *testing.M) {
+	tokens, err := token.NewManager(token.AlgorithmHS256, []byte("0123456789abcdef0123456789abcdef"), "profile", time.Minute, time.Hour)
+	if err != nil {
+		fmt.Println("Could not create token manager: ", err)
+		os.Exit(1)
+	}
+	testBox, err = secretbox.NewBox([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		fmt.Println("Could not create secret box: ", err)
+		os.Exit(1)
+	}
+	rp, err := webauthn.NewRelyingParty(webauthn.Config{ID: testRPID, Name: "Example", Origins: []string{testOrigin}, RequireUserVerification: true})
+	if err != nil {
+		fmt.Println("Could not create relying party: ", err)
+		os.Exit(1)
+	}
+	mockRepository = new(mocks.ProfileRepositoryInterface)
+	testAudit = &recordingSink{}
+	testNotifier = &recordingNotifier{}
+	testRecorder = &countingRecorder{logins: make(map[string]int)}
+	testService = NewProfileService(mockRepository, &password.Policy{}, password.NewManager(&password.BcryptHasher{Cost: 4}), tokens,
+		lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{MaxAccountFailures: 3, Window: time.Minute, BaseDuration: time.Minute}),
+		testNotifier, Lifetimes{PasswordReset: time.Hour, EmailVerification: time.Hour, MFAChallenge: time.Minute, WebAuthnChallenge: time.Minute},
+		MFA{Box: testBox, Issuer: "profile", RecoveryCodes: 10}, rp, testAudit, testRecorder)
+	exitVal := m.Run()
+	os.Exit(exitVal)
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	current := &model.RefreshToken{ID: uuid.New(), FamilyID: uuid.New(), ProfileID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)}
+	mockRepository.On("GetRefreshToken", mock.Anything, token.HashRefreshToken("refresh")).Return(current, nil).Once()
+	mockRepository.On("RotateRefreshToken", mock.Anything, current.ID, mock.MatchedBy(func(next *model.UpdateTokens) bool {
+		return next.FamilyID == current.FamilyID && next.ID == current.ProfileID
+	})).Return(nil).Once()
+	mockRepository.On("ListProfileRoles", mock.Anything, current.ProfileID).Return([]*model.Role{{Name: model.RoleAdmin}, {Name: model.RoleUser}}, nil).Once()
+	mockRepository.On("GetSessionState", mock.Anything, current.FamilyID).Return(&model.SessionState{ProfileID: current.ProfileID, CredentialsVersion: 2}, nil).Twice()
+
+	tokens, err := testService.RefreshTokens(context.Background(), "refresh")
+	require.NoError(t, err)
+	require.Equal(t, current.ProfileID, tokens.ProfileID)
+	require.Equal(t, current.FamilyID, tokens.SessionID)
+	require.NotEqual(t, "refresh", tokens.RefreshToken)
+	claims, err := testService.ValidateToken(context.Background(), tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, []string{model.RoleAdmin, model.RoleUser}, claims.Roles)
+	require.Equal(t, int64(2), claims.CredentialsVersion)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestRefreshTokensReuseRevokesFamily(t *testing.T) {
+	rotatedAt := time.Now().Add(-time.Minute)
+	reused := &model.RefreshToken{ID: uuid.New(), FamilyID: uuid.New(), ProfileID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour), RotatedAt: &rotatedAt}
+	mockRepository.On("GetRefreshToken", mock.Anything, token.HashRefreshToken("stolen")).Return(reused, nil).Once()
+	mockRepository.On("RevokeSession", mock.Anything, reused.ProfileID, reused.FamilyID).Return(nil).Once()
+	testAudit.events = nil
+
+	tokens, err := testService.RefreshTokens(context.Background(), "stolen")
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+	require.Nil(t, tokens)
+	require.Len(t, testAudit.events, 1)
+	require.Equal(t, audit.EventRefreshTokenReuse, testAudit.events[0].Type)
+	require.Equal(t, reused.ProfileID, testAudit.events[0].ProfileID)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestRefreshTokensConcurrentRotation(t *testing.T) {
+	current := &model.RefreshToken{ID: uuid.New(), FamilyID: uuid.New(), ProfileID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)}
+	mockRepository.On("GetRefreshToken", mock.Anything, token.HashRefreshToken("raced")).Return(current, nil).Once()
+	mockRepository.On("RotateRefreshToken", mock.Anything, current.ID, mock.AnythingOfType("*model.UpdateTokens")).Return(fmt.Errorf("exec: %w", model.ErrNotFound)).Once()
+	mockRepository.On("RevokeSession", mock.Anything, current.ProfileID, current.FamilyID).Return(nil).Once()
+
+	_, err := testService.RefreshTokens(context.Background(), "raced")
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestRefreshTokensRejected(t *testing.T) {
+	revokedAt := time.Now()
+	revoked := &model.RefreshToken{ID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}
+	expired := &model.RefreshToken{ID: uuid.New(), ExpiresAt: time.Now().Add(-time.Hour)}
+	mockRepository.On("GetRefreshToken", mock.Anything, token.HashRefreshToken("revoked")).Return(revoked, nil).Once()
+	mockRepository.On("GetRefreshToken", mock.Anything, token.HashRefreshToken("expired")).Return(expired, nil).Once()
+	mockRepository.On("GetRefreshToken", mock.Anything, token.HashRefreshToken("unknown")).Return(nil, fmt.Errorf("QueryRow: %w", model.ErrNotFound)).Once()
+
+	for _, refreshToken := range []string{"revoked", "expired", "unknown"} {
+		_, err := testService.RefreshTokens(context.Background(), refreshToken)
+		require.ErrorIs(t, err, model.ErrInvalidToken)
+	}
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
+
+func TestValidateTokenRejectsRevokedSessionsAndChangedCredentials(t *testing.T) {
+	profileID := uuid.New()
+	revokedAt := time.Now()
+	sessions := map[uuid.UUID]*model.SessionState{
+		uuid.New(): {ProfileID: profileID, CredentialsVersion: 1},
+		uuid.New(): {ProfileID: profileID, RevokedAt: &revokedAt, CredentialsVersion: 1},
+		uuid.New(): {ProfileID: uuid.New(), CredentialsVersion: 1},
+		// the password was changed after the token was issued
+		uuid.New(): {ProfileID: profileID, CredentialsVersion: 2},
+	}
+	for sessionID, state := range sessions {
+		mockRepository.On("GetSessionState", mock.Anything, sessionID).Return(state, nil).Once()
+	}
+	missing := uuid.New()
+	mockRepository.On("GetSessionState", mock.Anything, missing).Return(nil, fmt.Errorf("QueryRow: %w", model.NewNotFoundError("Session"))).Once()
+
+	for sessionID, state := range sessions {
+		accessToken, _, err := testService.tokens.IssueAccessToken(profileID, sessionID, 1, nil)
+		require.NoError(t, err)
+		_, err = testService.ValidateToken(context.Background(), accessToken)
+		if state.RevokedAt == nil && state.ProfileID == profileID && state.CredentialsVersion == 1 {
+			require.NoError(t, err)
+		} else {
+			require.ErrorIs(t, err, model.ErrInvalidToken)
+		}
+	}
+	accessToken, _, err := testService.tokens.IssueAccessToken(profileID, missing, 1, nil)
+	require.NoError(t, err)
+	_, err = testService.ValidateToken(context.Background(), accessToken)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
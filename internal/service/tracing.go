@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans of ProfileService methods
+var tracer = otel.Tracer("github.com/eugenshima/profile/internal/service")
+
+// startSpan function starts a span of the ProfileService method, every exported method starts with it
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "ProfileService."+method)
+}
+
+// endSpan function ends the span, marking it failed with err if it is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLoginSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	id := uuid.New()
+	hash, err := testService.hasher.Hash([]byte("password"))
+	require.NoError(t, err)
+	mockRepository.On("GetIDByLoginPassword", mock.Anything, "traced_login").Return(id, hash, nil).Once()
+
+	_, err = testService.Login(context.Background(), &model.Auth{Login: "traced_login", Password: []byte("wrong"), ClientIP: "10.0.0.2"})
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	verify, login := spans[0], spans[1]
+	require.Equal(t, "password.Verify", verify.Name())
+	require.Equal(t, login.SpanContext().SpanID(), verify.Parent().SpanID())
+	require.Equal(t, "ProfileService.Login", login.Name())
+	require.Equal(t, codes.Error, login.Status().Code)
+
+	assertion := mockRepository.AssertExpectations(t)
+	require.True(t, assertion)
+}
@@ -0,0 +1,226 @@
+// Package token issues and verifies access and refresh tokens
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Supported signing algorithms of access tokens
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+// Purposes of single purpose tokens, the purpose is the audience of the token
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAChallenge      = "mfa_challenge"
+)
+
+// opaqueTokenLength is a number of random bytes in an opaque token
+const opaqueTokenLength = 32
+
+// Claims struct represents claims of a signed access token
+type Claims struct {
+	SessionID string `json:"sid,omitempty"`
+	// CredentialsVersion is a credentials version of the profile when the token was issued
+	CredentialsVersion int64    `json:"cv,omitempty"`
+	Roles              []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// PurposeClaims struct represents claims of a signed single purpose token
+type PurposeClaims struct {
+	// Data is bound to the token by its issuer, e.g. an email address being verified
+	Data string `json:"dat,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Manager struct signs access tokens, verifies them and generates opaque refresh tokens
+type Manager struct {
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewManager creates a new Manager. key is a shared secret for HS256
+// and a PEM encoded private key for EdDSA (Ed25519) and RS256
+func NewManager(algorithm string, key []byte, issuer string, accessTTL, refreshTTL time.Duration) (*Manager, error) {
+	m := &Manager{issuer: issuer, accessTTL: accessTTL, refreshTTL: refreshTTL}
+	switch algorithm {
+	case AlgorithmHS256:
+		if len(key) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes long")
+		}
+		m.method, m.signKey, m.verifyKey = jwt.SigningMethodHS256, key, key
+	case AlgorithmEdDSA:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(key)
+		if err != nil {
+			return nil, fmt.Errorf("ParseEdPrivateKeyFromPEM: %w", err)
+		}
+		edKey, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA key must be an Ed25519 private key")
+		}
+		m.method, m.signKey, m.verifyKey = jwt.SigningMethodEdDSA, edKey, edKey.Public()
+	case AlgorithmRS256:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+		if err != nil {
+			return nil, fmt.Errorf("ParseRSAPrivateKeyFromPEM: %w", err)
+		}
+		m.method, m.signKey, m.verifyKey = jwt.SigningMethodRS256, private, &private.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	return m, nil
+}
+
+// RefreshTTL returns a lifetime of refresh tokens
+func (m *Manager) RefreshTTL() time.Duration {
+	return m.refreshTTL
+}
+
+// IssueAccessToken function signs a new access token for the profile session,
+// the credentials version and roles of the profile are embedded into it
+func (m *Manager) IssueAccessToken(profileID, sessionID uuid.UUID, credentialsVersion int64, roles []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.accessTTL)
+	claims := &Claims{
+		SessionID:          sessionID.String(),
+		CredentialsVersion: credentialsVersion,
+		Roles:              roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   profileID.String(),
+			Issuer:    m.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("SignedString: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ValidateAccessToken function verifies signature, issuer and lifetime of the access token
+func (m *Manager) ValidateAccessToken(accessToken string) (*model.AccessClaims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(*jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	}, jwt.WithValidMethods([]string{m.method.Alg()}), jwt.WithIssuer(m.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("ParseWithClaims: %v: %w", err, model.ErrInvalidToken)
+	}
+	if len(claims.Audience) > 0 {
+		// single purpose tokens are never access tokens
+		return nil, fmt.Errorf("token has audience %v: %w", claims.Audience, model.ErrInvalidToken)
+	}
+	profileID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("Parse: %v: %w", err, model.ErrInvalidToken)
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("Parse: %v: %w", err, model.ErrInvalidToken)
+	}
+	accessClaims := &model.AccessClaims{
+		ProfileID:          profileID,
+		SessionID:          sessionID,
+		CredentialsVersion: claims.CredentialsVersion,
+		Roles:              claims.Roles,
+		TokenID:            claims.ID,
+		ExpiresAt:          claims.ExpiresAt.Time,
+	}
+	if claims.IssuedAt != nil {
+		accessClaims.IssuedAt = claims.IssuedAt.Time
+	}
+	return accessClaims, nil
+}
+
+// IssuePurposeToken function signs a token of the profile which is accepted only by ValidatePurposeToken of the same purpose
+func (m *Manager) IssuePurposeToken(purpose string, profileID uuid.UUID, data string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := &PurposeClaims{
+		Data: data,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   profileID.String(),
+			Audience:  jwt.ClaimStrings{purpose},
+			Issuer:    m.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("SignedString: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ValidatePurposeToken function verifies signature, issuer, lifetime and purpose of the token and returns its profile and data
+func (m *Manager) ValidatePurposeToken(purpose, signed string) (profileID uuid.UUID, data string, err error) {
+	claims := &PurposeClaims{}
+	_, err = jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	}, jwt.WithValidMethods([]string{m.method.Alg()}), jwt.WithIssuer(m.issuer), jwt.WithAudience(purpose), jwt.WithExpirationRequired())
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("ParseWithClaims: %v: %w", err, model.ErrInvalidToken)
+	}
+	profileID, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("Parse: %v: %w", err, model.ErrInvalidToken)
+	}
+	return profileID, claims.Data, nil
+}
+
+// NewRefreshToken function generates an opaque refresh token and the hash to be stored instead of it
+func (m *Manager) NewRefreshToken() (refreshToken string, hash []byte, expiresAt time.Time, err error) {
+	refreshToken, hash, err = NewOpaqueToken()
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	return refreshToken, hash, time.Now().Add(m.refreshTTL), nil
+}
+
+// HashRefreshToken function returns a hash of the refresh token, which is stored instead of the token itself
+func HashRefreshToken(refreshToken string) []byte {
+	return HashOpaqueToken(refreshToken)
+}
+
+// NewOpaqueToken function generates a random opaque token and the hash to be stored instead of it
+func NewOpaqueToken() (opaqueToken string, hash []byte, err error) {
+	raw := make([]byte, opaqueTokenLength)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return "", nil, fmt.Errorf("Read: %w", err)
+	}
+	opaqueToken = base64.RawURLEncoding.EncodeToString(raw)
+	return opaqueToken, HashOpaqueToken(opaqueToken), nil
+}
+
+// HashOpaqueToken function returns a SHA-256 hash of an opaque token
+func HashOpaqueToken(opaqueToken string) []byte {
+	sum := sha256.Sum256([]byte(opaqueToken))
+	return sum[:]
+}
@@ -0,0 +1,106 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func pemKey(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestAccessToken(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys := map[string][]byte{
+		AlgorithmHS256: testSecret,
+		AlgorithmEdDSA: pemKey(t, edKey),
+		AlgorithmRS256: pemKey(t, rsaKey),
+	}
+	for algorithm, key := range keys {
+		t.Run(algorithm, func(t *testing.T) {
+			manager, err := NewManager(algorithm, key, "profile", time.Minute, time.Hour)
+			require.NoError(t, err)
+
+			profileID, sessionID := uuid.New(), uuid.New()
+			accessToken, expiresAt, err := manager.IssueAccessToken(profileID, sessionID, 3, []string{model.RoleUser})
+			require.NoError(t, err)
+			require.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+			claims, err := manager.ValidateAccessToken(accessToken)
+			require.NoError(t, err)
+			require.Equal(t, profileID, claims.ProfileID)
+			require.Equal(t, sessionID, claims.SessionID)
+			require.Equal(t, int64(3), claims.CredentialsVersion)
+			require.Equal(t, []string{model.RoleUser}, claims.Roles)
+			require.NotEmpty(t, claims.TokenID)
+
+			_, err = manager.ValidateAccessToken(accessToken + "x")
+			require.ErrorIs(t, err, model.ErrInvalidToken)
+		})
+	}
+}
+
+func TestAccessTokenRejected(t *testing.T) {
+	manager, err := NewManager(AlgorithmHS256, testSecret, "profile", -time.Minute, time.Hour)
+	require.NoError(t, err)
+	expired, _, err := manager.IssueAccessToken(uuid.New(), uuid.New(), 1, nil)
+	require.NoError(t, err)
+	_, err = manager.ValidateAccessToken(expired)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	other, err := NewManager(AlgorithmHS256, []byte("another-secret-another-secret-xx"), "profile", time.Minute, time.Hour)
+	require.NoError(t, err)
+	foreign, _, err := other.IssueAccessToken(uuid.New(), uuid.New(), 1, nil)
+	require.NoError(t, err)
+	_, err = manager.ValidateAccessToken(foreign)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+
+	otherIssuer, err := NewManager(AlgorithmHS256, testSecret, "someone-else", time.Minute, time.Hour)
+	require.NoError(t, err)
+	foreign, _, err = otherIssuer.IssueAccessToken(uuid.New(), uuid.New(), 1, nil)
+	require.NoError(t, err)
+	_, err = manager.ValidateAccessToken(foreign)
+	require.ErrorIs(t, err, model.ErrInvalidToken)
+}
+
+func TestNewManagerInvalidKey(t *testing.T) {
+	_, err := NewManager(AlgorithmHS256, []byte("short"), "profile", time.Minute, time.Hour)
+	require.Error(t, err)
+	_, err = NewManager(AlgorithmEdDSA, []byte("not a pem"), "profile", time.Minute, time.Hour)
+	require.Error(t, err)
+	_, err = NewManager("none", testSecret, "profile", time.Minute, time.Hour)
+	require.Error(t, err)
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	manager, err := NewManager(AlgorithmHS256, testSecret, "profile", time.Minute, time.Hour)
+	require.NoError(t, err)
+
+	refreshToken, hash, expiresAt, err := manager.NewRefreshToken()
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshToken)
+	require.Equal(t, HashRefreshToken(refreshToken), hash)
+	require.NotEqual(t, []byte(refreshToken), hash)
+	require.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second)
+
+	another, _, _, err := manager.NewRefreshToken()
+	require.NoError(t, err)
+	require.NotEqual(t, refreshToken, another)
+}
@@ -0,0 +1,83 @@
+// Package totp implements RFC 6238 time-based one-time passwords with HMAC-SHA1, 6 digits and a 30 second step
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 authenticator apps use HMAC-SHA1
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Parameters understood by every authenticator app
+const (
+	Digits     = 6
+	Period     = 30 * time.Second
+	SecretSize = 20
+)
+
+// encoding is a base32 encoding of secrets used by otpauth URIs
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret function returns a new random secret
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	return secret, nil
+}
+
+// EncodeSecret function returns the secret in the base32 form typed into authenticator apps
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// URI function returns an otpauth:// URI of the secret, usually shown as a QR code
+func URI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Step function returns a time step of the moment
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code function returns a code of the time step
+func Code(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
+
+// Validate function checks the code against time steps within skew of now and returns the matched step.
+// Callers must reject steps which were already used to prevent replays
+func Validate(secret []byte, code string, now time.Time, skew int64) (step int64, ok bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(now)
+	for s := current - skew; s <= current+skew; s++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
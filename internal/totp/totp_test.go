@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 secret of RFC 6238 test vectors
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC6238(t *testing.T) {
+	// RFC 6238 Appendix B lists 8 digit codes, 6 digit codes are their last digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, code := range vectors {
+		require.Equal(t, code, Code(rfcSecret, Step(time.Unix(unix, 0))), unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := Validate(rfcSecret, Code(rfcSecret, Step(now)-1), now, 1)
+	require.True(t, ok)
+	require.Equal(t, Step(now)-1, step)
+
+	_, ok = Validate(rfcSecret, Code(rfcSecret, Step(now)-2), now, 1)
+	require.False(t, ok)
+	_, ok = Validate(rfcSecret, "12345", now, 1)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	uri, err := url.Parse(URI("Profile", "user@example.com", secret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.True(t, strings.HasPrefix(uri.Path, "/Profile:user@example.com"))
+	require.Equal(t, EncodeSecret(secret), uri.Query().Get("secret"))
+	require.Equal(t, "Profile", uri.Query().Get("issuer"))
+}
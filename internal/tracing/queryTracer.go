@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer struct turns statements executed by pgx into spans, children of a span in the context of the query.
+// It implements pgx.Logger, pgx reports a statement once it completes along with its duration.
+// A span carries the SQL statement but never its arguments
+type QueryTracer struct {
+	tracer trace.Tracer
+}
+
+// NewQueryTracer creates a new QueryTracer, set it as a logger of a connection with pgx.LogLevelInfo
+// so that successful statements are reported too
+func NewQueryTracer(provider trace.TracerProvider) *QueryTracer {
+	return &QueryTracer{tracer: provider.Tracer("github.com/eugenshima/profile/internal/tracing")}
+}
+
+// Log implements pgx.Logger interface
+func (t *QueryTracer) Log(ctx context.Context, _ pgx.LogLevel, msg string, data map[string]interface{}) {
+	switch msg {
+	case "Exec", "Query", "SendBatch", "CopyFrom":
+	default:
+		return
+	}
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		// statements outside a traced request, such as migrations and pool health checks
+		return
+	}
+	end := time.Now()
+	start := end
+	if elapsed, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-elapsed)
+	}
+	attrs := []trace.SpanStartOption{trace.WithTimestamp(start), trace.WithSpanKind(trace.SpanKindClient)}
+	name := msg
+	if sql, ok := data["sql"].(string); ok {
+		operation := operationOf(sql)
+		name = operation
+		attrs = append(attrs, trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatement(sql), semconv.DBOperation(operation)))
+	} else {
+		attrs = append(attrs, trace.WithAttributes(semconv.DBSystemPostgreSQL))
+	}
+	_, span := t.tracer.Start(ctx, name, attrs...)
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// operationOf function returns the first keyword of the statement, such as SELECT or BEGIN
+func operationOf(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(strings.Trim(fields[0], "("))
+}
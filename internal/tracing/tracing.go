@@ -0,0 +1,64 @@
+// Package tracing exports OpenTelemetry traces of the service
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// Exporters of spans
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config struct contains settings of a tracer provider
+type Config struct {
+	ServiceName string
+	// Exporter is ExporterOTLP or ExporterStdout
+	Exporter string
+	// Endpoint is host:port of an OTLP gRPC collector, Insecure sends spans to it in plaintext
+	Endpoint string
+	Insecure bool
+	// SampleRatio is a fraction of new traces sampled, traces sampled by a caller are always sampled
+	SampleRatio float64
+}
+
+// NewProvider creates a tracer provider batching spans to the configured exporter and installs it globally
+// together with W3C trace context and baggage propagation
+func NewProvider(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("new %s exporter: %w", cfg.Exporter, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, nil
+}
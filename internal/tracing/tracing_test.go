@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQueryTracerRecordsStatements(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	queryTracer := NewQueryTracer(provider)
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "ProfileRepository.GetIDByLoginPassword")
+
+	queryTracer.Log(ctx, 0, "Query", map[string]interface{}{
+		"sql":  "SELECT id, password FROM profile.profile WHERE login=$1",
+		"args": []interface{}{"secret_login"},
+		"time": 20 * time.Millisecond,
+	})
+	queryTracer.Log(ctx, 0, "Exec", map[string]interface{}{
+		"sql": "commit",
+		"err": errors.New("connection reset"),
+	})
+	queryTracer.Log(ctx, 0, "closed connection", nil)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	query := spans[0]
+	require.Equal(t, "SELECT", query.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), query.Parent().SpanID())
+	require.Equal(t, 20*time.Millisecond, query.EndTime().Sub(query.StartTime()))
+	require.Contains(t, query.Attributes(), attribute.String("db.statement", "SELECT id, password FROM profile.profile WHERE login=$1"))
+	for _, attr := range query.Attributes() {
+		require.NotContains(t, attr.Value.Emit(), "secret_login")
+	}
+	require.Equal(t, "COMMIT", spans[1].Name())
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestQueryTracerSkipsUntracedStatements(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	queryTracer := NewQueryTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	queryTracer.Log(context.Background(), 0, "Exec", map[string]interface{}{"sql": "SELECT 1"})
+	require.Empty(t, recorder.Ended())
+}
+
+func TestNewProviderRejectsUnknownExporters(t *testing.T) {
+	_, err := NewProvider(context.Background(), Config{ServiceName: "profile", Exporter: "jaeger", SampleRatio: 1})
+	require.Error(t, err)
+}
+
+func TestNewProviderStdout(t *testing.T) {
+	provider, err := NewProvider(context.Background(), Config{ServiceName: "profile", Exporter: ExporterStdout, SampleRatio: 1})
+	require.NoError(t, err)
+	require.NoError(t, provider.Shutdown(context.Background()))
+}
@@ -0,0 +1,157 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth limits nesting of decoded CBOR items, attestation objects and COSE keys are shallow
+const maxCBORDepth = 16
+
+// errCBOR is returned for malformed or unsupported CBOR
+var errCBOR = errors.New("malformed CBOR")
+
+// decodeCBOR function decodes the first CBOR data item of data and returns it with the remaining bytes.
+// Only definite lengths are supported, integers are decoded as int64, maps as map[interface{}]interface{}
+// with int64 or string keys, byte strings as []byte and text strings as string
+func decodeCBOR(data []byte) (item interface{}, rest []byte, err error) {
+	d := &cborDecoder{data: data}
+	item, err = d.item(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, d.data, nil
+}
+
+// cborDecoder struct consumes data item by item
+type cborDecoder struct {
+	data []byte
+}
+
+// item function decodes a single data item
+func (d *cborDecoder) item(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("nesting is too deep: %w", errCBOR)
+	}
+	if len(d.data) == 0 {
+		return nil, fmt.Errorf("unexpected end of data: %w", errCBOR)
+	}
+	major, info := d.data[0]>>5, d.data[0]&0x1f
+	d.data = d.data[1:]
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("unsupported simple value %d: %w", info, errCBOR)
+		}
+	}
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("integer overflow: %w", errCBOR)
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("integer overflow: %w", errCBOR)
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		if n > uint64(len(d.data)) {
+			return nil, fmt.Errorf("unexpected end of data: %w", errCBOR)
+		}
+		raw := d.data[:n]
+		d.data = d.data[n:]
+		if major == 3 {
+			return string(raw), nil
+		}
+		return raw, nil
+	case 4:
+		// every item takes at least one byte, which bounds the allocation
+		if n > uint64(len(d.data)) {
+			return nil, fmt.Errorf("unexpected end of data: %w", errCBOR)
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if n > uint64(len(d.data))/2 {
+			return nil, fmt.Errorf("unexpected end of data: %w", errCBOR)
+		}
+		items := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("unsupported map key %T: %w", key, errCBOR)
+			}
+			if _, ok := items[key]; ok {
+				return nil, fmt.Errorf("duplicate map key %v: %w", key, errCBOR)
+			}
+			value, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items[key] = value
+		}
+		return items, nil
+	default:
+		// tags are not used by WebAuthn structures
+		return nil, fmt.Errorf("unsupported major type %d: %w", major, errCBOR)
+	}
+}
+
+// argument function reads an argument of the initial byte, indefinite lengths are not supported
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, fmt.Errorf("unsupported additional information %d: %w", info, errCBOR)
+	}
+	if len(d.data) < size {
+		return 0, fmt.Errorf("unexpected end of data: %w", errCBOR)
+	}
+	raw := d.data[:size]
+	d.data = d.data[size:]
+	switch size {
+	case 1:
+		return uint64(raw[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(raw)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(raw)), nil
+	default:
+		return binary.BigEndian.Uint64(raw), nil
+	}
+}
@@ -0,0 +1,34 @@
+package webauthn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: 2, 3: -7, "a": h'0102', "b": [true, null]} followed by a trailing byte
+	data := []byte{0xa4, 0x01, 0x02, 0x03, 0x26, 0x61, 'a', 0x42, 0x01, 0x02, 0x61, 'b', 0x82, 0xf5, 0xf6, 0xff}
+	item, rest, err := decodeCBOR(data)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xff}, rest)
+	require.Equal(t, map[interface{}]interface{}{
+		int64(1): int64(2),
+		int64(3): int64(-7),
+		"a":      []byte{0x01, 0x02},
+		"b":      []interface{}{true, nil},
+	}, item)
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x42, 0x01},                   // truncated byte string
+		{0x9f, 0x01, 0xff},             // indefinite length array
+		{0xa2, 0x01, 0x02, 0x01, 0x03}, // duplicate key
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // huge array
+	} {
+		_, _, err := decodeCBOR(data)
+		require.ErrorIs(t, err, errCBOR, data)
+	}
+}
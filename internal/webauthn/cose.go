@@ -0,0 +1,112 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of supported credential public keys
+const (
+	AlgorithmES256 = -7
+	AlgorithmEdDSA = -8
+	AlgorithmRS256 = -257
+)
+
+// Algorithms lists supported COSE algorithms in the order of preference
+var Algorithms = []int64{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+// COSE key parameters
+const (
+	coseKeyType      = 1
+	coseAlgorithm    = 3
+	coseCurve        = -1
+	coseX            = -2
+	coseY            = -3
+	coseRSAModulus   = -1
+	coseRSAExponent  = -2
+	coseKeyTypeOKP   = 1
+	coseKeyTypeEC2   = 2
+	coseKeyTypeRSA   = 3
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// errPublicKey is returned for malformed or unsupported credential public keys
+var errPublicKey = errors.New("unsupported credential public key")
+
+// publicKey struct represents a decoded COSE public key
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey function decodes a COSE_Key of one of supported algorithms
+func parsePublicKey(cose []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, fmt.Errorf("decodeCBOR: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data: %w", errPublicKey)
+	}
+	params, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("key is not a map: %w", errPublicKey)
+	}
+	keyType, _ := params[int64(coseKeyType)].(int64)
+	algorithm, _ := params[int64(coseAlgorithm)].(int64)
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgorithmES256:
+		curve, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 key: %w", errPublicKey)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on P-256: %w", errPublicKey)
+		}
+		return &publicKey{algorithm: algorithm, key: key}, nil
+	case keyType == coseKeyTypeOKP && algorithm == AlgorithmEdDSA:
+		curve, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key: %w", errPublicKey)
+		}
+		return &publicKey{algorithm: algorithm, key: ed25519.PublicKey(x)}, nil
+	case keyType == coseKeyTypeRSA && algorithm == AlgorithmRS256:
+		n, _ := params[int64(coseRSAModulus)].([]byte)
+		e, _ := params[int64(coseRSAExponent)].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA key: %w", errPublicKey)
+		}
+		return &publicKey{algorithm: algorithm, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	default:
+		return nil, fmt.Errorf("key type %d with algorithm %d: %w", keyType, algorithm, errPublicKey)
+	}
+}
+
+// verify function checks a signature of data made by the key
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,345 @@
+// Package webauthn verifies WebAuthn registration (attestation) and authentication (assertion) ceremonies of passkeys.
+// Only "none" and self "packed" attestations are accepted, authenticators are not checked against a trust store
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+)
+
+// Ceremony types reported in client data
+const (
+	CeremonyCreate = "webauthn.create"
+	CeremonyGet    = "webauthn.get"
+)
+
+// challengeLength is a number of random bytes in a challenge
+const challengeLength = 32
+
+// Authenticator data flags
+const (
+	flagUserPresent       = 0x01
+	flagUserVerified      = 0x04
+	flagAttestedData      = 0x40
+	flagExtensionData     = 0x80
+	authenticatorDataSize = 37
+)
+
+// Config struct contains settings of a relying party
+type Config struct {
+	// ID is a relying party ID, the registrable domain credentials are scoped to
+	ID   string
+	Name string
+	// Origins are accepted origins of client data, e.g. https://example.com
+	Origins []string
+	// RequireUserVerification requires the authenticator to verify the user by a PIN or biometrics, not only their presence
+	RequireUserVerification bool
+	Timeout                 time.Duration
+}
+
+// RelyingParty struct issues ceremony options and verifies responses of authenticators
+type RelyingParty struct {
+	cfg    Config
+	idHash [32]byte
+}
+
+// NewRelyingParty creates a new RelyingParty
+func NewRelyingParty(cfg Config) (*RelyingParty, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("relying party ID must be set")
+	}
+	if len(cfg.Origins) == 0 {
+		return nil, errors.New("at least one origin must be set")
+	}
+	return &RelyingParty{cfg: cfg, idHash: sha256.Sum256([]byte(cfg.ID))}, nil
+}
+
+// Credential struct represents a verified credential of an authenticator, PublicKey is a COSE_Key
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	AAGUID    []byte
+	SignCount uint32
+}
+
+// User struct represents a user account a credential is registered for, ID is the user handle returned on login
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// NewChallenge function generates a random challenge of a ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeLength)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	return challenge, nil
+}
+
+// credentialDescriptor struct is a JSON form of PublicKeyCredentialDescriptor
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// CreationOptions function returns PublicKeyCredentialCreationOptions in the JSON form accepted by
+// PublicKeyCredential.parseCreationOptionsFromJSON, exclude lists credentials the user already has
+func (rp *RelyingParty) CreationOptions(challenge []byte, user *User, exclude [][]byte) ([]byte, error) {
+	type parameter struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	}
+	params := make([]parameter, 0, len(Algorithms))
+	for _, alg := range Algorithms {
+		params = append(params, parameter{Type: "public-key", Alg: alg})
+	}
+	excluded := make([]credentialDescriptor, 0, len(exclude))
+	for _, id := range exclude {
+		excluded = append(excluded, credentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(id)})
+	}
+	return json.Marshal(map[string]interface{}{
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"rp":        map[string]string{"id": rp.cfg.ID, "name": rp.cfg.Name},
+		"user": map[string]string{
+			"id":          base64.RawURLEncoding.EncodeToString(user.ID),
+			"name":        user.Name,
+			"displayName": user.DisplayName,
+		},
+		"pubKeyCredParams":   params,
+		"timeout":            rp.cfg.Timeout.Milliseconds(),
+		"excludeCredentials": excluded,
+		"authenticatorSelection": map[string]string{
+			"residentKey":      "required",
+			"userVerification": rp.userVerification(),
+		},
+		"attestation": "none",
+	})
+}
+
+// RequestOptions function returns PublicKeyCredentialRequestOptions in the JSON form accepted by
+// PublicKeyCredential.parseRequestOptionsFromJSON, credentials are discoverable so none are listed
+func (rp *RelyingParty) RequestOptions(challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"challenge":        base64.RawURLEncoding.EncodeToString(challenge),
+		"rpId":             rp.cfg.ID,
+		"timeout":          rp.cfg.Timeout.Milliseconds(),
+		"userVerification": rp.userVerification(),
+	})
+}
+
+// userVerification function returns a UserVerificationRequirement of the relying party
+func (rp *RelyingParty) userVerification() string {
+	if rp.cfg.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+// clientData struct represents collected client data of a ceremony
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ClientChallenge function checks the type and the origin of client data and returns the challenge it was created for.
+// The caller looks the challenge up to make sure it was issued and is used once
+func (rp *RelyingParty) ClientChallenge(clientDataJSON []byte, ceremony string) ([]byte, error) {
+	data := &clientData{}
+	err := json.Unmarshal(clientDataJSON, data)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal: %v: %w", err, model.ErrInvalidCredentials)
+	}
+	if data.Type != ceremony {
+		return nil, fmt.Errorf("client data type %q: %w", data.Type, model.ErrInvalidCredentials)
+	}
+	if !rp.allowedOrigin(data.Origin) || data.CrossOrigin {
+		return nil, fmt.Errorf("origin %q is not allowed: %w", data.Origin, model.ErrInvalidCredentials)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || len(challenge) == 0 {
+		return nil, fmt.Errorf("invalid challenge: %w", model.ErrInvalidCredentials)
+	}
+	return challenge, nil
+}
+
+// allowedOrigin function reports whether the origin is one of configured ones
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.cfg.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyClientData function checks client data of a ceremony against the challenge issued for it
+func (rp *RelyingParty) verifyClientData(challenge, clientDataJSON []byte, ceremony string) error {
+	got, err := rp.ClientChallenge(clientDataJSON, ceremony)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("challenge mismatch: %w", model.ErrInvalidCredentials)
+	}
+	return nil
+}
+
+// authenticatorData struct represents parsed authenticator data
+type authenticatorData struct {
+	flags     byte
+	signCount uint32
+	// attested credential data, only present on registration
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData function parses authenticator data and checks it is scoped to the relying party
+// and the user was present and, if required, verified
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < authenticatorDataSize {
+		return nil, fmt.Errorf("authenticator data is too short: %w", model.ErrInvalidCredentials)
+	}
+	if subtle.ConstantTimeCompare(raw[:32], rp.idHash[:]) != 1 {
+		return nil, fmt.Errorf("relying party ID mismatch: %w", model.ErrInvalidCredentials)
+	}
+	data := &authenticatorData{flags: raw[32], signCount: binary.BigEndian.Uint32(raw[33:37])}
+	if data.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("user is not present: %w", model.ErrInvalidCredentials)
+	}
+	if rp.cfg.RequireUserVerification && data.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("user is not verified: %w", model.ErrInvalidCredentials)
+	}
+	rest := raw[authenticatorDataSize:]
+	if data.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("attested credential data is too short: %w", model.ErrInvalidCredentials)
+		}
+		data.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("invalid credential ID: %w", model.ErrInvalidCredentials)
+		}
+		data.credentialID, rest = rest[:idLength], rest[idLength:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("credential public key: %v: %w", err, model.ErrInvalidCredentials)
+		}
+		data.publicKey, rest = rest[:len(rest)-len(after)], after
+	}
+	if data.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("extensions: %v: %w", err, model.ErrInvalidCredentials)
+		}
+		rest = after
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing authenticator data: %w", model.ErrInvalidCredentials)
+	}
+	return data, nil
+}
+
+// VerifyRegistration function verifies a response of navigator.credentials.create made for the challenge
+// and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	err := rp.verifyClientData(challenge, clientDataJSON, CeremonyCreate)
+	if err != nil {
+		return nil, err
+	}
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed attestation object: %w", model.ErrInvalidCredentials)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("attestation object is not a map: %w", model.ErrInvalidCredentials)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("no attested credential data: %w", model.ErrInvalidCredentials)
+	}
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsePublicKey: %v: %w", err, model.ErrInvalidCredentials)
+	}
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, fmt.Errorf("none attestation has a statement: %w", model.ErrInvalidCredentials)
+		}
+	case "packed":
+		// self attestation is signed by the credential itself
+		alg, _ := statement["alg"].(int64)
+		sig, _ := statement["sig"].([]byte)
+		if _, ok := statement["x5c"]; ok {
+			return nil, fmt.Errorf("packed attestation with a certificate is not supported: %w", model.ErrInvalidCredentials)
+		}
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		if alg != key.algorithm || !key.verify(concat(rawAuthData, clientDataHash[:]), sig) {
+			return nil, fmt.Errorf("invalid attestation signature: %w", model.ErrInvalidCredentials)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported attestation format %q: %w", format, model.ErrInvalidCredentials)
+	}
+	return &Credential{
+		ID:        append([]byte(nil), authData.credentialID...),
+		PublicKey: append([]byte(nil), authData.publicKey...),
+		AAGUID:    append([]byte(nil), authData.aaguid...),
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion function verifies a response of navigator.credentials.get made for the challenge by the credential
+// and returns a new signature counter of the credential. A counter which did not grow indicates a cloned authenticator
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, credential *Credential, clientDataJSON, rawAuthData, signature []byte) (uint32, error) {
+	err := rp.verifyClientData(challenge, clientDataJSON, CeremonyGet)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("parsePublicKey: %w", err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if !key.verify(concat(rawAuthData, clientDataHash[:]), signature) {
+		return 0, fmt.Errorf("invalid assertion signature: %w", model.ErrInvalidCredentials)
+	}
+	// authenticators without a counter always report zero
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, fmt.Errorf("signature counter did not grow: %w", model.ErrInvalidCredentials)
+	}
+	return authData.signCount, nil
+}
+
+// concat function returns a new slice of a followed by b
+func concat(a, b []byte) []byte {
+	out := make([]byte, 0, len(a)+len(b))
+	return append(append(out, a...), b...)
+}
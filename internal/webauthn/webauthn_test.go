@@ -0,0 +1,117 @@
+package webauthn_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eugenshima/profile/internal/model"
+	"github.com/eugenshima/profile/internal/webauthn"
+	"github.com/eugenshima/profile/internal/webauthn/webauthntest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newTestRelyingParty(t *testing.T) *webauthn.RelyingParty {
+	rp, err := webauthn.NewRelyingParty(webauthn.Config{
+		ID:                      testRPID,
+		Name:                    "Example",
+		Origins:                 []string{testOrigin},
+		RequireUserVerification: true,
+		Timeout:                 time.Minute,
+	})
+	require.NoError(t, err)
+	return rp
+}
+
+// register function registers a passkey of the authenticator and returns the verified credential
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	options, err := rp.CreationOptions(mustChallenge(t), &webauthn.User{ID: []byte("user"), Name: "login"}, nil)
+	require.NoError(t, err)
+	challenge, err := webauthntest.Challenge(options)
+	require.NoError(t, err)
+	clientData, attestation, err := authenticator.Register(challenge, []byte("user"))
+	require.NoError(t, err)
+	credential, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	require.NoError(t, err)
+	return credential
+}
+
+func mustChallenge(t *testing.T) []byte {
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	return challenge
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator, err := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	require.NoError(t, err)
+	credential := register(t, rp, authenticator)
+	require.Equal(t, authenticator.CredentialID, credential.ID)
+	require.Equal(t, authenticator.PublicKey(), credential.PublicKey)
+
+	challenge := mustChallenge(t)
+	clientData, authData, signature, err := authenticator.Assert(challenge)
+	require.NoError(t, err)
+	got, err := rp.ClientChallenge(clientData, webauthn.CeremonyGet)
+	require.NoError(t, err)
+	require.Equal(t, challenge, got)
+	signCount, err := rp.VerifyAssertion(challenge, credential, clientData, authData, signature)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), signCount)
+
+	// a replayed assertion does not advance the counter
+	credential.SignCount = signCount
+	_, err = rp.VerifyAssertion(challenge, credential, clientData, authData, signature)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+}
+
+func TestAssertionRejected(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator, err := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	require.NoError(t, err)
+	credential := register(t, rp, authenticator)
+
+	challenge := mustChallenge(t)
+	clientData, authData, signature, err := authenticator.Assert(challenge)
+	require.NoError(t, err)
+	_, err = rp.VerifyAssertion(mustChallenge(t), credential, clientData, authData, signature)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	signature[len(signature)-1] ^= 0xff
+	_, err = rp.VerifyAssertion(challenge, credential, clientData, authData, signature)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	other, err := webauthntest.NewAuthenticator("evil.example", testOrigin)
+	require.NoError(t, err)
+	other.CredentialID = authenticator.CredentialID
+	clientData, authData, signature, err = other.Assert(challenge)
+	require.NoError(t, err)
+	_, err = rp.VerifyAssertion(challenge, credential, clientData, authData, signature)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	phishing, err := webauthntest.NewAuthenticator(testRPID, "https://evil.example")
+	require.NoError(t, err)
+	clientData, _, _, err = phishing.Assert(challenge)
+	require.NoError(t, err)
+	_, err = rp.ClientChallenge(clientData, webauthn.CeremonyGet)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+	_, err = rp.ClientChallenge(clientData, webauthn.CeremonyCreate)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+}
+
+func TestRegistrationRequiresUserVerification(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator, err := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	require.NoError(t, err)
+	authenticator.UserVerified = false
+	challenge := mustChallenge(t)
+	clientData, attestation, err := authenticator.Register(challenge, []byte("user"))
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(challenge, clientData, attestation)
+	require.ErrorIs(t, err, model.ErrInvalidCredentials)
+}
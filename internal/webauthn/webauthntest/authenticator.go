@@ -0,0 +1,181 @@
+// Package webauthntest provides a software authenticator for testing WebAuthn relying parties
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Authenticator struct is a software authenticator holding a single ES256 passkey
+type Authenticator struct {
+	RPID   string
+	Origin string
+	// CredentialID and UserHandle are set by Register
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+	// UserVerified is reported in authenticator data, it is true by default
+	UserVerified bool
+	key          *ecdsa.PrivateKey
+}
+
+// NewAuthenticator creates a new Authenticator of the relying party with a fresh P-256 key
+func NewAuthenticator(rpID, origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("GenerateKey: %w", err)
+	}
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	return &Authenticator{RPID: rpID, Origin: origin, CredentialID: credentialID, UserVerified: true, key: key}, nil
+}
+
+// Register function creates the passkey for the user and returns client data and a "none" attestation object
+func (a *Authenticator) Register(challenge, userHandle []byte) (clientDataJSON, attestationObject []byte, err error) {
+	a.UserHandle = userHandle
+	clientDataJSON, err = a.clientData("webauthn.create", challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	attested := make([]byte, 18, 18+len(a.CredentialID))
+	binary.BigEndian.PutUint16(attested[16:], uint16(len(a.CredentialID)))
+	attested = append(attested, a.CredentialID...)
+	attested = append(attested, a.PublicKey()...)
+	authData := a.authenticatorData(0x40)
+	authData = append(authData, attested...)
+	attestationObject = encode(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+	return clientDataJSON, attestationObject, nil
+}
+
+// Assert function signs the challenge with the passkey, the signature counter is incremented first
+func (a *Authenticator) Assert(challenge []byte) (clientDataJSON, authData, signature []byte, err error) {
+	a.SignCount++
+	clientDataJSON, err = a.clientData("webauthn.get", challenge)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	authData = a.authenticatorData(0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err = ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("SignASN1: %w", err)
+	}
+	return clientDataJSON, authData, signature, nil
+}
+
+// PublicKey function returns the COSE_Key of the passkey
+func (a *Authenticator) PublicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	return encode(map[interface{}]interface{}{
+		int64(1):  int64(2),
+		int64(3):  int64(-7),
+		int64(-1): int64(1),
+		int64(-2): x,
+		int64(-3): y,
+	})
+}
+
+// Challenge function extracts the challenge of creation or request options returned by a relying party
+func Challenge(options []byte) ([]byte, error) {
+	parsed := struct {
+		Challenge string `json:"challenge"`
+	}{}
+	err := json.Unmarshal(options, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal: %w", err)
+	}
+	return base64.RawURLEncoding.DecodeString(parsed.Challenge)
+}
+
+// clientData function returns collected client data of a ceremony
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// authenticatorData function returns authenticator data without attested credential data
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.SignCount)
+	return data
+}
+
+// encode function encodes int64, []byte, string and map values as CBOR, map keys are sorted for determinism
+func encode(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return header(1, uint64(-1-v))
+		}
+		return header(0, uint64(v))
+	case []byte:
+		return append(header(2, uint64(len(v))), v...)
+	case string:
+		return append(header(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(v))
+		encoded := make(map[string][]byte, len(v))
+		for key, item := range v {
+			k := encode(key)
+			keys = append(keys, k)
+			encoded[string(k)] = encode(item)
+		}
+		sort.Slice(keys, func(i, j int) bool { return string(keys[i]) < string(keys[j]) })
+		out := header(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, k...), encoded[string(k)]...)
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T", value))
+	}
+}
+
+// header function returns an initial byte of the major type with its argument
+func header(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		out := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(out[1:], uint16(n))
+		return out
+	case n <= 0xffffffff:
+		out := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(out[1:], uint32(n))
+		return out
+	default:
+		out := []byte{major<<5 | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(out[1:], n)
+		return out
+	}
+}
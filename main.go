@@ -3,28 +3,77 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/eugenshima/profile/internal/audit"
+	"github.com/eugenshima/profile/internal/authz"
 	cfgrtn "github.com/eugenshima/profile/internal/config"
 	"github.com/eugenshima/profile/internal/handlers"
+	"github.com/eugenshima/profile/internal/healthcheck"
+	"github.com/eugenshima/profile/internal/lifecycle"
+	"github.com/eugenshima/profile/internal/lockout"
+	"github.com/eugenshima/profile/internal/logging"
+	"github.com/eugenshima/profile/internal/metrics"
+	"github.com/eugenshima/profile/internal/migrator"
+	"github.com/eugenshima/profile/internal/mtls"
+	"github.com/eugenshima/profile/internal/notify"
+	"github.com/eugenshima/profile/internal/password"
 	"github.com/eugenshima/profile/internal/repository"
+	"github.com/eugenshima/profile/internal/secretbox"
 	"github.com/eugenshima/profile/internal/service"
+	"github.com/eugenshima/profile/internal/token"
+	"github.com/eugenshima/profile/internal/tracing"
+	"github.com/eugenshima/profile/internal/webauthn"
+	"github.com/eugenshima/profile/migration"
 	proto "github.com/eugenshima/profile/proto"
 
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/net/netutil"
 )
 
-// NewDBPsql function provides Connection with PostgreSQL database
-func NewDBPsql(env string) (*pgxpool.Pool, error) {
+// NewDBPsql function provides Connection with PostgreSQL database, statements are reported to queryLogger unless it is nil
+func NewDBPsql(cfg cfgrtn.DatabaseConfig, queryLogger pgx.Logger) (*pgxpool.Pool, error) {
 	// Initialization a connect configuration for a PostgreSQL using pgx driver
-	config, err := pgxpool.ParseConfig(env)
+	config, err := pgxpool.ParseConfig(cfg.URL)
 	if err != nil {
 		return nil, fmt.Errorf("error connection to PostgreSQL: %v", err)
 	}
+	config.MaxConns = cfg.MaxConns
+	config.MinConns = cfg.MinConns
+	config.MaxConnLifetime = cfg.MaxConnLifetime
+	config.MaxConnIdleTime = cfg.MaxConnIdleTime
+	config.HealthCheckPeriod = cfg.HealthCheckPeriod
+	config.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	if cfg.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if queryLogger != nil {
+		config.ConnConfig.Logger = queryLogger
+		config.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
 
 	// Establishing a new connection to a PostgreSQL database using the pgx driver
 	pool, err := pgxpool.ConnectConfig(context.Background(), config)
@@ -37,31 +86,385 @@ func NewDBPsql(env string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
+// setupLogging function applies the configured level and format to the standard logger and redacts secrets from its output
+func setupLogging(cfg cfgrtn.LogConfig) error {
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("ParseLevel: %w", err)
+	}
+	logrus.SetLevel(level)
+	logrus.AddHook(logging.RedactionHook{})
+	if cfg.Format == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	}
+	return nil
+}
+
+// serverOptions function translates the server configuration into gRPC server options
+func serverOptions(cfg cfgrtn.ServerConfig) []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(cfg.MaxSendMsgSize),
+		grpc.ConnectionTimeout(cfg.ConnectionTimeout),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     cfg.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:      cfg.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.Keepalive.MaxConnectionAgeGrace,
+			Time:                  cfg.Keepalive.Time,
+			Timeout:               cfg.Keepalive.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Keepalive.MinPingInterval,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}),
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	return opts
+}
+
+// migrate function runs the `migrate up|down|status` subcommand
+func migrate(ctx context.Context, m *migrator.Migrator, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("Up: %w", err)
+		}
+		fmt.Printf("Applied %d migration(s), schema version %d\n", applied, m.Latest())
+	case "down":
+		reverted, err := m.Down(ctx)
+		if err != nil {
+			return fmt.Errorf("Down: %w", err)
+		}
+		if reverted == 0 {
+			fmt.Println("Nothing to revert")
+			return nil
+		}
+		fmt.Printf("Reverted migration V%d\n", reverted)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("Status: %w", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("V%d\t%s\t%s\n", s.Version, s.Description, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	return nil
+}
+
+// assignRole function runs the `assign-role <profile-id> <role>` subcommand, it bootstraps the first admin
+func assignRole(ctx context.Context, rps *repository.ProfileRepository, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: assign-role <profile-id> <role>")
+	}
+	profileID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid profile ID: %w", err)
+	}
+	err = rps.AssignRole(ctx, profileID, args[1])
+	if err != nil {
+		return fmt.Errorf("AssignRole: %w", err)
+	}
+	fmt.Printf("Assigned role %s to profile %s\n", args[1], profileID)
+	return nil
+}
+
 // main function of our microservice
 func main() {
 	cfg, err := cfgrtn.NewConfig()
 	if err != nil {
-		fmt.Printf("Error extracting env variables: %v", err)
+		logrus.Fatalf("cannot load configuration: %v", err)
+	}
+	err = setupLogging(cfg.Log)
+	if err != nil {
+		logrus.Fatalf("setupLogging: %v", err)
+	}
+	var provider *sdktrace.TracerProvider
+	var queryTracer pgx.Logger
+	if cfg.Tracing.Exporter != tracing.ExporterNone {
+		provider, err = tracing.NewProvider(context.Background(), tracing.Config{
+			ServiceName: cfg.Tracing.ServiceName,
+			Exporter:    cfg.Tracing.Exporter,
+			Endpoint:    cfg.Tracing.OTLPEndpoint,
+			Insecure:    cfg.Tracing.OTLPInsecure,
+			SampleRatio: cfg.Tracing.SampleRatio,
+		})
+		if err != nil {
+			logrus.Fatalf("tracing.NewProvider: %v", err)
+		}
+		queryTracer = tracing.NewQueryTracer(provider)
+	}
+	pool, err := NewDBPsql(cfg.Database, queryTracer)
+	if err != nil {
+		logrus.Fatalf("NewDBPsql: %v", err)
+	}
+
+	mgr, err := migrator.NewMigrator(pool, migration.FS)
+	if err != nil {
+		logrus.Fatalf("NewMigrator: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate(context.Background(), mgr, os.Args[2:])
+		if err != nil {
+			logrus.Fatalf("migrate: %v", err)
+		}
 		return
 	}
-	pool, err := NewDBPsql(cfg.PgxDBAddr)
+	if cfg.AutoMigrate {
+		_, err = mgr.Up(context.Background())
+		if err != nil {
+			logrus.Fatalf("cannot apply migrations: %v", err)
+		}
+	} else {
+		pending, err := mgr.Check(context.Background())
+		if err != nil {
+			logrus.Fatalf("cannot check migrations: %v", err)
+		}
+		if pending > 0 {
+			logrus.Warnf("%d pending migration(s), run `migrate up`", pending)
+		}
+	}
+
+	blocklist, err := password.LoadBlocklist(cfg.Password.BlocklistFile)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"PgxDBAddr: ": cfg.PgxDBAddr}).Errorf("NewDBPsql: %v", err)
+		logrus.Fatalf("LoadBlocklist: %v", err)
+	}
+	policy := &password.Policy{
+		MinLength:     cfg.Password.MinLength,
+		MaxLength:     cfg.Password.MaxLength,
+		RequireUpper:  cfg.Password.RequireUpper,
+		RequireLower:  cfg.Password.RequireLower,
+		RequireDigit:  cfg.Password.RequireDigit,
+		RequireSymbol: cfg.Password.RequireSymbol,
+		Blocklist:     blocklist,
+	}
+
+	var hasher password.Hasher
+	switch cfg.Password.Algorithm {
+	case password.AlgorithmBcrypt:
+		hasher = &password.BcryptHasher{Cost: cfg.Password.BcryptCost}
+	case password.AlgorithmArgon2id:
+		hasher = &password.Argon2idHasher{
+			Memory:      cfg.Password.Argon2Memory,
+			Iterations:  cfg.Password.Argon2Iterations,
+			Parallelism: cfg.Password.Argon2Parallelism,
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+	default:
+		logrus.Fatalf("unknown password hashing algorithm %q", cfg.Password.Algorithm)
+	}
+
+	signingKey := []byte(cfg.Token.Secret)
+	if cfg.Token.Algorithm != token.AlgorithmHS256 {
+		signingKey, err = os.ReadFile(cfg.Token.PrivateKeyFile)
+		if err != nil {
+			logrus.Fatalf("cannot read token private key: %v", err)
+		}
+	}
+	tokens, err := token.NewManager(cfg.Token.Algorithm, signingKey, cfg.Token.Issuer, cfg.Token.AccessTTL, cfg.Token.RefreshTTL)
+	if err != nil {
+		logrus.Fatalf("token.NewManager: %v", err)
+	}
+
+	var attempts lockout.Store
+	switch cfg.Lockout.Store {
+	case "memory":
+		attempts = lockout.NewMemoryStore()
+	case "postgres":
+		attempts = repository.NewLoginAttemptRepository(pool)
+	default:
+		logrus.Fatalf("unknown lockout store %q", cfg.Lockout.Store)
+	}
+	guard := lockout.NewGuard(attempts, lockout.Config{
+		MaxAccountFailures: cfg.Lockout.MaxAccountFailures,
+		MaxIPFailures:      cfg.Lockout.MaxIPFailures,
+		Window:             cfg.Lockout.Window,
+		BaseDuration:       cfg.Lockout.BaseDuration,
+		MaxDuration:        cfg.Lockout.MaxDuration,
+	})
+
+	var notifier notify.Notifier
+	switch cfg.Notify.Notifier {
+	case "log":
+		logrus.Warn("NOTIFY_NOTIFIER=log writes reset tokens and verification codes to the log, use it for development only")
+		notifier = notify.NewLogNotifier(logrus.StandardLogger())
+	case "file":
+		notifier = notify.NewFileNotifier(cfg.Notify.File)
+	case "smtp":
+		smtpNotifier := &notify.SMTPNotifier{Addr: cfg.Notify.SMTPAddr, From: cfg.Notify.SMTPFrom}
+		if cfg.Notify.SMTPUsername != "" {
+			host, _, err := net.SplitHostPort(cfg.Notify.SMTPAddr)
+			if err != nil {
+				logrus.Fatalf("invalid SMTP address: %v", err)
+			}
+			smtpNotifier.Auth = smtp.PlainAuth("", cfg.Notify.SMTPUsername, cfg.Notify.SMTPPassword, host)
+		}
+		notifier = smtpNotifier
+	default:
+		logrus.Fatalf("unknown notifier %q", cfg.Notify.Notifier)
+	}
+
+	mfa := service.MFA{Issuer: cfg.MFA.Issuer, RecoveryCodes: cfg.MFA.RecoveryCodes}
+	if cfg.MFA.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.MFA.EncryptionKey)
+		if err != nil {
+			logrus.Fatalf("invalid MFA encryption key: %v", err)
+		}
+		mfa.Box, err = secretbox.NewBox(key)
+		if err != nil {
+			logrus.Fatalf("secretbox.NewBox: %v", err)
+		}
+	} else {
+		logrus.Warn("MFA_ENCRYPTION_KEY is not set, two-factor authentication cannot be enrolled")
+	}
+
+	rp, err := webauthn.NewRelyingParty(webauthn.Config{
+		ID:                      cfg.WebAuthn.RPID,
+		Name:                    cfg.WebAuthn.RPName,
+		Origins:                 cfg.WebAuthn.Origins,
+		RequireUserVerification: cfg.WebAuthn.RequireUserVerification,
+		Timeout:                 cfg.WebAuthn.Timeout,
+	})
+	if err != nil {
+		logrus.Fatalf("webauthn.NewRelyingParty: %v", err)
 	}
 
-	rps := repository.NewProfileRepository(pool)
-	srv := service.NewProfileService(rps)
+	registry := metrics.NewRegistry()
+	metrics.RegisterPool(registry, pool)
+	rps := repository.NewProfileRepository(pool, metrics.NewQueries(registry))
+	if len(os.Args) > 1 && os.Args[1] == "assign-role" {
+		err = assignRole(context.Background(), rps, os.Args[2:])
+		if err != nil {
+			logrus.Fatalf("assign-role: %v", err)
+		}
+		return
+	}
+	lifetimes := service.Lifetimes{
+		PasswordReset:     cfg.Password.ResetTTL,
+		EmailVerification: cfg.Token.EmailVerificationTTL,
+		MFAChallenge:      cfg.MFA.ChallengeTTL,
+		WebAuthnChallenge: cfg.WebAuthn.Timeout,
+	}
+	srv := service.NewProfileService(rps, policy, password.NewManager(hasher), tokens, guard, notifier, lifetimes, mfa, rp,
+		audit.NewLogSink(logrus.StandardLogger()), metrics.NewDomain(registry))
 	handler := handlers.NewProfileHandler(srv)
 
-	lis, err := net.Listen("tcp", "127.0.0.1:8082")
+	lis, err := net.Listen("tcp", cfg.Server.ListenAddr)
 	if err != nil {
 		logrus.Fatalf("cannot create listener: %s", err)
 	}
+	if cfg.Server.MaxConnections > 0 {
+		lis = netutil.LimitListener(lis, cfg.Server.MaxConnections)
+	}
 
-	serverRegistrar := grpc.NewServer()
+	authorizer := authz.NewAuthorizer(srv, cfg.Authz.CacheTTL)
+	services := handlers.NewServiceAuthenticator(cfg.Server.TLS.ServiceIdentities, cfg.Server.TLS.ServiceRPCs)
+	rpcMetrics := metrics.NewRPC(registry)
+	opts := append(serverOptions(cfg.Server),
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), logging.UnaryInterceptor(), rpcMetrics.UnaryInterceptor(),
+			services.UnaryInterceptor(), handler.AuthenticationInterceptor(), handlers.AuthorizationInterceptor(authorizer)),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), logging.StreamInterceptor(), rpcMetrics.StreamInterceptor(),
+			services.StreamInterceptor(), handler.StreamAuthenticationInterceptor(), handlers.StreamAuthorizationInterceptor(authorizer)),
+	)
+	if cfg.Server.TLS.CertFile != "" {
+		reloader, err := mtls.NewReloader(mtls.Files{
+			CertFile:     cfg.Server.TLS.CertFile,
+			KeyFile:      cfg.Server.TLS.KeyFile,
+			ClientCAFile: cfg.Server.TLS.ClientCAFile,
+		}, cfg.Server.TLS.ReloadInterval, cfg.Server.TLS.RequireClientCert)
+		if err != nil {
+			logrus.Fatalf("mtls.NewReloader: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+	} else {
+		logrus.Warn("SERVER_TLS_CERT_FILE is not set, the server listens in plaintext")
+	}
+	serverRegistrar := grpc.NewServer(opts...)
 	proto.RegisterProfilesServer(serverRegistrar, handler)
-	err = serverRegistrar.Serve(lis)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(serverRegistrar, healthServer)
+	if cfg.Server.Reflection {
+		reflection.Register(serverRegistrar)
+		logrus.Info("gRPC server reflection is enabled")
+	}
+	checker := healthcheck.NewChecker(healthServer, cfg.Server.Health.Interval, cfg.Server.Health.Timeout)
+	checker.Add("PostgreSQL", pool.Ping, proto.Profiles_ServiceDesc.ServiceName)
+
+	manager := lifecycle.NewManager(serverRegistrar, healthServer, cfg.Server.ShutdownTimeout, proto.Profiles_ServiceDesc.ServiceName)
+	manager.Go("health checker", checker.Run)
+	if provider != nil {
+		// registered first to run last, spans of drained RPCs are flushed
+		manager.OnShutdown("tracer provider", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := provider.Shutdown(ctx)
+			if err != nil {
+				logrus.Errorf("Shutdown: %v", err)
+			}
+		})
+	}
+	manager.OnShutdown("PostgreSQL pool", pool.Close)
+	// registered after the pool to run before it is closed
+	manager.OnShutdown("password reset deliveries", srv.Wait)
+	if cfg.Metrics.ListenAddr != "" {
+		serveMetrics(manager, registry, cfg.Metrics.ListenAddr)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = manager.Run(ctx, lis)
+	stop()
+	os.Exit(exitCode(err))
+}
+
+// serveMetrics function exposes metrics of registry over HTTP at addr, the endpoint is closed once in-flight RPCs are drained
+func serveMetrics(manager *lifecycle.Manager, registry *prometheus.Registry, addr string) {
+	lis, err := net.Listen("tcp", addr)
 	if err != nil {
-		logrus.Fatalf("cannot start server: %s", err)
+		logrus.Fatalf("cannot create metrics listener: %s", err)
+	}
+	server := metrics.NewServer(registry)
+	go func() {
+		err := server.Serve(lis)
+		if !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("metrics server: %v", err)
+		}
+	}()
+	manager.OnShutdown("metrics server", func() {
+		err := server.Close()
+		if err != nil {
+			logrus.Errorf("Close: %v", err)
+		}
+	})
+}
+
+// Exit codes of the service, startup failures exit with 1 through logrus.Fatal
+const (
+	exitServeFailed     = 2
+	exitShutdownTimeout = 3
+)
+
+// exitCode function returns an exit code describing how the server stopped
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, lifecycle.ErrShutdownTimeout):
+		logrus.Error("in-flight RPCs were cancelled on shutdown")
+		return exitShutdownTimeout
+	default:
+		logrus.Errorf("server failed: %v", err)
+		return exitServeFailed
 	}
 }
@@ -0,0 +1,5 @@
+DROP INDEX profile.profile_verified_email_idx;
+
+ALTER TABLE profile.profile
+    DROP COLUMN email,
+    DROP COLUMN email_verified_at;
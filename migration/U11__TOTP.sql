@@ -0,0 +1,2 @@
+DROP TABLE profile.recovery_codes;
+DROP TABLE profile.totp;
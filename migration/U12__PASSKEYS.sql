@@ -0,0 +1,2 @@
+DROP TABLE profile.webauthn_challenges;
+DROP TABLE profile.passkeys;
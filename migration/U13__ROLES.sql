@@ -0,0 +1,4 @@
+DROP TABLE profile.profile_roles;
+DROP TABLE profile.role_permissions;
+DROP TABLE profile.permissions;
+DROP TABLE profile.roles;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS profile.profile;
+
+DROP SCHEMA IF EXISTS profile;
@@ -0,0 +1,3 @@
+ALTER TABLE profile.profile
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS profile.profile_refresh_token_idx;
+
+ALTER TABLE profile.profile
+    DROP COLUMN refresh_token_expires_at;
@@ -0,0 +1,17 @@
+ALTER TABLE profile.profile
+    ADD COLUMN refresh_token bytea,
+    ADD COLUMN refresh_token_expires_at timestamptz;
+
+CREATE UNIQUE INDEX profile_refresh_token_idx ON profile.profile (refresh_token);
+
+UPDATE profile.profile p
+SET refresh_token = t.token_hash, refresh_token_expires_at = t.expires_at
+FROM (
+    SELECT DISTINCT ON (profile_id) profile_id, token_hash, expires_at
+    FROM profile.refresh_tokens
+    WHERE rotated_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+    ORDER BY profile_id, created_at DESC
+) t
+WHERE p.id = t.profile_id;
+
+DROP TABLE profile.refresh_tokens;
@@ -0,0 +1,10 @@
+ALTER TABLE profile.refresh_tokens
+    DROP CONSTRAINT refresh_tokens_family_id_fkey,
+    ADD COLUMN device varchar(255) NOT NULL DEFAULT '';
+
+UPDATE profile.refresh_tokens t
+SET device = s.device
+FROM profile.sessions s
+WHERE t.family_id = s.id;
+
+DROP TABLE profile.sessions;
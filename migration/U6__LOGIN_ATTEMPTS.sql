@@ -0,0 +1 @@
+DROP TABLE profile.login_attempts;
@@ -0,0 +1,2 @@
+ALTER TABLE profile.profile
+    DROP COLUMN credentials_version;
@@ -0,0 +1 @@
+DROP TABLE profile.password_resets;
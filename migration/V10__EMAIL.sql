@@ -0,0 +1,7 @@
+-- email is an optional contact address, email_verified_at is set once its owner proves control of it
+ALTER TABLE profile.profile
+    ADD COLUMN email             varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN email_verified_at timestamptz;
+
+-- a verified email is a login alias, so it must identify a single profile
+CREATE UNIQUE INDEX profile_verified_email_idx ON profile.profile (lower(email)) WHERE email_verified_at IS NOT NULL;
@@ -0,0 +1,16 @@
+-- TOTP authenticators, secrets are sealed by the service before they are stored
+CREATE TABLE profile.totp (
+    profile_id     uuid PRIMARY KEY REFERENCES profile.profile (id) ON DELETE CASCADE,
+    secret         bytea       NOT NULL,
+    last_used_step bigint      NOT NULL DEFAULT 0,
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    confirmed_at   timestamptz
+);
+
+-- single-use recovery codes, only their hashes are stored
+CREATE TABLE profile.recovery_codes (
+    profile_id uuid  NOT NULL REFERENCES profile.profile (id) ON DELETE CASCADE,
+    code_hash  bytea NOT NULL,
+    used_at    timestamptz,
+    PRIMARY KEY (profile_id, code_hash)
+);
@@ -0,0 +1,23 @@
+-- WebAuthn credentials, public_key is a COSE_Key
+CREATE TABLE profile.passkeys (
+    credential_id bytea PRIMARY KEY,
+    profile_id    uuid        NOT NULL REFERENCES profile.profile (id) ON DELETE CASCADE,
+    public_key    bytea       NOT NULL,
+    aaguid        bytea       NOT NULL,
+    sign_count    bigint      NOT NULL DEFAULT 0,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    last_used_at  timestamptz
+);
+
+CREATE INDEX passkeys_profile_id_idx ON profile.passkeys (profile_id);
+
+-- single-use challenges of WebAuthn ceremonies, profile_id is NULL for logins
+CREATE TABLE profile.webauthn_challenges (
+    challenge_hash bytea PRIMARY KEY,
+    ceremony       text        NOT NULL,
+    profile_id     uuid REFERENCES profile.profile (id) ON DELETE CASCADE,
+    expires_at     timestamptz NOT NULL,
+    used_at        timestamptz
+);
+
+CREATE INDEX webauthn_challenges_expires_at_idx ON profile.webauthn_challenges (expires_at);
@@ -0,0 +1,53 @@
+-- role based access control, permissions are named <resource>:<action>:<scope>,
+-- a self scope allows acting on the caller's own profile, an any scope on every profile
+CREATE TABLE profile.roles (
+    name        varchar(64) PRIMARY KEY,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE profile.permissions (
+    name        varchar(64) PRIMARY KEY,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE profile.role_permissions (
+    role       varchar(64) NOT NULL REFERENCES profile.roles (name) ON DELETE CASCADE,
+    permission varchar(64) NOT NULL REFERENCES profile.permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE profile.profile_roles (
+    profile_id  uuid        NOT NULL REFERENCES profile.profile (id) ON DELETE CASCADE,
+    role        varchar(64) NOT NULL REFERENCES profile.roles (name) ON DELETE CASCADE,
+    assigned_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (profile_id, role)
+);
+
+INSERT INTO profile.permissions (name, description) VALUES
+    ('profile:read:self', 'read the own profile'),
+    ('profile:read:any', 'read any profile'),
+    ('profile:update:self', 'update the own profile'),
+    ('profile:update:any', 'update any profile'),
+    ('profile:delete:self', 'delete the own profile'),
+    ('profile:delete:any', 'delete any profile'),
+    ('profile:unlock:any', 'unlock any profile locked by failed logins'),
+    ('credentials:manage:self', 'manage the own password, email verification, two-factor authentication and passkeys'),
+    ('credentials:manage:any', 'manage credentials of any profile'),
+    ('session:manage:self', 'list and revoke the own sessions'),
+    ('session:manage:any', 'list and revoke sessions of any profile'),
+    ('role:read:self', 'list the own roles'),
+    ('role:read:any', 'list roles of any profile'),
+    ('role:assign:any', 'assign and revoke roles of any profile');
+
+INSERT INTO profile.roles (name, description) VALUES
+    ('user', 'every profile, acts on its own profile only'),
+    ('admin', 'acts on every profile');
+
+INSERT INTO profile.role_permissions (role, permission)
+SELECT 'user', name FROM profile.permissions WHERE name LIKE '%:self';
+
+INSERT INTO profile.role_permissions (role, permission)
+SELECT 'admin', name FROM profile.permissions WHERE name LIKE '%:any';
+
+INSERT INTO profile.profile_roles (profile_id, role)
+SELECT id, 'user' FROM profile.profile;
@@ -1 +1,9 @@
-.
\ No newline at end of file
+CREATE SCHEMA IF NOT EXISTS profile;
+
+CREATE TABLE profile.profile (
+    id            uuid PRIMARY KEY,
+    login         varchar(255) NOT NULL UNIQUE,
+    password      bytea        NOT NULL,
+    refresh_token bytea,
+    username      varchar(255) NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE profile.profile
+    ADD COLUMN created_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now();
@@ -0,0 +1,7 @@
+-- refresh tokens are stored as SHA-256 hashes from now on, previously stored raw tokens are discarded
+UPDATE profile.profile SET refresh_token = NULL;
+
+ALTER TABLE profile.profile
+    ADD COLUMN refresh_token_expires_at timestamptz;
+
+CREATE UNIQUE INDEX profile_refresh_token_idx ON profile.profile (refresh_token);
@@ -0,0 +1,26 @@
+-- every login starts a token family, each rotation adds a row to it and marks the previous one as rotated
+CREATE TABLE profile.refresh_tokens (
+    id         uuid PRIMARY KEY,
+    family_id  uuid         NOT NULL,
+    profile_id uuid         NOT NULL REFERENCES profile.profile (id) ON DELETE CASCADE,
+    token_hash bytea        NOT NULL UNIQUE,
+    device     varchar(255) NOT NULL DEFAULT '',
+    created_at timestamptz  NOT NULL DEFAULT now(),
+    expires_at timestamptz  NOT NULL,
+    rotated_at timestamptz,
+    revoked_at timestamptz
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON profile.refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_profile_id_idx ON profile.refresh_tokens (profile_id);
+
+INSERT INTO profile.refresh_tokens (id, family_id, profile_id, token_hash, expires_at)
+SELECT gen_random_uuid(), gen_random_uuid(), id, refresh_token, refresh_token_expires_at
+FROM profile.profile
+WHERE refresh_token IS NOT NULL AND refresh_token_expires_at > now();
+
+DROP INDEX profile.profile_refresh_token_idx;
+
+ALTER TABLE profile.profile
+    DROP COLUMN refresh_token,
+    DROP COLUMN refresh_token_expires_at;
@@ -0,0 +1,22 @@
+-- a session is a refresh token family, it is created on login and lives until it is revoked or expires
+CREATE TABLE profile.sessions (
+    id           uuid PRIMARY KEY,
+    profile_id   uuid         NOT NULL REFERENCES profile.profile (id) ON DELETE CASCADE,
+    device       varchar(255) NOT NULL DEFAULT '',
+    user_agent   text         NOT NULL DEFAULT '',
+    client_ip    varchar(64)  NOT NULL DEFAULT '',
+    created_at   timestamptz  NOT NULL DEFAULT now(),
+    last_used_at timestamptz  NOT NULL DEFAULT now(),
+    revoked_at   timestamptz
+);
+
+CREATE INDEX sessions_profile_id_idx ON profile.sessions (profile_id);
+
+INSERT INTO profile.sessions (id, profile_id, device, created_at, last_used_at, revoked_at)
+SELECT family_id, profile_id, max(device), min(created_at), max(created_at), max(revoked_at)
+FROM profile.refresh_tokens
+GROUP BY family_id, profile_id;
+
+ALTER TABLE profile.refresh_tokens
+    DROP COLUMN device,
+    ADD CONSTRAINT refresh_tokens_family_id_fkey FOREIGN KEY (family_id) REFERENCES profile.sessions (id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+-- failed login counters shared by every replica, keyed by account or source IP
+CREATE TABLE profile.login_attempts (
+    key             varchar(300) PRIMARY KEY,
+    failures        integer     NOT NULL,
+    last_failure_at timestamptz NOT NULL,
+    locked_until    timestamptz
+);
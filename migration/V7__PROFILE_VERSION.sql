@@ -0,0 +1,3 @@
+-- version is bumped by every write of a profile and compared by conditional updates and deletes
+ALTER TABLE profile.profile
+    ADD COLUMN version bigint NOT NULL DEFAULT 1;
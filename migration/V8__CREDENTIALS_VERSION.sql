@@ -0,0 +1,3 @@
+-- credentials_version is bumped whenever the password is changed by its owner or reset
+ALTER TABLE profile.profile
+    ADD COLUMN credentials_version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+-- single-use password reset tokens, only their hashes are stored
+CREATE TABLE profile.password_resets (
+    id         uuid PRIMARY KEY,
+    profile_id uuid        NOT NULL REFERENCES profile.profile (id) ON DELETE CASCADE,
+    token_hash bytea       NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+
+CREATE INDEX password_resets_profile_id_idx ON profile.password_resets (profile_id);
@@ -0,0 +1,11 @@
+// Package migration contains versioned SQL migrations of the profile database
+package migration
+
+import "embed"
+
+// FS contains every migration script, embedded into the binary.
+// V<n>__<description>.sql files upgrade the schema to version n,
+// U<n>__<description>.sql files undo them
+//
+//go:embed *.sql
+var FS embed.FS